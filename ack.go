@@ -0,0 +1,82 @@
+package ali_mns
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gogap/errors"
+)
+
+// Message wraps a received message together with its queue so it can be
+// settled without handling receipt handles. A message can be settled once;
+// later calls return ERR_MNS_MESSAGE_ALREADY_SETTLED.
+type Message struct {
+	MessageReceiveResponse
+
+	queue   AliMNSQueue
+	settled bool
+	locker  sync.Mutex
+}
+
+func WrapMessage(queue AliMNSQueue, message MessageReceiveResponse) *Message {
+	return &Message{
+		MessageReceiveResponse: message,
+		queue:                  queue,
+	}
+}
+
+// Ack deletes the message from the queue.
+func (p *Message) Ack() (err error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if err = p.checkSettled(); err != nil {
+		return
+	}
+
+	if err = p.queue.DeleteMessage(p.ReceiptHandle); err != nil {
+		return
+	}
+
+	p.settled = true
+	return
+}
+
+// Nack makes the message visible again after DefaultNackVisibilityTimeout
+// seconds.
+func (p *Message) Nack() error {
+	return p.NackWithDelay(time.Duration(DefaultNackVisibilityTimeout) * time.Second)
+}
+
+// NackWithDelay makes the message visible again after delay, rounded up to
+// whole seconds.
+func (p *Message) NackWithDelay(delay time.Duration) (err error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if err = p.checkSettled(); err != nil {
+		return
+	}
+
+	seconds := int64((delay + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	var resp MessageVisibilityChangeResponse
+	if resp, err = p.queue.ChangeMessageVisibility(p.ReceiptHandle, seconds); err != nil {
+		return
+	}
+
+	p.ReceiptHandle = resp.ReceiptHandle
+	p.NextVisibleTime = resp.NextVisibleTime
+	p.settled = true
+	return
+}
+
+func (p *Message) checkSettled() error {
+	if p.settled {
+		return ERR_MNS_MESSAGE_ALREADY_SETTLED.New(errors.Params{"id": p.MessageId})
+	}
+	return nil
+}
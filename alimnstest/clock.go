@@ -0,0 +1,150 @@
+package alimnstest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gogap/ali_mns"
+)
+
+// FakeClock is an ali_mns.Clock that only moves when told to. Timers and
+// tickers fire from Advance, on the goroutine calling it; like the ones of
+// package time their channels hold one tick, later ticks are dropped while
+// it is unread.
+type FakeClock struct {
+	now    time.Time
+	timers []*fakeTimer
+	locker sync.Mutex
+}
+
+var _ ali_mns.Clock = (*FakeClock)(nil)
+
+// NewFakeClock starts at start, or at the real time if start is zero.
+func NewFakeClock(start time.Time) *FakeClock {
+	if start.IsZero() {
+		start = time.Now()
+	}
+	return &FakeClock{now: start}
+}
+
+func (p *FakeClock) Now() time.Time {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	return p.now
+}
+
+// Advance moves the clock forward by d, firing the timers and tickers due
+// on the way in order.
+func (p *FakeClock) Advance(d time.Duration) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	end := p.now.Add(d)
+
+	for {
+		sort.Slice(p.timers, func(i, j int) bool {
+			return p.timers[i].deadline.Before(p.timers[j].deadline)
+		})
+
+		if len(p.timers) == 0 || p.timers[0].deadline.After(end) {
+			break
+		}
+
+		timer := p.timers[0]
+		if timer.deadline.After(p.now) {
+			p.now = timer.deadline
+		}
+
+		select {
+		case timer.c <- p.now:
+		default:
+		}
+
+		if timer.period > 0 {
+			timer.deadline = timer.deadline.Add(timer.period)
+		} else {
+			p.remove(timer)
+		}
+	}
+
+	p.now = end
+}
+
+// Waiters returns how many timers and tickers are running, so a test can
+// wait for the code under test to start waiting before advancing.
+func (p *FakeClock) Waiters() int {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	return len(p.timers)
+}
+
+func (p *FakeClock) NewTimer(d time.Duration) ali_mns.Timer {
+	return p.add(d, 0)
+}
+
+func (p *FakeClock) NewTicker(d time.Duration) ali_mns.Ticker {
+	if d <= 0 {
+		panic("alimnstest: non-positive interval for NewTicker")
+	}
+	return fakeTicker{p.add(d, d)}
+}
+
+func (p *FakeClock) add(d time.Duration, period time.Duration) *fakeTimer {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	timer := &fakeTimer{
+		clock:    p,
+		deadline: p.now.Add(d),
+		period:   period,
+		c:        make(chan time.Time, 1),
+	}
+
+	if d <= 0 && period == 0 {
+		timer.c <- p.now
+		return timer
+	}
+
+	p.timers = append(p.timers, timer)
+	return timer
+}
+
+// remove must be called with the locker held.
+func (p *FakeClock) remove(timer *fakeTimer) (removed bool) {
+	for i, t := range p.timers {
+		if t == timer {
+			p.timers = append(p.timers[:i], p.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTimer struct {
+	clock    *FakeClock
+	deadline time.Time
+	period   time.Duration
+	c        chan time.Time
+}
+
+func (p *fakeTimer) C() <-chan time.Time {
+	return p.c
+}
+
+func (p *fakeTimer) Stop() bool {
+	p.clock.locker.Lock()
+	defer p.clock.locker.Unlock()
+
+	return p.clock.remove(p)
+}
+
+type fakeTicker struct {
+	*fakeTimer
+}
+
+func (p fakeTicker) Stop() {
+	p.fakeTimer.Stop()
+}
@@ -0,0 +1,789 @@
+// Package alimnstest provides in-memory stand-ins for ali_mns types, so code
+// built on them can be unit-tested without an MNS endpoint.
+package alimnstest
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogap/errors"
+
+	"github.com/gogap/ali_mns"
+)
+
+const (
+	DefaultFakeQueueName         = "fake-queue"
+	DefaultFakeVisibilityTimeout = 30 * time.Second
+)
+
+type FakeQueueOption func(*FakeQueue)
+
+func WithName(name string) FakeQueueOption {
+	return func(p *FakeQueue) {
+		if name != "" {
+			p.name = name
+		}
+	}
+}
+
+// WithVisibilityTimeout sets how long received messages stay invisible,
+// 30 seconds by default like a new MNS queue.
+func WithVisibilityTimeout(timeout time.Duration) FakeQueueOption {
+	return func(p *FakeQueue) {
+		if timeout > 0 {
+			p.visibilityTimeout = timeout
+		}
+	}
+}
+
+// WithPollingWait sets how long receives wait for a message when called
+// without waitseconds, 0 by default.
+func WithPollingWait(wait time.Duration) FakeQueueOption {
+	return func(p *FakeQueue) {
+		if wait >= 0 {
+			p.pollingWait = wait
+		}
+	}
+}
+
+// WithClock makes the queue tell time by clock, e.g. a FakeClock to expire
+// visibility timeouts and delays without waiting.
+func WithClock(clock ali_mns.Clock) FakeQueueOption {
+	return func(p *FakeQueue) {
+		if clock != nil {
+			p.clock = clock
+		}
+	}
+}
+
+// FakeQueue is an ali_mns.AliMNSQueue kept in memory. Like MNS it hides
+// delayed messages until their delay passes and received ones for the
+// visibility timeout, hands out a new receipt handle on every receive and
+// counts dequeues. Messages are received by priority, then in the order
+// they were sent. Empty receives fail with ERR_MNS_MESSAGE_NOT_EXIST.
+//
+// Bodies are stored as sent: compression, encryption and body codecs of
+// ali_mns.MNSQueue are not applied.
+type FakeQueue struct {
+	name              string
+	visibilityTimeout time.Duration
+	pollingWait       time.Duration
+	clock             ali_mns.Clock
+
+	// rawBodies is set by Server, whose queues store bodies as they are on
+	// the wire, so their MD5 is taken as is.
+	rawBodies bool
+
+	messages []*fakeMessage
+	handles  map[string]*fakeMessage
+	seq      int64
+
+	operations map[string]int64
+	errors     map[string]int64
+
+	notifyChan chan bool
+	stopCtx    context.Context
+	stopCancel context.CancelFunc
+	locker     sync.Mutex
+}
+
+type fakeMessage struct {
+	id               string
+	body             []byte
+	priority         int64
+	enqueueTime      time.Time
+	firstDequeueTime time.Time
+	dequeueCount     int64
+	visibleAt        time.Time
+	receiptHandle    string
+	seq              int64
+}
+
+var _ ali_mns.AliMNSQueue = (*FakeQueue)(nil)
+var _ ali_mns.ContextReceiver = (*FakeQueue)(nil)
+var _ ali_mns.ContextMessageSender = (*FakeQueue)(nil)
+var _ ali_mns.BodySender = (*FakeQueue)(nil)
+var _ ali_mns.ScheduledSender = (*FakeQueue)(nil)
+var _ ali_mns.StreamReceiver = (*FakeQueue)(nil)
+var _ ali_mns.RawReceiver = (*FakeQueue)(nil)
+var _ ali_mns.StatsReporter = (*FakeQueue)(nil)
+
+func NewFakeQueue(opts ...FakeQueueOption) *FakeQueue {
+	queue := &FakeQueue{
+		name:              DefaultFakeQueueName,
+		visibilityTimeout: DefaultFakeVisibilityTimeout,
+		handles:           make(map[string]*fakeMessage),
+		operations:        make(map[string]int64),
+		errors:            make(map[string]int64),
+		notifyChan:        make(chan bool),
+		clock:             ali_mns.SystemClock,
+	}
+
+	for _, opt := range opts {
+		opt(queue)
+	}
+
+	return queue
+}
+
+func (p *FakeQueue) Name() string {
+	return p.name
+}
+
+func (p *FakeQueue) SendMessage(message ali_mns.MessageSendRequest) (resp ali_mns.MessageSendResponse, err error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	resp, err = p.send(message)
+	p.record("SendMessage", err)
+
+	return
+}
+
+// SendMessageContext is SendMessage failing with the error of ctx if it is
+// done.
+func (p *FakeQueue) SendMessageContext(ctx context.Context, message ali_mns.MessageSendRequest) (resp ali_mns.MessageSendResponse, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return p.SendMessage(message)
+}
+
+func (p *FakeQueue) BatchSendMessage(messages ...ali_mns.MessageSendRequest) (resp ali_mns.BatchMessageSendResponse, err error) {
+	if len(messages) == 0 {
+		return
+	}
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	failed := 0
+	for _, message := range messages {
+		sent, e := p.send(message)
+		if e != nil {
+			failed++
+			sent.Code = "InvalidArgument"
+			sent.Message = e.Error()
+		}
+		resp.Messages = append(resp.Messages, sent)
+	}
+
+	if failed > 0 {
+		err = ali_mns.ERR_MNS_BATCH_SEND_PARTIAL_FAILURE.New(errors.Params{"failed": failed, "total": len(messages), "resource": p.resource()})
+	}
+
+	p.record("BatchSendMessage", err)
+
+	return
+}
+
+func (p *FakeQueue) SendStringMessage(body string, opts ...ali_mns.SendOption) (resp ali_mns.MessageSendResponse, err error) {
+	return p.SendMessage(newMessage([]byte(body), opts...))
+}
+
+func (p *FakeQueue) SendJSONMessage(v interface{}, opts ...ali_mns.SendOption) (resp ali_mns.MessageSendResponse, err error) {
+	body, e := json.Marshal(v)
+	if e != nil {
+		err = ali_mns.ERR_MARSHAL_MESSAGE_FAILED.New(errors.Params{"err": e})
+		return
+	}
+
+	return p.SendMessage(newMessage(body, opts...))
+}
+
+func (p *FakeQueue) SendMessageAt(body []byte, deliverAt time.Time, opts ...ali_mns.SendOption) (resp ali_mns.MessageSendResponse, err error) {
+	message := newMessage(body, opts...)
+
+	if delay := deliverAt.Sub(p.clock.Now()); delay > 0 {
+		message.DelaySeconds = int64((delay + time.Second - 1) / time.Second)
+	}
+
+	return p.SendMessage(message)
+}
+
+func newMessage(body []byte, opts ...ali_mns.SendOption) ali_mns.MessageSendRequest {
+	message := ali_mns.MessageSendRequest{
+		MessageBody: ali_mns.Base64Bytes(body),
+		Priority:    ali_mns.DefaultMessagePriority,
+	}
+
+	for _, opt := range opts {
+		opt(&message)
+	}
+
+	return message
+}
+
+// send must be called with the locker held.
+func (p *FakeQueue) send(message ali_mns.MessageSendRequest) (resp ali_mns.MessageSendResponse, err error) {
+	if message.DelaySeconds < 0 || message.DelaySeconds > int64(ali_mns.MaxMessageDelay/time.Second) {
+		err = ali_mns.ERR_MNS_MESSAGE_DELAY_SECONDS_RANGE_ERROR.New()
+		return
+	}
+
+	priority := message.Priority
+	if priority == 0 {
+		priority = ali_mns.DefaultMessagePriority
+	}
+
+	if priority < ali_mns.MinMessagePriority || priority > ali_mns.MaxMessagePriority {
+		err = ali_mns.ERR_MNS_MESSAGE_PRIORITY_RANGE_ERROR.New()
+		return
+	}
+
+	p.seq++
+	now := p.clock.Now()
+
+	stored := &fakeMessage{
+		id:          fmt.Sprintf("FAKE-%016X", p.seq),
+		body:        append([]byte(nil), message.MessageBody...),
+		priority:    priority,
+		enqueueTime: now,
+		visibleAt:   now.Add(time.Duration(message.DelaySeconds) * time.Second),
+		seq:         p.seq,
+	}
+
+	p.messages = append(p.messages, stored)
+	p.notify()
+
+	resp.MessageId = stored.id
+	resp.MessageBodyMD5 = p.bodyMD5(stored.body)
+
+	return
+}
+
+// notify wakes up waiting receives. Must be called with the locker held.
+func (p *FakeQueue) notify() {
+	close(p.notifyChan)
+	p.notifyChan = make(chan bool)
+}
+
+// bodyMD5 returns the MessageBodyMD5 MNS reports, the digest of the body
+// on the wire.
+func (p *FakeQueue) bodyMD5(body []byte) string {
+	if !p.rawBodies {
+		body = []byte(base64.StdEncoding.EncodeToString(body))
+	}
+
+	sum := md5.Sum(body)
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// take returns up to n visible messages, making them invisible unless
+// peekOnly. Must be called with the locker held.
+func (p *FakeQueue) take(n int, peekOnly bool) (messages []ali_mns.MessageReceiveResponse) {
+	now := p.clock.Now()
+
+	var visible []*fakeMessage
+	for _, message := range p.messages {
+		if !message.visibleAt.After(now) {
+			visible = append(visible, message)
+		}
+	}
+
+	sort.Slice(visible, func(i, j int) bool {
+		if visible[i].priority != visible[j].priority {
+			return visible[i].priority < visible[j].priority
+		}
+		return visible[i].seq < visible[j].seq
+	})
+
+	if len(visible) > n {
+		visible = visible[:n]
+	}
+
+	for _, message := range visible {
+		if !peekOnly {
+			if message.firstDequeueTime.IsZero() {
+				message.firstDequeueTime = now
+			}
+			message.dequeueCount++
+			message.visibleAt = now.Add(p.visibilityTimeout)
+
+			delete(p.handles, message.receiptHandle)
+			p.seq++
+			message.receiptHandle = fmt.Sprintf("%s-%d", message.id, p.seq)
+			p.handles[message.receiptHandle] = message
+		}
+
+		messages = append(messages, p.response(message, peekOnly))
+	}
+
+	return
+}
+
+func (p *FakeQueue) response(message *fakeMessage, peekOnly bool) (resp ali_mns.MessageReceiveResponse) {
+	resp.MessageId = message.id
+	resp.MessageBodyMD5 = p.bodyMD5(message.body)
+	resp.MessageBody = append(ali_mns.Base64Bytes(nil), message.body...)
+	resp.EnqueueTime = millis(message.enqueueTime)
+	resp.FirstDequeueTime = millis(message.firstDequeueTime)
+	resp.DequeueCount = message.dequeueCount
+	resp.Priority = message.priority
+
+	if !peekOnly {
+		resp.ReceiptHandle = message.receiptHandle
+		resp.NextVisibleTime = millis(message.visibleAt)
+	}
+
+	return
+}
+
+func millis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// receive waits up to wait for visible messages.
+func (p *FakeQueue) receive(ctx context.Context, op string, n int, peekOnly bool, wait time.Duration) (messages []ali_mns.MessageReceiveResponse, err error) {
+	deadline := p.clock.Now().Add(wait)
+
+	for {
+		p.locker.Lock()
+		messages = p.take(n, peekOnly)
+		notifyChan := p.notifyChan
+		next := p.nextVisible()
+		p.locker.Unlock()
+
+		remaining := deadline.Sub(p.clock.Now())
+		if len(messages) > 0 || remaining <= 0 || ctx.Err() != nil {
+			break
+		}
+
+		if until := next.Sub(p.clock.Now()); !next.IsZero() && until < remaining {
+			remaining = until
+		}
+
+		timer := p.clock.NewTimer(remaining)
+		select {
+		case <-notifyChan:
+		case <-timer.C():
+		case <-ctx.Done():
+		}
+		timer.Stop()
+	}
+
+	if len(messages) == 0 {
+		err = ali_mns.ParseError(ali_mns.ErrorMessageResponse{
+			Code:    "MessageNotExist",
+			Message: "Message not exist.",
+		}, p.resource())
+	}
+
+	p.locker.Lock()
+	p.record(op, err)
+	p.locker.Unlock()
+
+	return
+}
+
+// nextVisible returns when the next hidden message becomes visible, zero if
+// none is hidden. Must be called with the locker held.
+func (p *FakeQueue) nextVisible() (next time.Time) {
+	now := p.clock.Now()
+	for _, message := range p.messages {
+		if message.visibleAt.After(now) && (next.IsZero() || message.visibleAt.Before(next)) {
+			next = message.visibleAt
+		}
+	}
+	return
+}
+
+func (p *FakeQueue) waitOf(waitseconds []int64) time.Duration {
+	if len(waitseconds) == 1 && waitseconds[0] >= 0 {
+		return time.Duration(waitseconds[0]) * time.Second
+	}
+	return p.pollingWait
+}
+
+func intervalOf(interval []time.Duration) time.Duration {
+	if len(interval) == 1 {
+		return interval[0]
+	}
+	return 0
+}
+
+// loop calls fn until Stop or ctx is done, pausing between calls for
+// interval, or briefly after an empty receive so callers without a wait do
+// not spin.
+func (p *FakeQueue) loop(ctx context.Context, interval time.Duration, fn func(ctx context.Context) (empty bool)) {
+	stopCtx := p.loopContext()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-stopCtx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for ctx.Err() == nil {
+		empty := fn(ctx)
+
+		pause := interval
+		if empty && pause < time.Millisecond*10 {
+			pause = time.Millisecond * 10
+		}
+
+		if pause > 0 {
+			timer := p.clock.NewTimer(pause)
+			select {
+			case <-timer.C():
+			case <-ctx.Done():
+			}
+			timer.Stop()
+		}
+	}
+}
+
+func deliver(ctx context.Context, respChan interface{}, errChan chan error, resp interface{}, err error) (empty bool) {
+	if err != nil {
+		select {
+		case errChan <- err:
+		case <-ctx.Done():
+		}
+		return true
+	}
+
+	switch ch := respChan.(type) {
+	case chan ali_mns.MessageReceiveResponse:
+		select {
+		case ch <- resp.(ali_mns.MessageReceiveResponse):
+		case <-ctx.Done():
+		}
+	case chan ali_mns.BatchMessageReceiveResponse:
+		select {
+		case ch <- resp.(ali_mns.BatchMessageReceiveResponse):
+		case <-ctx.Done():
+		}
+	case chan ali_mns.RawMessageResponse:
+		select {
+		case ch <- resp.(ali_mns.RawMessageResponse):
+		case <-ctx.Done():
+		}
+	}
+
+	return false
+}
+
+func (p *FakeQueue) ReceiveMessage(respChan chan ali_mns.MessageReceiveResponse, errChan chan error, waitseconds ...int64) {
+	p.ReceiveMessageContext(context.Background(), respChan, errChan, waitseconds...)
+}
+
+// ReceiveMessageContext is ReceiveMessage ending when ctx is done as well
+// as on Stop.
+func (p *FakeQueue) ReceiveMessageContext(ctx context.Context, respChan chan ali_mns.MessageReceiveResponse, errChan chan error, waitseconds ...int64) {
+	p.loop(ctx, 0, func(ctx context.Context) bool {
+		messages, err := p.receive(ctx, "ReceiveMessage", 1, false, p.waitOf(waitseconds))
+		if ctx.Err() != nil {
+			return true
+		}
+
+		var resp ali_mns.MessageReceiveResponse
+		if err == nil {
+			resp = messages[0]
+		}
+		return deliver(ctx, respChan, errChan, resp, err)
+	})
+}
+
+func (p *FakeQueue) BatchReceiveMessage(respChan chan ali_mns.BatchMessageReceiveResponse, errChan chan error, numOfMessages int32, waitseconds ...int64) {
+	p.BatchReceiveMessageContext(context.Background(), respChan, errChan, numOfMessages, waitseconds...)
+}
+
+// BatchReceiveMessageContext is BatchReceiveMessage ending when ctx is done
+// as well as on Stop.
+func (p *FakeQueue) BatchReceiveMessageContext(ctx context.Context, respChan chan ali_mns.BatchMessageReceiveResponse, errChan chan error, numOfMessages int32, waitseconds ...int64) {
+	n := batchSize(numOfMessages)
+
+	p.loop(ctx, 0, func(ctx context.Context) bool {
+		messages, err := p.receive(ctx, "BatchReceiveMessage", n, false, p.waitOf(waitseconds))
+		if ctx.Err() != nil {
+			return true
+		}
+		return deliver(ctx, respChan, errChan, ali_mns.BatchMessageReceiveResponse{Messages: messages}, err)
+	})
+}
+
+func (p *FakeQueue) BatchReceiveMessageFunc(fn func(ali_mns.MessageReceiveResponse) error, numOfMessages int32, waitseconds ...int64) (err error) {
+	messages, err := p.receive(p.loopContext(), "BatchReceiveMessage", batchSize(numOfMessages), false, p.waitOf(waitseconds))
+	if err != nil {
+		return
+	}
+
+	for _, message := range messages {
+		if err = fn(message); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (p *FakeQueue) PeekMessage(respChan chan ali_mns.MessageReceiveResponse, errChan chan error, interval ...time.Duration) {
+	p.loop(context.Background(), intervalOf(interval), func(ctx context.Context) bool {
+		messages, err := p.receive(ctx, "PeekMessage", 1, true, 0)
+
+		var resp ali_mns.MessageReceiveResponse
+		if err == nil {
+			resp = messages[0]
+		}
+		return deliver(ctx, respChan, errChan, resp, err)
+	})
+}
+
+func (p *FakeQueue) BatchPeekMessage(respChan chan ali_mns.BatchMessageReceiveResponse, errChan chan error, numOfMessages int32, interval ...time.Duration) {
+	n := batchSize(numOfMessages)
+
+	p.loop(context.Background(), intervalOf(interval), func(ctx context.Context) bool {
+		messages, err := p.receive(ctx, "BatchPeekMessage", n, true, 0)
+		return deliver(ctx, respChan, errChan, ali_mns.BatchMessageReceiveResponse{Messages: messages}, err)
+	})
+}
+
+// wireMessage is a message as MNS encodes it in receive responses.
+type wireMessage struct {
+	XMLName xml.Name `xml:"Message"`
+	ali_mns.MessageReceiveResponse
+}
+
+func rawResponse(message ali_mns.MessageReceiveResponse) (resp ali_mns.RawMessageResponse, err error) {
+	body, err := xml.Marshal(wireMessage{MessageReceiveResponse: message})
+	if err != nil {
+		return
+	}
+
+	resp.Body = append([]byte(xml.Header), body...)
+	return
+}
+
+func (p *FakeQueue) ReceiveRawMessage(respChan chan ali_mns.RawMessageResponse, errChan chan error, waitseconds ...int64) {
+	p.loop(context.Background(), 0, func(ctx context.Context) bool {
+		messages, err := p.receive(ctx, "ReceiveMessage", 1, false, p.waitOf(waitseconds))
+		if ctx.Err() != nil {
+			return true
+		}
+
+		var resp ali_mns.RawMessageResponse
+		if err == nil {
+			resp, err = rawResponse(messages[0])
+		}
+		return deliver(ctx, respChan, errChan, resp, err)
+	})
+}
+
+func (p *FakeQueue) PeekRawMessage(respChan chan ali_mns.RawMessageResponse, errChan chan error, interval ...time.Duration) {
+	p.loop(context.Background(), intervalOf(interval), func(ctx context.Context) bool {
+		messages, err := p.receive(ctx, "PeekMessage", 1, true, 0)
+
+		var resp ali_mns.RawMessageResponse
+		if err == nil {
+			resp, err = rawResponse(messages[0])
+		}
+		return deliver(ctx, respChan, errChan, resp, err)
+	})
+}
+
+func batchSize(numOfMessages int32) int {
+	if numOfMessages <= 0 {
+		numOfMessages = ali_mns.DefaultNumOfMessages
+	}
+	return int(numOfMessages)
+}
+
+// DeleteMessage fails with ERR_MNS_MESSAGE_NOT_EXIST if receiptHandle is not
+// the latest handle of a message, as when the message was received again
+// after its visibility timeout.
+func (p *FakeQueue) DeleteMessage(receiptHandle string) (err error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	err = p.delete(receiptHandle)
+	p.record("DeleteMessage", err)
+
+	return
+}
+
+func (p *FakeQueue) BatchDeleteMessage(receiptHandles ...string) (err error) {
+	if len(receiptHandles) == 0 {
+		return
+	}
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	failed := 0
+	for _, receiptHandle := range receiptHandles {
+		if p.delete(receiptHandle) != nil {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		err = ali_mns.ParseError(ali_mns.ErrorMessageResponse{
+			Code:    "BatchDeleteFail",
+			Message: fmt.Sprintf("%d of %d receipt handles failed.", failed, len(receiptHandles)),
+		}, p.resource())
+	}
+
+	p.record("BatchDeleteMessage", err)
+
+	return
+}
+
+// delete must be called with the locker held.
+func (p *FakeQueue) delete(receiptHandle string) (err error) {
+	message, exist := p.handles[receiptHandle]
+	if !exist {
+		return ali_mns.ParseError(ali_mns.ErrorMessageResponse{
+			Code:    "MessageNotExist",
+			Message: "Message not exist or receipt handle expired.",
+		}, p.resource())
+	}
+
+	delete(p.handles, receiptHandle)
+
+	for i, m := range p.messages {
+		if m == message {
+			p.messages = append(p.messages[:i], p.messages[i+1:]...)
+			break
+		}
+	}
+
+	return
+}
+
+func (p *FakeQueue) ChangeMessageVisibility(receiptHandle string, visibilityTimeout int64) (resp ali_mns.MessageVisibilityChangeResponse, err error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	defer func() {
+		p.record("ChangeMessageVisibility", err)
+	}()
+
+	message, exist := p.handles[receiptHandle]
+	if !exist {
+		err = ali_mns.ParseError(ali_mns.ErrorMessageResponse{
+			Code:    "MessageNotExist",
+			Message: "Message not exist or receipt handle expired.",
+		}, p.resource())
+		return
+	}
+
+	delete(p.handles, receiptHandle)
+	p.seq++
+	message.receiptHandle = fmt.Sprintf("%s-%d", message.id, p.seq)
+	message.visibleAt = p.clock.Now().Add(time.Duration(visibilityTimeout) * time.Second)
+	p.handles[message.receiptHandle] = message
+
+	if visibilityTimeout == 0 {
+		p.notify()
+	}
+
+	resp.ReceiptHandle = message.receiptHandle
+	resp.NextVisibleTime = millis(message.visibleAt)
+
+	return
+}
+
+// record must be called with the locker held.
+func (p *FakeQueue) record(op string, err error) {
+	p.operations[op]++
+	if err != nil {
+		p.errors[op]++
+	}
+}
+
+// Stats counts the calls of the queue by MNS API name; QPS, History and
+// Lag are not simulated.
+func (p *FakeQueue) Stats() (stats ali_mns.QueueStats) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	stats.Operations = make(map[string]int64, len(p.operations))
+	for op, count := range p.operations {
+		stats.Operations[op] = count
+	}
+
+	stats.Errors = make(map[string]int64, len(p.errors))
+	for op, count := range p.errors {
+		stats.Errors[op] = count
+	}
+
+	return
+}
+
+// Attributes returns the message counts of the queue as GetQueueAttributes
+// would.
+func (p *FakeQueue) Attributes() (attr ali_mns.QueueAttribute) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	now := p.clock.Now()
+
+	attr.QueueName = p.name
+	attr.VisibilityTimeout = int32(p.visibilityTimeout / time.Second)
+	attr.PollingWaitSeconds = int32(p.pollingWait / time.Second)
+
+	for _, message := range p.messages {
+		switch {
+		case !message.visibleAt.After(now):
+			attr.ActiveMessages++
+		case message.dequeueCount > 0:
+			attr.InactiveMessages++
+		default:
+			attr.DelayMessages++
+		}
+	}
+
+	return
+}
+
+// Purge deletes every message of the queue.
+func (p *FakeQueue) Purge() {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.messages = nil
+	p.handles = make(map[string]*fakeMessage)
+}
+
+// Stop ends every receive and peek loop running on this queue, like
+// ali_mns.MNSQueue.Stop.
+func (p *FakeQueue) Stop() {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if p.stopCancel != nil {
+		p.stopCancel()
+		p.stopCtx, p.stopCancel = nil, nil
+	}
+}
+
+func (p *FakeQueue) loopContext() context.Context {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if p.stopCtx == nil {
+		p.stopCtx, p.stopCancel = context.WithCancel(context.Background())
+	}
+
+	return p.stopCtx
+}
+
+func (p *FakeQueue) resource() string {
+	return fmt.Sprintf("queues/%s/%s", p.name, "messages")
+}
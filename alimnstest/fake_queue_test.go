@@ -0,0 +1,185 @@
+package alimnstest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gogap/ali_mns"
+	"github.com/gogap/ali_mns/alimnstest"
+)
+
+func newFakeQueue(t *testing.T) (*alimnstest.FakeClock, *alimnstest.FakeQueue) {
+	clock := alimnstest.NewFakeClock(time.Time{})
+	queue := alimnstest.NewFakeQueue(alimnstest.WithClock(clock), alimnstest.WithVisibilityTimeout(30*time.Second))
+	t.Cleanup(queue.Stop)
+
+	return clock, queue
+}
+
+// receive returns the next visible message of queue without waiting.
+func receive(queue *alimnstest.FakeQueue) (message ali_mns.MessageReceiveResponse, ok bool) {
+	err := queue.BatchReceiveMessageFunc(func(m ali_mns.MessageReceiveResponse) error {
+		message, ok = m, true
+		return nil
+	}, 1, 0)
+
+	return message, err == nil && ok
+}
+
+func TestFakeQueueVisibilityTimeout(t *testing.T) {
+	clock, queue := newFakeQueue(t)
+
+	if _, err := queue.SendStringMessage("hidden"); err != nil {
+		t.Fatal(err)
+	}
+
+	first, ok := receive(queue)
+	if !ok {
+		t.Fatal("sent message not received")
+	}
+	if first.DequeueCount != 1 {
+		t.Fatalf("dequeue count is %d, want 1", first.DequeueCount)
+	}
+
+	for _, step := range []struct {
+		advance time.Duration
+		visible bool
+	}{
+		{0, false},
+		{29 * time.Second, false},
+		{time.Second, true},
+	} {
+		clock.Advance(step.advance)
+
+		if attr := queue.Attributes(); (attr.ActiveMessages == 1) != step.visible || (attr.InactiveMessages == 1) == step.visible {
+			t.Fatalf("%d active and %d inactive messages, visible: %t", attr.ActiveMessages, attr.InactiveMessages, step.visible)
+		}
+
+		again, ok := receive(queue)
+		if ok != step.visible {
+			t.Fatalf("received: %t, want %t", ok, step.visible)
+		}
+		if !ok {
+			continue
+		}
+
+		if again.DequeueCount != 2 {
+			t.Fatalf("dequeue count is %d, want 2", again.DequeueCount)
+		}
+		if again.FirstDequeueTime != first.FirstDequeueTime {
+			t.Fatalf("first dequeue time moved from %d to %d", first.FirstDequeueTime, again.FirstDequeueTime)
+		}
+		if again.ReceiptHandle == first.ReceiptHandle {
+			t.Fatal("receipt handle not rotated")
+		}
+
+		if err := queue.DeleteMessage(first.ReceiptHandle); !ali_mns.ERR_MNS_MESSAGE_NOT_EXIST.IsEqual(err) {
+			t.Fatalf("delete with the old receipt handle got %v, want ERR_MNS_MESSAGE_NOT_EXIST", err)
+		}
+		if err := queue.DeleteMessage(again.ReceiptHandle); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, ok := receive(queue); ok {
+		t.Fatal("deleted message received")
+	}
+}
+
+func TestFakeQueueChangeMessageVisibility(t *testing.T) {
+	clock, queue := newFakeQueue(t)
+
+	if _, err := queue.SendStringMessage("extended"); err != nil {
+		t.Fatal(err)
+	}
+	received, _ := receive(queue)
+
+	changed, err := queue.ChangeMessageVisibility(received.ReceiptHandle, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed.ReceiptHandle == received.ReceiptHandle {
+		t.Fatal("receipt handle not rotated")
+	}
+	if _, err := queue.ChangeMessageVisibility(received.ReceiptHandle, 60); !ali_mns.ERR_MNS_MESSAGE_NOT_EXIST.IsEqual(err) {
+		t.Fatalf("change with the old receipt handle got %v, want ERR_MNS_MESSAGE_NOT_EXIST", err)
+	}
+
+	clock.Advance(59 * time.Second)
+	if _, ok := receive(queue); ok {
+		t.Fatal("received before the changed visibility timeout passed")
+	}
+
+	// a timeout of 0 releases the message right away
+	if _, err := queue.ChangeMessageVisibility(changed.ReceiptHandle, 0); err != nil {
+		t.Fatal(err)
+	}
+	if again, ok := receive(queue); !ok || again.DequeueCount != 2 {
+		t.Fatalf("received: %t with dequeue count %d, want the message with 2", ok, again.DequeueCount)
+	}
+}
+
+func TestFakeQueueDelay(t *testing.T) {
+	for _, test := range []struct {
+		name         string
+		delaySeconds int64
+		deliverAt    time.Duration
+		visibleAfter time.Duration
+	}{
+		{"NoDelay", 0, 0, 0},
+		{"DelaySeconds", 10, 0, 10 * time.Second},
+		// the delay is rounded up to whole seconds
+		{"DeliverAt", 0, 1500 * time.Millisecond, 2 * time.Second},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			clock, queue := newFakeQueue(t)
+
+			var err error
+			if test.deliverAt > 0 {
+				_, err = queue.SendMessageAt([]byte("delayed"), clock.Now().Add(test.deliverAt))
+			} else {
+				_, err = queue.SendMessage(ali_mns.MessageSendRequest{MessageBody: []byte("delayed"), DelaySeconds: test.delaySeconds})
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.visibleAfter > 0 {
+				if attr := queue.Attributes(); attr.DelayMessages != 1 {
+					t.Fatalf("%d delayed messages, want 1", attr.DelayMessages)
+				}
+
+				clock.Advance(test.visibleAfter - time.Millisecond)
+				if _, ok := receive(queue); ok {
+					t.Fatal("received before its delay passed")
+				}
+				clock.Advance(time.Millisecond)
+			}
+
+			message, ok := receive(queue)
+			if !ok {
+				t.Fatal("not received after its delay")
+			}
+			if message.DequeueCount != 1 {
+				t.Fatalf("dequeue count is %d, want 1", message.DequeueCount)
+			}
+		})
+	}
+}
+
+func TestFakeQueueSendValidation(t *testing.T) {
+	_, queue := newFakeQueue(t)
+
+	for _, message := range []ali_mns.MessageSendRequest{
+		{MessageBody: []byte("bad delay"), DelaySeconds: int64(ali_mns.MaxMessageDelay/time.Second) + 1},
+		{MessageBody: []byte("bad priority"), Priority: ali_mns.MaxMessagePriority + 1},
+	} {
+		if _, err := queue.SendMessage(message); err == nil {
+			t.Fatalf("sent %q", message.MessageBody)
+		}
+	}
+
+	if stats := queue.Stats(); stats.Operations["SendMessage"] != 2 || stats.Errors["SendMessage"] != 2 {
+		t.Fatalf("counted %d sends with %d errors, want 2 and 2", stats.Operations["SendMessage"], stats.Errors["SendMessage"])
+	}
+}
@@ -0,0 +1,269 @@
+package alimnstest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gogap/ali_mns"
+)
+
+type FaultOption func(*FaultTransport)
+
+// WithLatency delays a request by latency with probability.
+func WithLatency(probability float64, latency time.Duration) FaultOption {
+	return func(p *FaultTransport) {
+		p.latencyProbability = probability
+		p.latency = latency
+	}
+}
+
+// WithDroppedConnections fails a request with a connection reset, before it
+// reaches MNS, with probability.
+func WithDroppedConnections(probability float64) FaultOption {
+	return func(p *FaultTransport) {
+		p.dropProbability = probability
+	}
+}
+
+// WithServerErrors answers a request with a 500 InternalError, without
+// sending it, with probability.
+func WithServerErrors(probability float64) FaultOption {
+	return func(p *FaultTransport) {
+		p.serverErrorProbability = probability
+	}
+}
+
+// WithThrottling answers a request with a 503 QpsLimitExceeded and a
+// Retry-After of retryAfter, if positive, without sending it, with
+// probability.
+func WithThrottling(probability float64, retryAfter time.Duration) FaultOption {
+	return func(p *FaultTransport) {
+		p.throttleProbability = probability
+		p.retryAfter = retryAfter
+	}
+}
+
+// WithMalformedResponses truncates the body of a response with probability.
+// The request itself is sent, so e.g. a message is enqueued even though
+// sending it seems to fail.
+func WithMalformedResponses(probability float64) FaultOption {
+	return func(p *FaultTransport) {
+		p.malformedProbability = probability
+	}
+}
+
+// WithFaultSeed makes the injected faults the same on every run.
+func WithFaultSeed(seed int64) FaultOption {
+	return func(p *FaultTransport) {
+		p.rand = rand.New(rand.NewSource(seed))
+	}
+}
+
+// WithFaultClock makes injected latency wait on the timers of clock.
+func WithFaultClock(clock ali_mns.Clock) FaultOption {
+	return func(p *FaultTransport) {
+		if clock != nil {
+			p.clock = clock
+		}
+	}
+}
+
+// FaultStats counts the faults injected so far.
+type FaultStats struct {
+	Requests        int64
+	Delayed         int64
+	Dropped         int64
+	ServerErrors    int64
+	Throttled       int64
+	MalformedBodies int64
+}
+
+// FaultTransport is an http.RoundTripper that injects faults into the
+// requests of a client, below its retries, circuit breaker and decoding,
+// so they see the faults like real ones:
+//
+//	client := ali_mns.NewAliMNSClient(url, id, secret, ali_mns.WithTransport(
+//		alimnstest.NewFaultTransport(http.DefaultTransport, alimnstest.WithServerErrors(0.1))))
+//
+// At most one of dropped connections, server errors and throttling is
+// injected per request, checked in that order; latency and malformed
+// responses may come on top.
+type FaultTransport struct {
+	next http.RoundTripper
+
+	latencyProbability     float64
+	latency                time.Duration
+	dropProbability        float64
+	serverErrorProbability float64
+	throttleProbability    float64
+	retryAfter             time.Duration
+	malformedProbability   float64
+
+	disabled int32
+	stats    FaultStats
+	rand     *rand.Rand
+	clock    ali_mns.Clock
+	locker   sync.Mutex
+}
+
+func NewFaultTransport(next http.RoundTripper, opts ...FaultOption) *FaultTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	transport := &FaultTransport{
+		next:  next,
+		rand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+		clock: ali_mns.SystemClock,
+	}
+
+	for _, opt := range opts {
+		opt(transport)
+	}
+
+	return transport
+}
+
+// NewFaultyClient returns a client of the endpoint at url whose requests go
+// through a FaultTransport over the default transport.
+func NewFaultyClient(url, accessKeyId, accessKeySecret string, faults []FaultOption, opts ...ali_mns.ClientOption) (ali_mns.MNSClient, *FaultTransport) {
+	transport := NewFaultTransport(http.DefaultTransport, faults...)
+	client := ali_mns.NewAliMNSClient(url, accessKeyId, accessKeySecret, append(opts, ali_mns.WithTransport(transport))...)
+	return client, transport
+}
+
+// SetEnabled turns injection on and off, e.g. to let a circuit breaker
+// recover. Transports start enabled.
+func (p *FaultTransport) SetEnabled(enabled bool) {
+	var disabled int32
+	if !enabled {
+		disabled = 1
+	}
+	atomic.StoreInt32(&p.disabled, disabled)
+}
+
+func (p *FaultTransport) Stats() FaultStats {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	return p.stats
+}
+
+// roll reports whether an event of probability happens and counts it in
+// counter if so.
+func (p *FaultTransport) roll(probability float64, counter *int64) bool {
+	if probability <= 0 {
+		return false
+	}
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if p.rand.Float64() >= probability {
+		return false
+	}
+
+	*counter++
+	return true
+}
+
+func (p *FaultTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	p.locker.Lock()
+	p.stats.Requests++
+	p.locker.Unlock()
+
+	if atomic.LoadInt32(&p.disabled) == 1 {
+		return p.next.RoundTrip(req)
+	}
+
+	if p.roll(p.latencyProbability, &p.stats.Delayed) {
+		if err = sleep(req.Context(), p.clock, p.latency); err != nil {
+			return
+		}
+	}
+
+	switch {
+	case p.roll(p.dropProbability, &p.stats.Dropped):
+		closeBody(req)
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	case p.roll(p.serverErrorProbability, &p.stats.ServerErrors):
+		closeBody(req)
+		return faultResponse(req, http.StatusInternalServerError, "InternalError", "Injected internal error.", 0), nil
+	case p.roll(p.throttleProbability, &p.stats.Throttled):
+		closeBody(req)
+		return faultResponse(req, http.StatusServiceUnavailable, "QpsLimitExceeded", "Injected QPS limit exceeded.", p.retryAfter), nil
+	}
+
+	if resp, err = p.next.RoundTrip(req); err != nil {
+		return
+	}
+
+	if p.roll(p.malformedProbability, &p.stats.MalformedBodies) {
+		body, e := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if e != nil {
+			return nil, e
+		}
+
+		body = body[:len(body)/2]
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		resp.ContentLength = int64(len(body))
+		resp.Header.Del("Content-Length")
+	}
+
+	return
+}
+
+func faultResponse(req *http.Request, status int, code, message string, retryAfter time.Duration) *http.Response {
+	body := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+		`<Error xmlns="http://mns.aliyuncs.com/doc/v1"><Code>%s</Code><Message>%s</Message><RequestId>FAULT-INJECTED</RequestId><HostId>%s</HostId></Error>`,
+		code, message, "http://"+req.URL.Host)
+
+	header := http.Header{}
+	header.Set(ali_mns.CONTENT_TYPE, "text/xml;charset=utf-8")
+	header.Set(ali_mns.MNS_REQUEST_ID, "FAULT-INJECTED")
+	if retryAfter > 0 {
+		header.Set(ali_mns.RETRY_AFTER, fmt.Sprintf("%d", int64((retryAfter+time.Second-1)/time.Second)))
+	}
+
+	return &http.Response{
+		StatusCode:    status,
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+func sleep(ctx context.Context, clock ali_mns.Clock, d time.Duration) error {
+	timer := clock.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
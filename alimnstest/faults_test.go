@@ -0,0 +1,243 @@
+package alimnstest_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gogap/ali_mns"
+	"github.com/gogap/ali_mns/alimnstest"
+)
+
+// newFaultyQueue returns the queue "test" of a new server, reached through
+// a FaultTransport injecting faults by a client built with opts. The queue
+// is set up with injection turned off.
+func newFaultyQueue(t *testing.T, faults []alimnstest.FaultOption, opts ...ali_mns.ClientOption) (*alimnstest.Server, *alimnstest.FaultTransport, ali_mns.AliMNSQueue) {
+	server := alimnstest.NewServer()
+	t.Cleanup(server.Close)
+
+	client, transport := alimnstest.NewFaultyClient(server.URL, "test-id", "test-secret", faults, opts...)
+	transport.SetEnabled(false)
+
+	if err := ali_mns.NewMNSQueueManagerWithClient(client).CreateQueue(server.URL, "test", 0, 65536, 345600, 30, 0); err != nil {
+		t.Fatal(err)
+	}
+	queue, err := ali_mns.NewMNSQueueWithOptions("test", client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transport.SetEnabled(true)
+
+	return server, transport, queue
+}
+
+func TestFaultTransport(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		faults    []alimnstest.FaultOption
+		wantErr   func(err error) bool
+		wantStats alimnstest.FaultStats
+		enqueued  int64
+	}{
+		{
+			"NoFaults", nil,
+			func(err error) bool { return err == nil },
+			alimnstest.FaultStats{Requests: 1}, 1,
+		},
+		{
+			"DroppedConnection", []alimnstest.FaultOption{alimnstest.WithDroppedConnections(1)},
+			func(err error) bool { return errors.Is(err, ali_mns.ErrSendRequestFailed) },
+			alimnstest.FaultStats{Requests: 1, Dropped: 1}, 0,
+		},
+		{
+			"ServerError", []alimnstest.FaultOption{alimnstest.WithServerErrors(1)},
+			ali_mns.ERR_MNS_INTERNAL_ERROR.IsEqual,
+			alimnstest.FaultStats{Requests: 1, ServerErrors: 1}, 0,
+		},
+		{
+			"Throttling", []alimnstest.FaultOption{alimnstest.WithThrottling(1, 1500*time.Millisecond)},
+			func(err error) bool {
+				mnsErr := &ali_mns.MNSError{}
+				// Retry-After is rounded up to whole seconds
+				return ali_mns.ERR_MNS_QPS_LIMIT_EXCEEDED.IsEqual(err) && errors.As(err, &mnsErr) && mnsErr.RetryAfter() == 2*time.Second
+			},
+			alimnstest.FaultStats{Requests: 1, Throttled: 1}, 0,
+		},
+		{
+			// the message is sent, only its response is lost
+			"MalformedResponse", []alimnstest.FaultOption{alimnstest.WithMalformedResponses(1)},
+			func(err error) bool { return err != nil },
+			alimnstest.FaultStats{Requests: 1, MalformedBodies: 1}, 1,
+		},
+		{
+			"DropComesFirst", []alimnstest.FaultOption{alimnstest.WithServerErrors(1), alimnstest.WithDroppedConnections(1)},
+			func(err error) bool { return errors.Is(err, ali_mns.ErrSendRequestFailed) },
+			alimnstest.FaultStats{Requests: 1, Dropped: 1}, 0,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server, transport, queue := newFaultyQueue(t, test.faults)
+			setup := transport.Stats().Requests
+
+			_, err := queue.SendMessage(ali_mns.MessageSendRequest{MessageBody: []byte("faulty")})
+			if !test.wantErr(err) {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			stats := transport.Stats()
+			stats.Requests -= setup
+			if stats != test.wantStats {
+				t.Fatalf("injected %+v, want %+v", stats, test.wantStats)
+			}
+
+			if active := server.Queue("test").Attributes().ActiveMessages; active != test.enqueued {
+				t.Fatalf("%d messages enqueued, want %d", active, test.enqueued)
+			}
+		})
+	}
+}
+
+func TestFaultTransportLatency(t *testing.T) {
+	clock := alimnstest.NewFakeClock(time.Time{})
+	_, transport, queue := newFaultyQueue(t, []alimnstest.FaultOption{alimnstest.WithLatency(1, time.Minute), alimnstest.WithFaultClock(clock)})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := queue.SendMessage(ali_mns.MessageSendRequest{MessageBody: []byte("delayed")})
+		done <- err
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for clock.Waiters() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("request not delayed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	clock.Advance(time.Minute - time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("request sent before its latency passed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	clock.Advance(time.Millisecond)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request not sent after its latency")
+	}
+
+	if delayed := transport.Stats().Delayed; delayed != 1 {
+		t.Fatalf("%d requests delayed, want 1", delayed)
+	}
+}
+
+func TestFaultTransportDisabled(t *testing.T) {
+	_, transport, queue := newFaultyQueue(t, []alimnstest.FaultOption{alimnstest.WithServerErrors(1)})
+
+	transport.SetEnabled(false)
+	if _, err := queue.SendMessage(ali_mns.MessageSendRequest{MessageBody: []byte("healthy")}); err != nil {
+		t.Fatalf("send failed with injection off: %v", err)
+	}
+
+	transport.SetEnabled(true)
+	if _, err := queue.SendMessage(ali_mns.MessageSendRequest{MessageBody: []byte("faulty")}); err == nil {
+		t.Fatal("send succeeded with injection on")
+	}
+}
+
+func TestFaultTransportSeed(t *testing.T) {
+	pattern := func() (failed []bool) {
+		_, _, queue := newFaultyQueue(t, []alimnstest.FaultOption{alimnstest.WithServerErrors(0.5), alimnstest.WithFaultSeed(42)})
+		for i := 0; i < 20; i++ {
+			_, err := queue.SendMessage(ali_mns.MessageSendRequest{MessageBody: []byte("seeded")})
+			failed = append(failed, err != nil)
+		}
+		return
+	}
+
+	first, second := pattern(), pattern()
+	if !reflect.DeepEqual(first, second) {
+		t.Fatalf("faults of the same seed differ: %v and %v", first, second)
+	}
+
+	failures := 0
+	for _, failed := range first {
+		if failed {
+			failures++
+		}
+	}
+	if failures == 0 || failures == len(first) {
+		t.Fatalf("%d of %d sends failed at a probability of 0.5", failures, len(first))
+	}
+}
+
+func TestFaultsRetried(t *testing.T) {
+	server, transport, queue := newFaultyQueue(t,
+		[]alimnstest.FaultOption{alimnstest.WithThrottling(0.5, 0), alimnstest.WithFaultSeed(42)},
+		ali_mns.WithRetry(10, time.Millisecond, time.Millisecond))
+
+	const sends = 20
+	for i := 0; i < sends; i++ {
+		if _, err := queue.SendMessage(ali_mns.MessageSendRequest{MessageBody: []byte("retried")}); err != nil {
+			t.Fatalf("send %d failed despite retries: %v", i, err)
+		}
+	}
+
+	if throttled := transport.Stats().Throttled; throttled == 0 {
+		t.Fatal("no send throttled")
+	}
+	// throttled requests never reach the queue, so retries add no copies
+	if active := server.Queue("test").Attributes().ActiveMessages; active != sends {
+		t.Fatalf("%d messages enqueued, want %d", active, sends)
+	}
+}
+
+func TestFaultsOpenCircuitBreaker(t *testing.T) {
+	server := alimnstest.NewServer()
+	t.Cleanup(server.Close)
+
+	clock := alimnstest.NewFakeClock(time.Time{})
+	client, transport := alimnstest.NewFaultyClient(server.URL, "test-id", "test-secret",
+		[]alimnstest.FaultOption{alimnstest.WithServerErrors(1)},
+		ali_mns.WithCircuitBreaker(2, time.Minute), ali_mns.WithClock(clock))
+
+	list := func() error {
+		resp, err := client.Send(ali_mns.GET, nil, nil, "queues")
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := list(); err != nil {
+			t.Fatalf("request %d failed to send: %v", i, err)
+		}
+	}
+
+	requests := transport.Stats().Requests
+	if err := list(); !ali_mns.ERR_CIRCUIT_BREAKER_OPEN.IsEqual(err) {
+		t.Fatalf("got %v with the circuit open", err)
+	}
+	if transport.Stats().Requests != requests {
+		t.Fatal("request sent with the circuit open")
+	}
+
+	// the endpoint recovers during the cool-down
+	transport.SetEnabled(false)
+	clock.Advance(time.Minute)
+
+	for i := 0; i < 2; i++ {
+		if err := list(); err != nil {
+			t.Fatalf("request %d after the cool-down failed: %v", i, err)
+		}
+	}
+}
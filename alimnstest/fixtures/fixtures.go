@@ -0,0 +1,412 @@
+// Package fixtures holds MNS response bodies as the service sends them,
+// with the values ali_mns should decode them to, so decoders and the types
+// they decode into can be checked against the wire format:
+//
+//	if errs := fixtures.Check(ali_mns.NewAliMNSDecoder()); len(errs) > 0 {
+//		t.Fatal(errs)
+//	}
+package fixtures
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/gogap/ali_mns"
+)
+
+// Fixture is a response body of MNS and what it decodes to.
+type Fixture struct {
+	Name string
+	Body string
+
+	// New returns a pointer to the zero value Body is decoded into.
+	New func() interface{}
+
+	// Want is the decoded value. It is compared by its JSON encoding, which
+	// leaves out XMLName and Meta.
+	Want interface{}
+}
+
+// Check decodes the body of the fixture with decoder, then with a strict
+// decoder to catch elements the type does not know, and compares both
+// results with Want.
+func (p Fixture) Check(decoder ali_mns.MNSDecoder) (err error) {
+	if err = p.check(decoder); err != nil {
+		return
+	}
+
+	return p.check(ali_mns.NewAliMNSDecoder(ali_mns.WithStrictDecoding()))
+}
+
+func (p Fixture) check(decoder ali_mns.MNSDecoder) (err error) {
+	v := p.New()
+	if err = decoder.Decode(bytes.NewReader([]byte(p.Body)), v); err != nil {
+		return fmt.Errorf("fixtures: %s: decode failed: %s", p.Name, err)
+	}
+
+	var got, want []byte
+	if got, err = json.Marshal(reflect.ValueOf(v).Elem().Interface()); err != nil {
+		return
+	}
+	if want, err = json.Marshal(p.Want); err != nil {
+		return
+	}
+
+	if !bytes.Equal(got, want) {
+		return fmt.Errorf("fixtures: %s: decoded %s, want %s", p.Name, got, want)
+	}
+
+	return nil
+}
+
+// Check checks every fixture in All with decoder and returns the errors.
+func Check(decoder ali_mns.MNSDecoder) (errs []error) {
+	for _, fixture := range All {
+		if err := fixture.Check(decoder); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return
+}
+
+// All lists the fixtures of every kind of response.
+var All = []Fixture{
+	SendMessage,
+	BatchSendMessage,
+	BatchSendMessagePartialFailure,
+	ReceiveMessage,
+	BatchReceiveMessage,
+	PeekMessage,
+	ChangeMessageVisibility,
+	GetQueueAttributes,
+	ListQueue,
+	ListQueueWithMeta,
+	GetAccountAttributes,
+	QueueNotExistError,
+	MessageNotExistError,
+}
+
+var SendMessage = Fixture{
+	Name: "SendMessage",
+	Body: `<?xml version="1.0" encoding="UTF-8"?>
+<Message xmlns="http://mns.aliyuncs.com/doc/v1/">
+  <MessageId>5F290C926D472878-2-14D9529A8FA-200000001</MessageId>
+  <MessageBodyMD5>EBBEC0919BC91E033E46295ED9BAE435</MessageBodyMD5>
+</Message>`,
+	New: func() interface{} { return &ali_mns.MessageSendResponse{} },
+	Want: ali_mns.MessageSendResponse{
+		MessageId:      "5F290C926D472878-2-14D9529A8FA-200000001",
+		MessageBodyMD5: "EBBEC0919BC91E033E46295ED9BAE435",
+	},
+}
+
+var BatchSendMessage = Fixture{
+	Name: "BatchSendMessage",
+	Body: `<?xml version="1.0" encoding="UTF-8"?>
+<Messages xmlns="http://mns.aliyuncs.com/doc/v1/">
+  <Message>
+    <MessageId>5F290C926D472878-2-14D9529A8FA-200000002</MessageId>
+    <MessageBodyMD5>D0462D97490C7C9663ACDE0B092FC9E8</MessageBodyMD5>
+  </Message>
+  <Message>
+    <MessageId>5F290C926D472878-2-14D9529A8FA-200000003</MessageId>
+    <MessageBodyMD5>BDC9C2BC072E83307018ED18FB215C99</MessageBodyMD5>
+  </Message>
+</Messages>`,
+	New: func() interface{} { return &ali_mns.BatchMessageSendResponse{} },
+	Want: ali_mns.BatchMessageSendResponse{
+		Messages: []ali_mns.MessageSendResponse{
+			{MessageId: "5F290C926D472878-2-14D9529A8FA-200000002", MessageBodyMD5: "D0462D97490C7C9663ACDE0B092FC9E8"},
+			{MessageId: "5F290C926D472878-2-14D9529A8FA-200000003", MessageBodyMD5: "BDC9C2BC072E83307018ED18FB215C99"},
+		},
+	},
+}
+
+// BatchSendMessagePartialFailure is sent with status 500 when some messages
+// of a batch could not be sent. Failed entries take the place of their
+// messages, with ErrorCode and ErrorMessage.
+var BatchSendMessagePartialFailure = Fixture{
+	Name: "BatchSendMessagePartialFailure",
+	Body: `<?xml version="1.0" encoding="UTF-8"?>
+<Messages xmlns="http://mns.aliyuncs.com/doc/v1/">
+  <Message>
+    <MessageId>5F290C926D472878-2-14D9529A8FA-200000004</MessageId>
+    <MessageBodyMD5>D0462D97490C7C9663ACDE0B092FC9E8</MessageBodyMD5>
+  </Message>
+  <Message>
+    <ErrorCode>InvalidArgument</ErrorCode>
+    <ErrorMessage>The value of message body should be between 1 and 65536 bytes.</ErrorMessage>
+  </Message>
+</Messages>`,
+	New: func() interface{} { return &ali_mns.BatchMessageSendResponse{} },
+	Want: ali_mns.BatchMessageSendResponse{
+		Messages: []ali_mns.MessageSendResponse{
+			{MessageId: "5F290C926D472878-2-14D9529A8FA-200000004", MessageBodyMD5: "D0462D97490C7C9663ACDE0B092FC9E8"},
+			{MessageResponse: ali_mns.MessageResponse{Code: "InvalidArgument", Message: "The value of message body should be between 1 and 65536 bytes."}},
+		},
+	},
+}
+
+var ReceiveMessage = Fixture{
+	Name: "ReceiveMessage",
+	Body: `<?xml version="1.0" encoding="UTF-8"?>
+<Message xmlns="http://mns.aliyuncs.com/doc/v1/">
+  <MessageId>5F290C926D472878-2-14D9529A8FA-200000001</MessageId>
+  <ReceiptHandle>1-ODU4OTkzNDU5My0xNDMyNzI3ODI3LTItOA==</ReceiptHandle>
+  <MessageBodyMD5>EBBEC0919BC91E033E46295ED9BAE435</MessageBodyMD5>
+  <MessageBody>aGVsbG8gbW5z</MessageBody>
+  <EnqueueTime>1250700979248</EnqueueTime>
+  <NextVisibleTime>1250700799348</NextVisibleTime>
+  <FirstDequeueTime>1250700779318</FirstDequeueTime>
+  <DequeueCount>1</DequeueCount>
+  <Priority>8</Priority>
+</Message>`,
+	New: func() interface{} { return &ali_mns.MessageReceiveResponse{} },
+	Want: ali_mns.MessageReceiveResponse{
+		MessageId:        "5F290C926D472878-2-14D9529A8FA-200000001",
+		ReceiptHandle:    "1-ODU4OTkzNDU5My0xNDMyNzI3ODI3LTItOA==",
+		MessageBodyMD5:   "EBBEC0919BC91E033E46295ED9BAE435",
+		MessageBody:      ali_mns.Base64Bytes("hello mns"),
+		EnqueueTime:      1250700979248,
+		NextVisibleTime:  1250700799348,
+		FirstDequeueTime: 1250700779318,
+		DequeueCount:     1,
+		Priority:         8,
+	},
+}
+
+var BatchReceiveMessage = Fixture{
+	Name: "BatchReceiveMessage",
+	Body: `<?xml version="1.0" encoding="UTF-8"?>
+<Messages xmlns="http://mns.aliyuncs.com/doc/v1/">
+  <Message>
+    <MessageId>5F290C926D472878-2-14D9529A8FA-200000002</MessageId>
+    <ReceiptHandle>1-ODU4OTkzNDU5My0xNDMyNzI3ODI3LTItOQ==</ReceiptHandle>
+    <MessageBodyMD5>D0462D97490C7C9663ACDE0B092FC9E8</MessageBodyMD5>
+    <MessageBody>b3JkZXIgMTA0MiBzaGlwcGVk</MessageBody>
+    <EnqueueTime>1250700979249</EnqueueTime>
+    <NextVisibleTime>1250700799349</NextVisibleTime>
+    <FirstDequeueTime>1250700779319</FirstDequeueTime>
+    <DequeueCount>1</DequeueCount>
+    <Priority>8</Priority>
+  </Message>
+  <Message>
+    <MessageId>5F290C926D472878-2-14D9529A8FA-200000003</MessageId>
+    <ReceiptHandle>1-ODU4OTkzNDU5My0xNDMyNzI3ODI3LTItMTA=</ReceiptHandle>
+    <MessageBodyMD5>BDC9C2BC072E83307018ED18FB215C99</MessageBodyMD5>
+    <MessageBody>b3JkZXIgMTA0MyBzaGlwcGVk</MessageBody>
+    <EnqueueTime>1250700979250</EnqueueTime>
+    <NextVisibleTime>1250700799350</NextVisibleTime>
+    <FirstDequeueTime>1250700779320</FirstDequeueTime>
+    <DequeueCount>2</DequeueCount>
+    <Priority>1</Priority>
+  </Message>
+</Messages>`,
+	New: func() interface{} { return &ali_mns.BatchMessageReceiveResponse{} },
+	Want: ali_mns.BatchMessageReceiveResponse{
+		Messages: []ali_mns.MessageReceiveResponse{
+			{
+				MessageId:        "5F290C926D472878-2-14D9529A8FA-200000002",
+				ReceiptHandle:    "1-ODU4OTkzNDU5My0xNDMyNzI3ODI3LTItOQ==",
+				MessageBodyMD5:   "D0462D97490C7C9663ACDE0B092FC9E8",
+				MessageBody:      ali_mns.Base64Bytes("order 1042 shipped"),
+				EnqueueTime:      1250700979249,
+				NextVisibleTime:  1250700799349,
+				FirstDequeueTime: 1250700779319,
+				DequeueCount:     1,
+				Priority:         8,
+			},
+			{
+				MessageId:        "5F290C926D472878-2-14D9529A8FA-200000003",
+				ReceiptHandle:    "1-ODU4OTkzNDU5My0xNDMyNzI3ODI3LTItMTA=",
+				MessageBodyMD5:   "BDC9C2BC072E83307018ED18FB215C99",
+				MessageBody:      ali_mns.Base64Bytes("order 1043 shipped"),
+				EnqueueTime:      1250700979250,
+				NextVisibleTime:  1250700799350,
+				FirstDequeueTime: 1250700779320,
+				DequeueCount:     2,
+				Priority:         1,
+			},
+		},
+	},
+}
+
+// PeekMessage has neither ReceiptHandle nor NextVisibleTime, peeking leaves
+// the message visible.
+var PeekMessage = Fixture{
+	Name: "PeekMessage",
+	Body: `<?xml version="1.0" encoding="UTF-8"?>
+<Message xmlns="http://mns.aliyuncs.com/doc/v1/">
+  <MessageId>5F290C926D472878-2-14D9529A8FA-200000001</MessageId>
+  <MessageBodyMD5>EBBEC0919BC91E033E46295ED9BAE435</MessageBodyMD5>
+  <MessageBody>aGVsbG8gbW5z</MessageBody>
+  <EnqueueTime>1250700979248</EnqueueTime>
+  <FirstDequeueTime>1250700979248</FirstDequeueTime>
+  <DequeueCount>0</DequeueCount>
+  <Priority>8</Priority>
+</Message>`,
+	New: func() interface{} { return &ali_mns.MessageReceiveResponse{} },
+	Want: ali_mns.MessageReceiveResponse{
+		MessageId:        "5F290C926D472878-2-14D9529A8FA-200000001",
+		MessageBodyMD5:   "EBBEC0919BC91E033E46295ED9BAE435",
+		MessageBody:      ali_mns.Base64Bytes("hello mns"),
+		EnqueueTime:      1250700979248,
+		FirstDequeueTime: 1250700979248,
+		Priority:         8,
+	},
+}
+
+var ChangeMessageVisibility = Fixture{
+	Name: "ChangeMessageVisibility",
+	Body: `<?xml version="1.0" encoding="UTF-8"?>
+<ChangeVisibility xmlns="http://mns.aliyuncs.com/doc/v1/">
+  <ReceiptHandle>1-ODU4OTkzNDU5My0xNDMyNzI3ODI3LTItMTE=</ReceiptHandle>
+  <NextVisibleTime>1250700979298</NextVisibleTime>
+</ChangeVisibility>`,
+	New: func() interface{} { return &ali_mns.MessageVisibilityChangeResponse{} },
+	Want: ali_mns.MessageVisibilityChangeResponse{
+		ReceiptHandle:   "1-ODU4OTkzNDU5My0xNDMyNzI3ODI3LTItMTE=",
+		NextVisibleTime: 1250700979298,
+	},
+}
+
+var GetQueueAttributes = Fixture{
+	Name: "GetQueueAttributes",
+	Body: `<?xml version="1.0" encoding="UTF-8"?>
+<Queue xmlns="http://mns.aliyuncs.com/doc/v1/">
+  <QueueName>orders</QueueName>
+  <CreateTime>1250700999</CreateTime>
+  <LastModifyTime>1250700999</LastModifyTime>
+  <VisibilityTimeout>60</VisibilityTimeout>
+  <MaximumMessageSize>65536</MaximumMessageSize>
+  <MessageRetentionPeriod>345600</MessageRetentionPeriod>
+  <DelaySeconds>10</DelaySeconds>
+  <PollingWaitSeconds>20</PollingWaitSeconds>
+  <ActiveMessages>20</ActiveMessages>
+  <InactiveMessages>3</InactiveMessages>
+  <DelayMessages>1</DelayMessages>
+  <LoggingEnabled>True</LoggingEnabled>
+</Queue>`,
+	New: func() interface{} { return &ali_mns.QueueAttribute{} },
+	Want: ali_mns.QueueAttribute{
+		QueueName:              "orders",
+		DelaySeconds:           10,
+		MaxMessageSize:         65536,
+		MessageRetentionPeriod: 345600,
+		VisibilityTimeout:      60,
+		PollingWaitSeconds:     20,
+		LoggingEnabled:         true,
+		ActiveMessages:         20,
+		InactiveMessages:       3,
+		DelayMessages:          1,
+		CreateTime:             1250700999,
+		LastModifyTime:         1250700999,
+	},
+}
+
+var ListQueue = Fixture{
+	Name: "ListQueue",
+	Body: `<?xml version="1.0" encoding="UTF-8"?>
+<Queues xmlns="http://mns.aliyuncs.com/doc/v1/">
+  <Queue>
+    <QueueURL>http://1234567890.mns.cn-hangzhou.aliyuncs.com/queues/orders</QueueURL>
+  </Queue>
+  <Queue>
+    <QueueURL>http://1234567890.mns.cn-hangzhou.aliyuncs.com/queues/orders-dlq</QueueURL>
+  </Queue>
+  <NextMarker>orders-dlq</NextMarker>
+</Queues>`,
+	New: func() interface{} { return &ali_mns.Queues{} },
+	Want: ali_mns.Queues{
+		Queues: []ali_mns.Queue{
+			{QueueURL: "http://1234567890.mns.cn-hangzhou.aliyuncs.com/queues/orders"},
+			{QueueURL: "http://1234567890.mns.cn-hangzhou.aliyuncs.com/queues/orders-dlq"},
+		},
+		NextMarker: "orders-dlq",
+	},
+}
+
+var ListQueueWithMeta = Fixture{
+	Name: "ListQueueWithMeta",
+	Body: `<?xml version="1.0" encoding="UTF-8"?>
+<Queues xmlns="http://mns.aliyuncs.com/doc/v1/">
+  <Queue>
+    <QueueName>orders</QueueName>
+    <CreateTime>1250700999</CreateTime>
+    <LastModifyTime>1250700999</LastModifyTime>
+    <VisibilityTimeout>30</VisibilityTimeout>
+    <MaximumMessageSize>65536</MaximumMessageSize>
+    <MessageRetentionPeriod>345600</MessageRetentionPeriod>
+    <DelaySeconds>0</DelaySeconds>
+    <PollingWaitSeconds>0</PollingWaitSeconds>
+    <ActiveMessages>5</ActiveMessages>
+    <InactiveMessages>0</InactiveMessages>
+    <DelayMessages>0</DelayMessages>
+    <LoggingEnabled>False</LoggingEnabled>
+  </Queue>
+</Queues>`,
+	New: func() interface{} { return &ali_mns.QueuesWithMeta{} },
+	Want: ali_mns.QueuesWithMeta{
+		Queues: []ali_mns.QueueAttribute{
+			{
+				QueueName:              "orders",
+				MaxMessageSize:         65536,
+				MessageRetentionPeriod: 345600,
+				VisibilityTimeout:      30,
+				ActiveMessages:         5,
+				CreateTime:             1250700999,
+				LastModifyTime:         1250700999,
+			},
+		},
+	},
+}
+
+var GetAccountAttributes = Fixture{
+	Name: "GetAccountAttributes",
+	Body: `<?xml version="1.0" encoding="UTF-8"?>
+<Account xmlns="http://mns.aliyuncs.com/doc/v1/">
+  <LoggingBucket>mns-logs</LoggingBucket>
+</Account>`,
+	New:  func() interface{} { return &ali_mns.AccountAttribute{} },
+	Want: ali_mns.AccountAttribute{LoggingBucket: "mns-logs"},
+}
+
+var QueueNotExistError = Fixture{
+	Name: "QueueNotExistError",
+	Body: `<?xml version="1.0" encoding="UTF-8"?>
+<Error xmlns="http://mns.aliyuncs.com/doc/v1/">
+  <Code>QueueNotExist</Code>
+  <Message>The queue name you provided is not exist.</Message>
+  <RequestId>5E8C6B9C8E6F3A2B1C4D5E6F</RequestId>
+  <HostId>http://1234567890.mns.cn-hangzhou.aliyuncs.com</HostId>
+</Error>`,
+	New: func() interface{} { return &ali_mns.ErrorMessageResponse{} },
+	Want: ali_mns.ErrorMessageResponse{
+		Code:      "QueueNotExist",
+		Message:   "The queue name you provided is not exist.",
+		RequestId: "5E8C6B9C8E6F3A2B1C4D5E6F",
+		HostId:    "http://1234567890.mns.cn-hangzhou.aliyuncs.com",
+	},
+}
+
+// MessageNotExistError is what receives get from an empty queue once their
+// wait is over.
+var MessageNotExistError = Fixture{
+	Name: "MessageNotExistError",
+	Body: `<?xml version="1.0" encoding="UTF-8"?>
+<Error xmlns="http://mns.aliyuncs.com/doc/v1/">
+  <Code>MessageNotExist</Code>
+  <Message>Message not exist.</Message>
+  <RequestId>5E8C6B9C8E6F3A2B1C4D5E70</RequestId>
+  <HostId>http://1234567890.mns.cn-hangzhou.aliyuncs.com</HostId>
+</Error>`,
+	New: func() interface{} { return &ali_mns.ErrorMessageResponse{} },
+	Want: ali_mns.ErrorMessageResponse{
+		Code:      "MessageNotExist",
+		Message:   "Message not exist.",
+		RequestId: "5E8C6B9C8E6F3A2B1C4D5E70",
+		HostId:    "http://1234567890.mns.cn-hangzhou.aliyuncs.com",
+	},
+}
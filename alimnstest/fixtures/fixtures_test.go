@@ -0,0 +1,18 @@
+package fixtures
+
+import (
+	"testing"
+
+	"github.com/gogap/ali_mns"
+)
+
+func TestFixtures(t *testing.T) {
+	for _, fixture := range All {
+		fixture := fixture
+		t.Run(fixture.Name, func(t *testing.T) {
+			if err := fixture.Check(ali_mns.NewAliMNSDecoder()); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
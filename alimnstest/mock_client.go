@@ -0,0 +1,365 @@
+package alimnstest
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogap/ali_mns"
+)
+
+// Call is a request made through a MockClient. Body is the message encoded
+// as the real client would send it, nil if there was none.
+type Call struct {
+	Method   ali_mns.Method
+	Resource string
+	Headers  map[string]string
+	Message  interface{}
+	Body     []byte
+}
+
+// Path returns Resource without its query.
+func (p Call) Path() string {
+	if i := strings.Index(p.Resource, "?"); i >= 0 {
+		return p.Resource[:i]
+	}
+	return p.Resource
+}
+
+// MockResponse is a scripted response. If Err is set it is returned as a
+// transport failure and the other fields are ignored.
+type MockResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Err        error
+}
+
+// XMLResponse scripts a response of status with v encoded as its body.
+func XMLResponse(status int, v interface{}) MockResponse {
+	body, err := xml.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+
+	return MockResponse{StatusCode: status, Body: append([]byte(xml.Header), body...)}
+}
+
+// ErrorResponse scripts an MNS error response, e.g.
+// ErrorResponse(http.StatusNotFound, "QueueNotExist", "The queue name you provided is not exist.").
+func ErrorResponse(status int, code, message string) MockResponse {
+	return XMLResponse(status, ali_mns.ErrorMessageResponse{
+		Code:      code,
+		Message:   message,
+		RequestId: "MOCK-REQUEST-ID",
+		HostId:    "http://mock.mns",
+	})
+}
+
+type script struct {
+	method    ali_mns.Method
+	resource  string
+	responses []MockResponse
+}
+
+func (p *script) matches(method ali_mns.Method, call Call) bool {
+	if p.method != "" && p.method != method {
+		return false
+	}
+
+	if strings.Contains(p.resource, "?") {
+		return p.resource == call.Resource
+	}
+	return p.resource == "" || p.resource == call.Path()
+}
+
+// next returns the next response, repeating the last one once the others
+// are used up.
+func (p *script) next() MockResponse {
+	resp := p.responses[0]
+	if len(p.responses) > 1 {
+		p.responses = p.responses[1:]
+	}
+	return resp
+}
+
+// MockClient is an ali_mns.MNSClient that records every call and answers
+// with scripted responses instead of sending requests:
+//
+//	client := alimnstest.NewMockClient()
+//	client.Respond(ali_mns.GET, "queues/test", alimnstest.XMLResponse(200, ali_mns.QueueAttribute{}))
+//	client.Respond(ali_mns.POST, "queues/test/messages", alimnstest.XMLResponse(201, ali_mns.MessageSendResponse{MessageId: "1"}))
+//	queue := ali_mns.NewMNSQueue("test", client)
+//
+// Scripts match on method and resource path, or on the whole resource if it
+// has a query; later scripts win over earlier ones. Calls without a
+// matching script fail with ErrNotScripted. Middlewares added with Use wrap
+// every call like they do on a real client.
+type MockClient struct {
+	scripts     []*script
+	calls       []Call
+	middlewares []ali_mns.Middleware
+	proxy       string
+	errorStats  ali_mns.ErrorStats
+	encoder     ali_mns.MNSEncoder
+	clock       ali_mns.Clock
+	locker      sync.Mutex
+}
+
+var _ ali_mns.MNSClient = (*MockClient)(nil)
+var _ ali_mns.ErrorStatsReporter = (*MockClient)(nil)
+
+var ErrNotScripted = errors.New("alimnstest: no response scripted for the call")
+
+type MockClientOption func(*MockClient)
+
+// WithMockClock makes Ping measure latency by clock.
+func WithMockClock(clock ali_mns.Clock) MockClientOption {
+	return func(p *MockClient) {
+		if clock != nil {
+			p.clock = clock
+		}
+	}
+}
+
+func NewMockClient(opts ...MockClientOption) *MockClient {
+	client := &MockClient{
+		encoder: ali_mns.NewAliMNSEncoder(),
+		clock:   ali_mns.SystemClock,
+	}
+
+	for _, opt := range opts {
+		opt(client)
+	}
+
+	client.ResetErrorStats()
+	return client
+}
+
+// Respond scripts the responses to calls of method, any method if empty,
+// on resource, any resource if empty, returned in order.
+func (p *MockClient) Respond(method ali_mns.Method, resource string, responses ...MockResponse) {
+	if len(responses) == 0 {
+		panic("alimnstest: no responses to script")
+	}
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.scripts = append(p.scripts, &script{method: method, resource: resource, responses: responses})
+}
+
+// Calls returns the calls made so far, oldest first.
+func (p *MockClient) Calls() []Call {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	return append([]Call(nil), p.calls...)
+}
+
+// LastCall returns the latest call, false if there was none.
+func (p *MockClient) LastCall() (call Call, ok bool) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if len(p.calls) == 0 {
+		return
+	}
+	return p.calls[len(p.calls)-1], true
+}
+
+// Reset forgets the recorded calls and the scripts.
+func (p *MockClient) Reset() {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.scripts = nil
+	p.calls = nil
+}
+
+func (p *MockClient) Send(method ali_mns.Method, headers map[string]string, message interface{}, resource string) (resp *http.Response, err error) {
+	return p.SendContext(context.Background(), method, headers, message, resource)
+}
+
+func (p *MockClient) SendContext(ctx context.Context, method ali_mns.Method, headers map[string]string, message interface{}, resource string) (resp *http.Response, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	p.locker.Lock()
+	middlewares := append([]ali_mns.Middleware(nil), p.middlewares...)
+	p.locker.Unlock()
+
+	var sender ali_mns.Sender = ali_mns.SenderFunc(p.send)
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		sender = middlewares[i](sender)
+	}
+
+	return ali_mns.SendWithContext(ctx, sender, method, headers, message, resource)
+}
+
+func (p *MockClient) send(method ali_mns.Method, headers map[string]string, message interface{}, resource string) (resp *http.Response, err error) {
+	call := Call{
+		Method:   method,
+		Resource: resource,
+		Headers:  make(map[string]string, len(headers)),
+		Message:  message,
+	}
+
+	for k, v := range headers {
+		call.Headers[k] = v
+	}
+
+	switch body := message.(type) {
+	case nil:
+	case []byte:
+		call.Body = append([]byte(nil), body...)
+	default:
+		buf := bytes.Buffer{}
+		if err = p.encoder.Encode(&buf, message); err != nil {
+			return
+		}
+		call.Body = buf.Bytes()
+	}
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.calls = append(p.calls, call)
+
+	var scripted *MockResponse
+	for i := len(p.scripts) - 1; i >= 0; i-- {
+		if p.scripts[i].matches(method, call) {
+			next := p.scripts[i].next()
+			scripted = &next
+			break
+		}
+	}
+
+	if scripted == nil {
+		err = ErrNotScripted
+		return
+	}
+
+	if scripted.Err != nil {
+		err = scripted.Err
+		p.errorStats.Statuses[0]++
+		return
+	}
+
+	header := http.Header{}
+	for k, v := range scripted.Header {
+		header[k] = append([]string(nil), v...)
+	}
+
+	resp = &http.Response{
+		StatusCode: scripted.StatusCode,
+		Status:     fmt.Sprintf("%d %s", scripted.StatusCode, http.StatusText(scripted.StatusCode)),
+		Header:     header,
+		Body:       ioutil.NopCloser(bytes.NewReader(scripted.Body)),
+	}
+
+	if scripted.StatusCode >= 300 {
+		p.errorStats.Statuses[scripted.StatusCode]++
+
+		errResp := ali_mns.ErrorMessageResponse{}
+		if xml.Unmarshal(scripted.Body, &errResp) == nil && errResp.Code != "" {
+			p.errorStats.Codes[errResp.Code]++
+		}
+	}
+
+	return
+}
+
+func (p *MockClient) SetProxy(url string) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.proxy = url
+}
+
+// Proxy returns the url last passed to SetProxy.
+func (p *MockClient) Proxy() string {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	return p.proxy
+}
+
+func (p *MockClient) Use(middlewares ...ali_mns.Middleware) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.middlewares = append(p.middlewares, middlewares...)
+}
+
+// Ping sends GET queues like the real client does.
+func (p *MockClient) Ping() (latency time.Duration, err error) {
+	start := p.clock.Now()
+	_, _, _, err = p.DoRaw(ali_mns.GET, "queues", map[string]string{"x-mns-ret-number": "1"}, nil)
+	latency = p.clock.Now().Sub(start)
+
+	return
+}
+
+func (p *MockClient) DoRaw(method ali_mns.Method, resource string, headers map[string]string, body []byte) (statusCode int, header http.Header, rawBody []byte, err error) {
+	if body == nil {
+		body = []byte{}
+	}
+
+	var resp *http.Response
+	if resp, err = p.Send(method, headers, body, resource); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	statusCode = resp.StatusCode
+	header = resp.Header
+
+	if rawBody, err = ioutil.ReadAll(resp.Body); err != nil {
+		return
+	}
+
+	if statusCode >= 300 {
+		errResp := ali_mns.ErrorMessageResponse{}
+		xml.Unmarshal(rawBody, &errResp)
+		err = ali_mns.ParseError(errResp, resource)
+	}
+
+	return
+}
+
+// ErrorStats counts the scripted failures returned so far.
+func (p *MockClient) ErrorStats() (stats ali_mns.ErrorStats) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	stats.Codes = make(map[string]int64, len(p.errorStats.Codes))
+	for code, count := range p.errorStats.Codes {
+		stats.Codes[code] = count
+	}
+
+	stats.Statuses = make(map[int]int64, len(p.errorStats.Statuses))
+	for status, count := range p.errorStats.Statuses {
+		stats.Statuses[status] = count
+	}
+
+	return
+}
+
+func (p *MockClient) ResetErrorStats() {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.errorStats = ali_mns.ErrorStats{
+		Codes:    make(map[string]int64),
+		Statuses: make(map[int]int64),
+	}
+}
@@ -0,0 +1,122 @@
+package alimnstest_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gogap/ali_mns"
+	"github.com/gogap/ali_mns/alimnstest"
+)
+
+func TestMockClientMatching(t *testing.T) {
+	type respond struct {
+		method   ali_mns.Method
+		resource string
+		status   int
+	}
+
+	for _, test := range []struct {
+		name     string
+		scripts  []respond
+		method   ali_mns.Method
+		resource string
+		want     int
+	}{
+		{"MethodAndPath", []respond{{ali_mns.GET, "queues/test", 200}}, ali_mns.GET, "queues/test", 200},
+		{"PathIgnoresQuery", []respond{{ali_mns.GET, "queues/test/messages", 200}}, ali_mns.GET, "queues/test/messages?waitseconds=1", 200},
+		{"QueryMatchesWholeResource", []respond{{ali_mns.GET, "queues/test/messages?peekonly=true", 200}}, ali_mns.GET, "queues/test/messages", 0},
+		{"AnyMethod", []respond{{"", "queues/test", 200}}, ali_mns.DELETE, "queues/test", 200},
+		{"AnyResource", []respond{{ali_mns.GET, "", 200}}, ali_mns.GET, "queues/other", 200},
+		{"LaterScriptWins", []respond{{ali_mns.GET, "", 200}, {ali_mns.GET, "queues/test", 204}}, ali_mns.GET, "queues/test", 204},
+		{"OtherMethod", []respond{{ali_mns.GET, "queues/test", 200}}, ali_mns.PUT, "queues/test", 0},
+		{"OtherPath", []respond{{ali_mns.GET, "queues/test", 200}}, ali_mns.GET, "queues/other", 0},
+		{"NothingScripted", nil, ali_mns.GET, "queues", 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			client := alimnstest.NewMockClient()
+			for _, script := range test.scripts {
+				client.Respond(script.method, script.resource, alimnstest.MockResponse{StatusCode: script.status})
+			}
+
+			resp, err := client.Send(test.method, nil, nil, test.resource)
+
+			if test.want == 0 {
+				if !errors.Is(err, alimnstest.ErrNotScripted) {
+					t.Fatalf("got error %v, want ErrNotScripted", err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if resp.StatusCode != test.want {
+				t.Fatalf("got status %d, want %d", resp.StatusCode, test.want)
+			}
+
+			// calls are recorded whether they match or not
+			if call, ok := client.LastCall(); !ok || call.Method != test.method || call.Resource != test.resource {
+				t.Fatalf("recorded %+v, want %s %s", call, test.method, test.resource)
+			}
+		})
+	}
+}
+
+func TestMockClientResponsesInOrder(t *testing.T) {
+	client := alimnstest.NewMockClient()
+	client.Respond(ali_mns.GET, "queues",
+		alimnstest.MockResponse{StatusCode: http.StatusOK},
+		alimnstest.ErrorResponse(http.StatusServiceUnavailable, "QpsLimitExceeded", "throttled"))
+
+	for i, want := range []int{http.StatusOK, http.StatusServiceUnavailable, http.StatusServiceUnavailable} {
+		resp, err := client.Send(ali_mns.GET, nil, nil, "queues")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != want {
+			t.Fatalf("call %d got status %d, want %d", i, resp.StatusCode, want)
+		}
+	}
+
+	if stats := client.ErrorStats(); stats.Codes["QpsLimitExceeded"] != 2 || stats.Statuses[http.StatusServiceUnavailable] != 2 {
+		t.Fatalf("counted %v and %v, want 2 QpsLimitExceeded with status 503", stats.Codes, stats.Statuses)
+	}
+
+	client.Reset()
+	if calls := client.Calls(); len(calls) != 0 {
+		t.Fatalf("%d calls kept after Reset", len(calls))
+	}
+	if _, err := client.Send(ali_mns.GET, nil, nil, "queues"); !errors.Is(err, alimnstest.ErrNotScripted) {
+		t.Fatalf("got error %v after Reset, want ErrNotScripted", err)
+	}
+}
+
+func TestMockClientQueue(t *testing.T) {
+	client := alimnstest.NewMockClient()
+	client.Respond(ali_mns.GET, "queues/test", alimnstest.XMLResponse(http.StatusOK, ali_mns.QueueAttribute{QueueName: "test"}))
+	client.Respond(ali_mns.POST, "queues/test/messages", alimnstest.XMLResponse(http.StatusCreated, ali_mns.MessageSendResponse{MessageId: "1"}))
+
+	queue, err := ali_mns.NewMNSQueueWithOptions("test", client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := queue.SendMessage(ali_mns.MessageSendRequest{MessageBody: []byte("mocked")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.MessageId != "1" {
+		t.Fatalf("got message id %q, want the scripted one", resp.MessageId)
+	}
+
+	call, _ := client.LastCall()
+	if call.Method != ali_mns.POST || call.Path() != "queues/test/messages" {
+		t.Fatalf("last call is %s %s", call.Method, call.Resource)
+	}
+	if !bytes.Contains(call.Body, []byte("<MessageBody>")) {
+		t.Fatalf("recorded body %q holds no message", call.Body)
+	}
+
+	// the queue passes failures of unscripted calls on
+	if err := queue.DeleteMessage("handle"); err == nil {
+		t.Fatal("unscripted delete succeeded")
+	}
+}
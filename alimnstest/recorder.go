@@ -0,0 +1,266 @@
+package alimnstest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+type RecorderMode int
+
+const (
+	// ModeReplay answers requests from the cassette only.
+	ModeReplay RecorderMode = iota
+	// ModeRecord sends requests to MNS and records them.
+	ModeRecord
+	// ModeReplayOrRecord replays if the cassette file exists and records
+	// otherwise.
+	ModeReplayOrRecord
+)
+
+const scrubbedValue = "******"
+
+// scrubbedHeaders are replaced in recorded requests, they hold credentials
+// or change on every request.
+var scrubbedHeaders = []string{"Authorization", "Security-Token", "Date"}
+
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URI    string      `json:"uri"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body"`
+}
+
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+}
+
+// Interaction is a request and its response. URI is the path and query of
+// the request; the host is not recorded.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// Cassette is the fixture file of a Recorder, JSON encoded.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+type RecorderOption func(*Recorder)
+
+// WithScrubber edits every interaction before it is recorded, e.g. to mask
+// message bodies holding personal data. Credentials are always scrubbed.
+func WithScrubber(scrubber func(*Interaction)) RecorderOption {
+	return func(p *Recorder) {
+		p.scrubbers = append(p.scrubbers, scrubber)
+	}
+}
+
+// WithRecordTransport sets the transport of recorded requests,
+// http.DefaultTransport by default.
+func WithRecordTransport(transport http.RoundTripper) RecorderOption {
+	return func(p *Recorder) {
+		if transport != nil {
+			p.transport = transport
+		}
+	}
+}
+
+// Recorder is an http.RoundTripper that records MNS interactions to a
+// cassette file and replays them, so tests built from real traffic run
+// without an endpoint:
+//
+//	recorder, err := alimnstest.NewRecorder("testdata/send.json", alimnstest.ModeReplayOrRecord)
+//	client := ali_mns.NewAliMNSClient(url, id, secret, ali_mns.WithTransport(recorder))
+//	...
+//	err = recorder.Stop()
+//
+// Replayed requests are matched on method and URI, each recorded
+// interaction answering one request in order. Client side retries or
+// polling loops should be turned off, as their timing is not replayed.
+type Recorder struct {
+	path      string
+	mode      RecorderMode
+	transport http.RoundTripper
+	scrubbers []func(*Interaction)
+
+	cassette Cassette
+	used     []bool
+	locker   sync.Mutex
+}
+
+// NewRecorder loads the cassette at path when replaying.
+func NewRecorder(path string, mode RecorderMode, opts ...RecorderOption) (recorder *Recorder, err error) {
+	recorder = &Recorder{
+		path:      path,
+		mode:      mode,
+		transport: http.DefaultTransport,
+	}
+
+	for _, opt := range opts {
+		opt(recorder)
+	}
+
+	if recorder.mode == ModeReplayOrRecord {
+		recorder.mode = ModeRecord
+		if _, e := os.Stat(path); e == nil {
+			recorder.mode = ModeReplay
+		}
+	}
+
+	if recorder.mode != ModeReplay {
+		return
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, &recorder.cassette); err != nil {
+		return nil, fmt.Errorf("alimnstest: invalid cassette %s: %s", path, err)
+	}
+	recorder.used = make([]bool, len(recorder.cassette.Interactions))
+
+	return
+}
+
+// Mode returns ModeRecord or ModeReplay, whichever the recorder runs in.
+func (p *Recorder) Mode() RecorderMode {
+	return p.mode
+}
+
+func (p *Recorder) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	var body []byte
+	if req.Body != nil {
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	if p.mode == ModeReplay {
+		return p.replay(req)
+	}
+
+	if resp, err = p.transport.RoundTrip(req); err != nil {
+		return
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	interaction := Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			URI:    req.URL.RequestURI(),
+			Header: cloneHeader(req.Header),
+			Body:   string(body),
+		},
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     cloneHeader(resp.Header),
+			Body:       string(respBody),
+		},
+	}
+
+	for _, name := range scrubbedHeaders {
+		if interaction.Request.Header.Get(name) != "" {
+			interaction.Request.Header.Set(name, scrubbedValue)
+		}
+	}
+
+	for _, scrubber := range p.scrubbers {
+		scrubber(&interaction)
+	}
+
+	p.locker.Lock()
+	p.cassette.Interactions = append(p.cassette.Interactions, interaction)
+	p.locker.Unlock()
+
+	return
+}
+
+func (p *Recorder) replay(req *http.Request) (resp *http.Response, err error) {
+	uri := req.URL.RequestURI()
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	for i, interaction := range p.cassette.Interactions {
+		if p.used[i] || interaction.Request.Method != req.Method || interaction.Request.URI != uri {
+			continue
+		}
+
+		p.used[i] = true
+
+		recorded := interaction.Response
+		resp = &http.Response{
+			StatusCode:    recorded.StatusCode,
+			Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        cloneHeader(recorded.Header),
+			Body:          ioutil.NopCloser(strings.NewReader(recorded.Body)),
+			ContentLength: int64(len(recorded.Body)),
+			Request:       req,
+		}
+		return
+	}
+
+	return nil, fmt.Errorf("alimnstest: no recorded interaction left for %s %s in %s", req.Method, uri, p.path)
+}
+
+// Unused returns the recorded interactions no request was answered with,
+// to assert a replay went through the whole cassette.
+func (p *Recorder) Unused() (interactions []Interaction) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	for i, interaction := range p.cassette.Interactions {
+		if !p.used[i] {
+			interactions = append(interactions, interaction)
+		}
+	}
+	return
+}
+
+// Stop writes the recorded interactions to the cassette file. It does
+// nothing when replaying.
+func (p *Recorder) Stop() (err error) {
+	if p.mode != ModeRecord {
+		return
+	}
+
+	p.locker.Lock()
+	data, err := json.MarshalIndent(p.cassette, "", "  ")
+	p.locker.Unlock()
+
+	if err != nil {
+		return
+	}
+
+	return ioutil.WriteFile(p.path, data, 0644)
+}
+
+func cloneHeader(header http.Header) http.Header {
+	clone := make(http.Header, len(header))
+	for k, v := range header {
+		clone[k] = append([]string(nil), v...)
+	}
+	return clone
+}
@@ -0,0 +1,110 @@
+package alimnstest_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gogap/ali_mns"
+	"github.com/gogap/ali_mns/alimnstest"
+)
+
+// converse runs a queue through its life cycle on client and returns what
+// it got back.
+func converse(t *testing.T, client ali_mns.MNSClient, url string) (transcript []string) {
+	manager := ali_mns.NewMNSQueueManagerWithClient(client)
+	if err := manager.CreateQueue(url, "test", 0, 65536, 345600, 30, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	queue, err := ali_mns.NewMNSQueueWithOptions("test", client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent, err := queue.SendMessage(ali_mns.MessageSendRequest{MessageBody: []byte("recorded")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	transcript = append(transcript, "sent "+sent.MessageId)
+
+	err = queue.(*ali_mns.MNSQueue).BatchReceiveMessageFunc(func(message ali_mns.MessageReceiveResponse) error {
+		transcript = append(transcript, fmt.Sprintf("received %s %s", message.MessageId, message.MessageBody))
+		return queue.DeleteMessage(message.ReceiptHandle)
+	}, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attr, err := manager.GetQueueAttributes(url, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	transcript = append(transcript, fmt.Sprintf("%d active", attr.ActiveMessages))
+
+	return
+}
+
+func TestRecorderRoundTrip(t *testing.T) {
+	cassette := filepath.Join(t.TempDir(), "cassette.json")
+
+	server := alimnstest.NewServer()
+	t.Cleanup(server.Close)
+
+	recorder, err := alimnstest.NewRecorder(cassette, alimnstest.ModeReplayOrRecord,
+		alimnstest.WithScrubber(func(interaction *alimnstest.Interaction) {
+			interaction.Response.Header.Del(ali_mns.MNS_REQUEST_ID)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorder.Mode() != alimnstest.ModeRecord {
+		t.Fatal("recorder without a cassette does not record")
+	}
+
+	client := ali_mns.NewAliMNSClient(server.URL, "test-id", "test-secret", ali_mns.WithTransport(recorder))
+	recorded := converse(t, client, server.URL)
+
+	if err = recorder.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(cassette)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "test-id") {
+		t.Fatal("cassette holds the access key id")
+	}
+	if strings.Contains(string(data), "EMULATOR-") {
+		t.Fatal("scrubber not applied")
+	}
+
+	// replayed without the server, on another url
+	server.Close()
+
+	replayer, err := alimnstest.NewRecorder(cassette, alimnstest.ModeReplayOrRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayer.Mode() != alimnstest.ModeReplay {
+		t.Fatal("recorder with a cassette does not replay")
+	}
+
+	client = ali_mns.NewAliMNSClient("http://replayed.mns", "other-id", "other-secret", ali_mns.WithTransport(replayer))
+	if replayed := converse(t, client, "http://replayed.mns"); !reflect.DeepEqual(replayed, recorded) {
+		t.Fatalf("replayed %q, recorded %q", replayed, recorded)
+	}
+
+	if unused := replayer.Unused(); len(unused) != 0 {
+		t.Fatalf("%d interactions not replayed", len(unused))
+	}
+
+	// every interaction answers one request
+	if _, err := client.Send(ali_mns.GET, nil, nil, "queues/test"); err == nil {
+		t.Fatal("request beyond the cassette answered")
+	}
+}
@@ -0,0 +1,609 @@
+package alimnstest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gogap/ali_mns"
+)
+
+type ServerOption func(*Server)
+
+// WithServerClock makes the server and its queues tell time by clock, e.g.
+// a FakeClock to expire visibility timeouts without waiting.
+func WithServerClock(clock ali_mns.Clock) ServerOption {
+	return func(p *Server) {
+		if clock != nil {
+			p.clock = clock
+		}
+	}
+}
+
+// WithCredentials makes the server verify the signature of every request
+// against accessKeyId and accessKeySecret, failing with
+// InvalidAccessKeyId or SignatureDoesNotMatch like MNS. By default
+// requests are not checked.
+func WithCredentials(accessKeyId, accessKeySecret string) ServerOption {
+	return func(p *Server) {
+		p.accessKeyId = accessKeyId
+		p.credential = ali_mns.NewAliMNSCredential(accessKeySecret)
+	}
+}
+
+// Server emulates the queue API of MNS over HTTP, so the real client can be
+// pointed at it:
+//
+//	server := alimnstest.NewServer()
+//	defer server.Close()
+//
+//	client := ali_mns.NewAliMNSClient(server.URL, "id", "secret")
+//
+// Queues behave like FakeQueue and keep message bodies as sent.
+// Topics, tags and message retention are not emulated.
+type Server struct {
+	*httptest.Server
+
+	accessKeyId string
+	credential  ali_mns.Credential
+	clock       ali_mns.Clock
+
+	queues    map[string]*serverQueue
+	account   ali_mns.AccountAttribute
+	requestId int64
+	locker    sync.Mutex
+}
+
+type serverQueue struct {
+	*FakeQueue
+	attr ali_mns.QueueAttribute
+}
+
+// NewServer starts a server, which must be closed with Close.
+func NewServer(opts ...ServerOption) *Server {
+	server := &Server{
+		clock:  ali_mns.SystemClock,
+		queues: make(map[string]*serverQueue),
+	}
+
+	for _, opt := range opts {
+		opt(server)
+	}
+
+	server.Server = httptest.NewServer(server)
+
+	return server
+}
+
+// Queue returns the queue named name, nil if it does not exist, to inspect
+// or seed it directly. Its bodies are as on the wire, so base64 encoded for
+// clients using the default Base64BodyCodec.
+func (p *Server) Queue(name string) *FakeQueue {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if queue, exist := p.queues[name]; exist {
+		return queue.FakeQueue
+	}
+	return nil
+}
+
+func (p *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(ali_mns.MNS_REQUEST_ID, fmt.Sprintf("EMULATOR-%016X", atomic.AddInt64(&p.requestId, 1)))
+
+	if !p.authorized(w, r) {
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case r.URL.Path == "/" && query.Get("accountmeta") == "true":
+		p.serveAccount(w, r, body)
+	case len(parts) == 1 && parts[0] == "queues" && r.Method == http.MethodGet:
+		p.serveListQueue(w, r)
+	case len(parts) == 2 && parts[0] == "queues":
+		p.serveQueue(w, r, parts[1], body)
+	case len(parts) == 3 && parts[0] == "queues" && parts[2] == "messages":
+		p.serveMessages(w, r, parts[1], body)
+	default:
+		writeError(w, r, http.StatusNotFound, "InvalidRequestURL", "The request url is not supported by the emulator.")
+	}
+}
+
+// authorized checks the Authorization header the way AliMNSClient signs
+// requests.
+func (p *Server) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if p.credential == nil {
+		return true
+	}
+
+	auth := r.Header.Get(ali_mns.AUTHORIZATION)
+	if auth == "" {
+		writeError(w, r, http.StatusForbidden, "MissingAuthorizationHeader", "The Authorization header is missing.")
+		return false
+	}
+
+	id, signature := "", ""
+	if fields := strings.SplitN(strings.TrimPrefix(auth, "MNS "), ":", 2); len(fields) == 2 {
+		id, signature = fields[0], fields[1]
+	}
+
+	if id != p.accessKeyId {
+		writeError(w, r, http.StatusForbidden, "InvalidAccessKeyId", "The access key id you provided does not exist.")
+		return false
+	}
+
+	headers := map[string]string{
+		ali_mns.CONTENT_MD5:  r.Header.Get(ali_mns.CONTENT_MD5),
+		ali_mns.CONTENT_TYPE: r.Header.Get(ali_mns.CONTENT_TYPE),
+		ali_mns.DATE:         r.Header.Get(ali_mns.DATE),
+	}
+	for k := range r.Header {
+		if k := strings.ToLower(k); strings.HasPrefix(k, "x-mns-") {
+			headers[k] = r.Header.Get(k)
+		}
+	}
+
+	expected, err := p.credential.Signature(ali_mns.Method(r.Method), headers, r.URL.RequestURI())
+	if err != nil || expected != signature {
+		writeError(w, r, http.StatusForbidden, "SignatureDoesNotMatch", "The request signature does not conform to MNS standards.")
+		return false
+	}
+
+	return true
+}
+
+func (p *Server) serveAccount(w http.ResponseWriter, r *http.Request, body []byte) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		writeXML(w, http.StatusOK, p.account)
+	case http.MethodPut:
+		attr := ali_mns.AccountAttribute{}
+		if xml.Unmarshal(body, &attr) != nil {
+			writeError(w, r, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed.")
+			return
+		}
+		p.account = attr
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, r, http.StatusNotFound, "InvalidRequestURL", "The request url is not supported by the emulator.")
+	}
+}
+
+func (p *Server) serveListQueue(w http.ResponseWriter, r *http.Request) {
+	prefix := r.Header.Get("x-mns-prefix")
+	marker := r.Header.Get("x-mns-marker")
+
+	retNumber := 1000
+	if n, err := strconv.Atoi(r.Header.Get("x-mns-ret-number")); err == nil && n > 0 {
+		retNumber = n
+	}
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	var names []string
+	for name := range p.queues {
+		if strings.HasPrefix(name, prefix) && name >= marker {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	nextMarker := ""
+	if len(names) > retNumber {
+		nextMarker = names[retNumber]
+		names = names[:retNumber]
+	}
+
+	if r.Header.Get("x-mns-with-meta") == "true" {
+		queues := ali_mns.QueuesWithMeta{NextMarker: nextMarker}
+		for _, name := range names {
+			queues.Queues = append(queues.Queues, p.queues[name].attributes())
+		}
+		writeXML(w, http.StatusOK, queues)
+		return
+	}
+
+	queues := ali_mns.Queues{NextMarker: nextMarker}
+	for _, name := range names {
+		queues.Queues = append(queues.Queues, ali_mns.Queue{QueueURL: p.URL + "/queues/" + name})
+	}
+	writeXML(w, http.StatusOK, queues)
+}
+
+func (p *Server) serveQueue(w http.ResponseWriter, r *http.Request, name string, body []byte) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	queue, exist := p.queues[name]
+
+	switch r.Method {
+	case http.MethodPut:
+		request := ali_mns.CreateQueueRequest{}
+		if len(body) > 0 && xml.Unmarshal(body, &request) != nil {
+			writeError(w, r, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed.")
+			return
+		}
+
+		if r.URL.Query().Get("metaoverride") == "true" {
+			if !exist {
+				writeQueueNotExist(w, r)
+				return
+			}
+			queue.update(request)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if exist {
+			updated := queue.attr
+			applyAttributes(&updated, request)
+			updated.LastModifyTime = queue.attr.LastModifyTime
+			if updated == queue.attr {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			writeError(w, r, http.StatusConflict, "QueueAlreadyExist", "The queue you want to create already exists.")
+			return
+		}
+
+		now := p.clock.Now().Unix()
+		queue = &serverQueue{
+			FakeQueue: NewFakeQueue(WithName(name), WithClock(p.clock)),
+			attr: ali_mns.QueueAttribute{
+				QueueName:              name,
+				MaxMessageSize:         ali_mns.DefaultMaxMessageSize,
+				MessageRetentionPeriod: 345600,
+				VisibilityTimeout:      int32(DefaultFakeVisibilityTimeout / time.Second),
+				CreateTime:             now,
+				LastModifyTime:         now,
+			},
+		}
+		queue.rawBodies = true
+		queue.update(request)
+		p.queues[name] = queue
+
+		w.Header().Set("Location", p.URL+"/queues/"+name)
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet:
+		if !exist {
+			writeQueueNotExist(w, r)
+			return
+		}
+		writeXML(w, http.StatusOK, queue.attributes())
+	case http.MethodDelete:
+		if exist {
+			queue.Stop()
+			delete(p.queues, name)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, r, http.StatusNotFound, "InvalidRequestURL", "The request url is not supported by the emulator.")
+	}
+}
+
+// applyAttributes sets the attributes set in request on attr.
+func applyAttributes(attr *ali_mns.QueueAttribute, request ali_mns.CreateQueueRequest) {
+	if request.DelaySeconds > 0 {
+		attr.DelaySeconds = request.DelaySeconds
+	}
+	if request.MaxMessageSize > 0 {
+		attr.MaxMessageSize = request.MaxMessageSize
+	}
+	if request.MessageRetentionPeriod > 0 {
+		attr.MessageRetentionPeriod = request.MessageRetentionPeriod
+	}
+	if request.VisibilityTimeout > 0 {
+		attr.VisibilityTimeout = request.VisibilityTimeout
+	}
+	if request.PollingWaitSeconds > 0 {
+		attr.PollingWaitSeconds = request.PollingWaitSeconds
+	}
+	if request.LoggingEnabled != nil {
+		attr.LoggingEnabled = *request.LoggingEnabled
+	}
+}
+
+// update applies the attributes set in request to the queue. Must be
+// called with the locker of the server held.
+func (p *serverQueue) update(request ali_mns.CreateQueueRequest) {
+	applyAttributes(&p.attr, request)
+	p.attr.LastModifyTime = p.clock.Now().Unix()
+
+	p.FakeQueue.locker.Lock()
+	p.visibilityTimeout = time.Duration(p.attr.VisibilityTimeout) * time.Second
+	p.pollingWait = time.Duration(p.attr.PollingWaitSeconds) * time.Second
+	p.FakeQueue.locker.Unlock()
+}
+
+func (p *serverQueue) attributes() ali_mns.QueueAttribute {
+	attr := p.attr
+
+	counts := p.Attributes()
+	attr.ActiveMessages = counts.ActiveMessages
+	attr.InactiveMessages = counts.InactiveMessages
+	attr.DelayMessages = counts.DelayMessages
+
+	return attr
+}
+
+func (p *Server) queue(name string) (queue *serverQueue, exist bool) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	queue, exist = p.queues[name]
+	return
+}
+
+// wireSendMessage is a message of a send request, MessageBody as is.
+type wireSendMessage struct {
+	MessageBody  string `xml:"MessageBody"`
+	DelaySeconds *int64 `xml:"DelaySeconds"`
+	Priority     int64  `xml:"Priority"`
+}
+
+type wireSendMessages struct {
+	XMLName  xml.Name          `xml:"Messages"`
+	Messages []wireSendMessage `xml:"Message"`
+}
+
+type wireSentMessage struct {
+	XMLName        xml.Name `xml:"Message"`
+	MessageId      string   `xml:"MessageId"`
+	MessageBodyMD5 string   `xml:"MessageBodyMD5"`
+}
+
+type wireSentMessages struct {
+	XMLName  xml.Name          `xml:"Messages"`
+	Messages []wireSentMessage `xml:"Message"`
+}
+
+// wireReceivedMessage is a received message with MessageBody as it was
+// sent.
+type wireReceivedMessage struct {
+	XMLName          xml.Name `xml:"Message"`
+	MessageId        string   `xml:"MessageId"`
+	ReceiptHandle    string   `xml:"ReceiptHandle,omitempty"`
+	MessageBodyMD5   string   `xml:"MessageBodyMD5"`
+	MessageBody      string   `xml:"MessageBody"`
+	EnqueueTime      int64    `xml:"EnqueueTime"`
+	NextVisibleTime  int64    `xml:"NextVisibleTime,omitempty"`
+	FirstDequeueTime int64    `xml:"FirstDequeueTime"`
+	DequeueCount     int64    `xml:"DequeueCount"`
+	Priority         int64    `xml:"Priority"`
+}
+
+type wireReceivedMessages struct {
+	XMLName  xml.Name              `xml:"Messages"`
+	Messages []wireReceivedMessage `xml:"Message"`
+}
+
+func newWireReceivedMessage(message ali_mns.MessageReceiveResponse) wireReceivedMessage {
+	return wireReceivedMessage{
+		MessageId:        message.MessageId,
+		ReceiptHandle:    message.ReceiptHandle,
+		MessageBodyMD5:   message.MessageBodyMD5,
+		MessageBody:      string(message.MessageBody),
+		EnqueueTime:      message.EnqueueTime,
+		NextVisibleTime:  message.NextVisibleTime,
+		FirstDequeueTime: message.FirstDequeueTime,
+		DequeueCount:     message.DequeueCount,
+		Priority:         message.Priority,
+	}
+}
+
+func (p *Server) serveMessages(w http.ResponseWriter, r *http.Request, name string, body []byte) {
+	queue, exist := p.queue(name)
+	if !exist {
+		writeQueueNotExist(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+
+	switch r.Method {
+	case http.MethodPost:
+		p.serveSend(w, r, queue, body)
+	case http.MethodGet:
+		p.serveReceive(w, r, queue)
+	case http.MethodDelete:
+		if handle := query.Get("ReceiptHandle"); handle != "" {
+			if err := queue.DeleteMessage(handle); err != nil {
+				writeMessageNotExist(w, r)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		handles := ali_mns.ReceiptHandles{}
+		if xml.Unmarshal(body, &handles) != nil {
+			writeError(w, r, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed.")
+			return
+		}
+		if err := queue.BatchDeleteMessage(handles.ReceiptHandles...); err != nil {
+			writeError(w, r, http.StatusNotFound, "BatchDeleteFail", "Some receipt handles are invalid or expired.")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodPut:
+		timeout, err := strconv.ParseInt(query.Get("VisibilityTimeout"), 10, 64)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "MissingVisibilityTimeout", "The VisibilityTimeout parameter is missing or invalid.")
+			return
+		}
+
+		resp, err := queue.ChangeMessageVisibility(query.Get("ReceiptHandle"), timeout)
+		if err != nil {
+			writeMessageNotExist(w, r)
+			return
+		}
+		writeXML(w, http.StatusOK, resp)
+	default:
+		writeError(w, r, http.StatusNotFound, "InvalidRequestURL", "The request url is not supported by the emulator.")
+	}
+}
+
+func (p *Server) serveSend(w http.ResponseWriter, r *http.Request, queue *serverQueue, body []byte) {
+	p.locker.Lock()
+	attr := queue.attr
+	p.locker.Unlock()
+
+	toRequest := func(message wireSendMessage) (request ali_mns.MessageSendRequest, ok bool) {
+		if int32(len(message.MessageBody)) > attr.MaxMessageSize {
+			return
+		}
+
+		request.MessageBody = ali_mns.Base64Bytes(message.MessageBody)
+		request.Priority = message.Priority
+		request.DelaySeconds = int64(attr.DelaySeconds)
+		if message.DelaySeconds != nil {
+			request.DelaySeconds = *message.DelaySeconds
+		}
+		return request, true
+	}
+
+	batch := wireSendMessages{}
+	if xml.Unmarshal(body, &batch) == nil {
+		var requests []ali_mns.MessageSendRequest
+		for _, message := range batch.Messages {
+			request, ok := toRequest(message)
+			if !ok {
+				writeError(w, r, http.StatusBadRequest, "MessageBodyTooLarge", "The message body is larger than the MaximumMessageSize of the queue.")
+				return
+			}
+			requests = append(requests, request)
+		}
+
+		resp, err := queue.BatchSendMessage(requests...)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "InvalidArgument", err.Error())
+			return
+		}
+
+		sent := wireSentMessages{}
+		for _, message := range resp.Messages {
+			sent.Messages = append(sent.Messages, wireSentMessage{MessageId: message.MessageId, MessageBodyMD5: message.MessageBodyMD5})
+		}
+		writeXML(w, http.StatusCreated, sent)
+		return
+	}
+
+	message := wireSendMessage{}
+	if xml.Unmarshal(body, &message) != nil {
+		writeError(w, r, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed.")
+		return
+	}
+
+	request, ok := toRequest(message)
+	if !ok {
+		writeError(w, r, http.StatusBadRequest, "MessageBodyTooLarge", "The message body is larger than the MaximumMessageSize of the queue.")
+		return
+	}
+
+	resp, err := queue.SendMessage(request)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+
+	writeXML(w, http.StatusCreated, wireSentMessage{MessageId: resp.MessageId, MessageBodyMD5: resp.MessageBodyMD5})
+}
+
+func (p *Server) serveReceive(w http.ResponseWriter, r *http.Request, queue *serverQueue) {
+	query := r.URL.Query()
+
+	peekOnly := query.Get("peekonly") == "true"
+
+	n, batch := 1, query.Get("numOfMessages") != ""
+	if batch {
+		var err error
+		if n, err = strconv.Atoi(query.Get("numOfMessages")); err != nil || n < 1 || n > int(ali_mns.DefaultNumOfMessages) {
+			writeError(w, r, http.StatusBadRequest, "InvalidArgument", "The numOfMessages parameter should be between 1 and 16.")
+			return
+		}
+	}
+
+	wait := time.Duration(0)
+	if !peekOnly {
+		wait = queue.waitOf(nil)
+		if seconds, err := strconv.Atoi(query.Get("waitseconds")); err == nil {
+			wait = time.Duration(seconds) * time.Second
+		}
+	}
+
+	op := "ReceiveMessage"
+	if peekOnly {
+		op = "PeekMessage"
+	}
+	if batch {
+		op = "Batch" + op
+	}
+
+	messages, err := queue.receive(r.Context(), op, n, peekOnly, wait)
+	if err != nil {
+		writeMessageNotExist(w, r)
+		return
+	}
+
+	if !batch {
+		writeXML(w, http.StatusOK, newWireReceivedMessage(messages[0]))
+		return
+	}
+
+	received := wireReceivedMessages{}
+	for _, message := range messages {
+		received.Messages = append(received.Messages, newWireReceivedMessage(message))
+	}
+	writeXML(w, http.StatusOK, received)
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) {
+	body, err := xml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set(ali_mns.CONTENT_TYPE, "text/xml;charset=utf-8")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	w.Write(body)
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	writeXML(w, status, ali_mns.ErrorMessageResponse{
+		Code:      code,
+		Message:   message,
+		RequestId: w.Header().Get(ali_mns.MNS_REQUEST_ID),
+		HostId:    "http://" + r.Host,
+	})
+}
+
+func writeQueueNotExist(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusNotFound, "QueueNotExist", "The queue name you provided is not exist.")
+}
+
+func writeMessageNotExist(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusNotFound, "MessageNotExist", "Message not exist.")
+}
@@ -0,0 +1,220 @@
+package ali_mns
+
+import (
+	"encoding/base64"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultProducerBatchBytes = 65536
+	DefaultProducerLinger     = 10 * time.Millisecond
+	DefaultProducerBufferSize = 256
+)
+
+type ProducerMessage struct {
+	Request  MessageSendRequest
+	Metadata interface{}
+}
+
+type ProducerResult struct {
+	Message  *ProducerMessage
+	Response MessageSendResponse
+	Err      error
+}
+
+type ProducerOption func(*AsyncProducer)
+
+// WithProducerBatchCount flushes a batch once it holds count messages, at
+// most MaxBatchMessages.
+func WithProducerBatchCount(count int) ProducerOption {
+	return func(p *AsyncProducer) {
+		if count > 0 && count <= MaxBatchMessages {
+			p.batchCount = count
+		}
+	}
+}
+
+// WithProducerBatchBytes flushes a batch before its encoded message bodies
+// would exceed bytes.
+func WithProducerBatchBytes(bytes int) ProducerOption {
+	return func(p *AsyncProducer) {
+		if bytes > 0 {
+			p.batchBytes = bytes
+		}
+	}
+}
+
+// WithProducerLinger flushes a batch linger after its first message even if
+// it is not full.
+func WithProducerLinger(linger time.Duration) ProducerOption {
+	return func(p *AsyncProducer) {
+		if linger > 0 {
+			p.linger = linger
+		}
+	}
+}
+
+func WithProducerBufferSize(size int) ProducerOption {
+	return func(p *AsyncProducer) {
+		if size >= 0 {
+			p.bufferSize = size
+		}
+	}
+}
+
+// AsyncProducer sends messages in the background, grouping them into
+// BatchSendMessage requests. Every message gets exactly one ProducerResult
+// on Results, which must be drained.
+type AsyncProducer struct {
+	queue AliMNSQueue
+
+	batchCount int
+	batchBytes int
+	linger     time.Duration
+	bufferSize int
+
+	input    chan *ProducerMessage
+	results  chan *ProducerResult
+	doneChan chan struct{}
+
+	closed bool
+	locker sync.RWMutex
+}
+
+func NewAsyncProducer(queue AliMNSQueue, opts ...ProducerOption) *AsyncProducer {
+	producer := &AsyncProducer{
+		queue:      queue,
+		batchCount: MaxBatchMessages,
+		batchBytes: DefaultProducerBatchBytes,
+		linger:     DefaultProducerLinger,
+		bufferSize: DefaultProducerBufferSize,
+		doneChan:   make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(producer)
+	}
+
+	producer.input = make(chan *ProducerMessage, producer.bufferSize)
+	producer.results = make(chan *ProducerResult, producer.bufferSize)
+
+	go producer.run()
+
+	return producer
+}
+
+// Input is the channel messages are produced on. Nothing may be sent on it
+// once Close was called.
+func (p *AsyncProducer) Input() chan<- *ProducerMessage {
+	return p.input
+}
+
+func (p *AsyncProducer) Results() <-chan *ProducerResult {
+	return p.results
+}
+
+func (p *AsyncProducer) SendAsync(message *ProducerMessage) (err error) {
+	p.locker.RLock()
+	defer p.locker.RUnlock()
+
+	if p.closed {
+		return ERR_PRODUCER_CLOSED.New()
+	}
+
+	p.input <- message
+	return
+}
+
+// Close stops accepting messages, flushes what is buffered and waits until
+// the last result is delivered, then closes Results.
+func (p *AsyncProducer) Close() {
+	p.locker.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.input)
+	}
+	p.locker.Unlock()
+
+	<-p.doneChan
+}
+
+func (p *AsyncProducer) run() {
+	defer close(p.doneChan)
+	defer close(p.results)
+
+	clock := clockOf(p.queue)
+
+	var batch []*ProducerMessage
+	var linger Timer
+	var lingerChan <-chan time.Time
+	size := 0
+
+	flush := func() {
+		p.flush(batch)
+		batch = nil
+		size = 0
+		if linger != nil {
+			linger.Stop()
+			linger, lingerChan = nil, nil
+		}
+	}
+
+	for {
+		select {
+		case message, ok := <-p.input:
+			if !ok {
+				flush()
+				return
+			}
+
+			n := base64.StdEncoding.EncodedLen(len(message.Request.MessageBody))
+			if len(batch) > 0 && size+n > p.batchBytes {
+				flush()
+			}
+
+			batch = append(batch, message)
+			size += n
+
+			if len(batch) == 1 {
+				linger = clock.NewTimer(p.linger)
+				lingerChan = linger.C()
+			}
+
+			if len(batch) >= p.batchCount {
+				flush()
+			}
+		case <-lingerChan:
+			flush()
+		}
+	}
+}
+
+func (p *AsyncProducer) flush(batch []*ProducerMessage) {
+	if len(batch) == 0 {
+		return
+	}
+
+	requests := make([]MessageSendRequest, 0, len(batch))
+	for _, message := range batch {
+		requests = append(requests, message.Request)
+	}
+
+	resp, err := p.queue.BatchSendMessage(requests...)
+	if ERR_MNS_BATCH_SEND_PARTIAL_FAILURE.IsEqual(err) {
+		err = nil
+	}
+
+	entries := resp.Result().Entries
+
+	for i, message := range batch {
+		result := &ProducerResult{Message: message, Err: err}
+
+		if err == nil && i < len(entries) {
+			result.Response = entries[i].Response
+			result.Err = entries[i].Err()
+		}
+
+		p.results <- result
+	}
+}
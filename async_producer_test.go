@@ -0,0 +1,80 @@
+package ali_mns_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gogap/ali_mns"
+)
+
+func TestAsyncProducer(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		opts        []ali_mns.ProducerOption
+		messages    int
+		failing     int32
+		close       bool
+		wantBatches []int
+		wantFailed  []int
+	}{
+		{"FlushesFullBatches", []ali_mns.ProducerOption{ali_mns.WithProducerBatchCount(4), ali_mns.WithProducerLinger(time.Hour)}, 10, 0, true, []int{4, 4, 2}, nil},
+		{"CapsBatchCount", []ali_mns.ProducerOption{ali_mns.WithProducerBatchCount(100), ali_mns.WithProducerLinger(time.Hour)}, 20, 0, true, []int{16, 4}, nil},
+		{"FlushesOnBytes", []ali_mns.ProducerOption{ali_mns.WithProducerBatchBytes(30), ali_mns.WithProducerLinger(time.Hour)}, 5, 0, true, []int{2, 2, 1}, nil},
+		{"FlushesAfterLinger", []ali_mns.ProducerOption{ali_mns.WithProducerLinger(10 * time.Millisecond)}, 3, 0, false, []int{3}, nil},
+		{"ReportsFailedEntries", []ali_mns.ProducerOption{ali_mns.WithProducerLinger(time.Hour)}, 3, 1, true, []int{3}, []int{1}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server := newBatchServer(t, test.failing, 1, "InternalError")
+			producer := ali_mns.NewAsyncProducer(server.queue(t), test.opts...)
+
+			// "message N" is 9 bytes, 12 base64 encoded
+			for i, message := range newBatch(test.messages) {
+				if err := producer.SendAsync(&ali_mns.ProducerMessage{Request: message, Metadata: i}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if test.close {
+				go producer.Close()
+			}
+
+			failed := make(map[int]bool)
+			for _, i := range test.wantFailed {
+				failed[i] = true
+			}
+
+			for i := 0; i < test.messages; i++ {
+				select {
+				case result := <-producer.Results():
+					if result.Message.Metadata != i {
+						t.Fatalf("result %d is of message %v", i, result.Message.Metadata)
+					}
+					if (result.Err != nil) != failed[i] {
+						t.Fatalf("message %d: got error %v, want error: %t", i, result.Err, failed[i])
+					}
+					if result.Err == nil && result.Response.MessageId == "" {
+						t.Fatalf("message %d has no message id", i)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatalf("got %d of %d results", i, test.messages)
+				}
+			}
+
+			for i, want := range test.wantBatches {
+				if got := <-server.batches; got != want {
+					t.Fatalf("batch %d holds %d messages, want %d", i, got, want)
+				}
+			}
+
+			if !test.close {
+				producer.Close()
+			}
+			if len(server.batches) != 0 {
+				t.Fatalf("%d more batches sent than the %d expected", len(server.batches), len(test.wantBatches))
+			}
+			if err := producer.SendAsync(&ali_mns.ProducerMessage{}); !ali_mns.ERR_PRODUCER_CLOSED.IsEqual(err) {
+				t.Fatalf("send after Close: got error %v, want producer closed", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package ali_mns
+
+import (
+	"context"
+	"time"
+)
+
+var (
+	DefaultEmptyReceiveMinBackoff = time.Millisecond * 100
+	DefaultEmptyReceiveMaxBackoff = time.Second * 2
+
+	DefaultReceiveErrorMinBackoff = time.Millisecond * 100
+	DefaultReceiveErrorMaxBackoff = time.Second * 30
+)
+
+// WithEmptyReceiveBackoff makes receive and peek loops sleep between empty
+// polls, starting at min and doubling up to max, and resetting as soon as a
+// message arrives. A max of zero disables the backoff.
+func WithEmptyReceiveBackoff(min, max time.Duration) QueueOption {
+	return func(p *MNSQueue) {
+		if min <= 0 {
+			min = DefaultEmptyReceiveMinBackoff
+		}
+		if max < min {
+			max = 0
+		}
+		p.emptyReceiveMinBackoff = min
+		p.emptyReceiveMaxBackoff = max
+	}
+}
+
+// WithReceiveErrorBackoff makes receive and peek loops sleep after failed
+// polls, such as when the endpoint is unreachable, for a random delay of at
+// least min and at most min*2^(failures-1), capped at max, resetting on the
+// first success. A max of zero disables the backoff.
+func WithReceiveErrorBackoff(min, max time.Duration) QueueOption {
+	return func(p *MNSQueue) {
+		if min <= 0 {
+			min = DefaultReceiveErrorMinBackoff
+		}
+		if max < min {
+			p.receiveErrorBackoff = nil
+			return
+		}
+		p.receiveErrorBackoff = NewExponentialBackoff(0, min, max)
+	}
+}
+
+type emptyReceiveBackoff struct {
+	min     time.Duration
+	max     time.Duration
+	current time.Duration
+
+	failure  *ExponentialBackoff
+	failures int
+	clock    Clock
+}
+
+func (p *MNSQueue) newEmptyReceiveBackoff() *emptyReceiveBackoff {
+	return &emptyReceiveBackoff{
+		min:     p.emptyReceiveMinBackoff,
+		max:     p.emptyReceiveMaxBackoff,
+		failure: p.receiveErrorBackoff,
+		clock:   p.clock,
+	}
+}
+
+// next returns how long to sleep after a poll that took elapsed and failed
+// with err. Empty polls the server already held for a long time (long
+// polling) are not delayed further.
+func (p *emptyReceiveBackoff) next(err error, elapsed time.Duration) time.Duration {
+	if err != nil && !ERR_MNS_MESSAGE_NOT_EXIST.IsEqual(err) {
+		p.current = 0
+		if p.failure == nil {
+			return 0
+		}
+		p.failures++
+		return p.failure.equalJitterBackoff(p.failures)
+	}
+
+	p.failures = 0
+
+	if err == nil {
+		p.current = 0
+		return 0
+	}
+
+	if p.max <= 0 || elapsed >= p.max {
+		return 0
+	}
+
+	if p.current == 0 {
+		p.current = p.min
+	} else if p.current *= 2; p.current > p.max {
+		p.current = p.max
+	}
+
+	return p.current
+}
+
+func (p *emptyReceiveBackoff) wait(ctx context.Context, err error, elapsed time.Duration) {
+	sleepContext(ctx, p.clock, p.next(err, elapsed))
+}
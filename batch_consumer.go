@@ -0,0 +1,193 @@
+package ali_mns
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gogap/errors"
+)
+
+// BatchMessageHandler processes a batch of messages. errs[i] is the result
+// of messages[i]; a nil slice means every message succeeded. Successful
+// messages are deleted with a single BatchDeleteMessage call.
+type BatchMessageHandler func(messages []MessageReceiveResponse) (errs []error)
+
+func WithBatchSize(numOfMessages int32) ConsumerOption {
+	return func(p *Consumer) {
+		if numOfMessages > 0 {
+			p.batchSize = numOfMessages
+		}
+	}
+}
+
+// NewBatchConsumer consumes with BatchReceiveMessage and hands whole batches
+// to handler. Options apply per message, except WithPartitionKey which is
+// ignored in batch mode.
+func NewBatchConsumer(queue AliMNSQueue, handler BatchMessageHandler, opts ...ConsumerOption) *Consumer {
+	if handler == nil {
+		panic("ali_mns: consumer handler could not be nil")
+	}
+
+	consumer := newConsumer(queue, opts...)
+	consumer.batchHandler = handler
+
+	return consumer
+}
+
+func (p *Consumer) runBatch(stopChan, doneChan chan bool) {
+	defer close(doneChan)
+
+	respChan := make(chan BatchMessageReceiveResponse)
+	errChan := make(chan error)
+	loopDone := make(chan bool)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		defer close(loopDone)
+		if receiver, ok := p.queue.(ContextReceiver); ok {
+			receiver.BatchReceiveMessageContext(ctx, respChan, errChan, p.batchSize, p.waitSeconds...)
+			return
+		}
+		p.queue.BatchReceiveMessage(respChan, errChan, p.batchSize, p.waitSeconds...)
+	}()
+
+	jobs := make(chan []MessageReceiveResponse)
+	workers := sync.WaitGroup{}
+
+	for i := 0; i < p.concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for messages := range jobs {
+				p.processBatch(messages)
+			}
+		}()
+	}
+
+	defer func() {
+		close(jobs)
+		p.stopReceiving(cancel)
+		p.drainBatch(respChan, errChan, loopDone)
+		workers.Wait()
+	}()
+
+	for {
+		select {
+		case resp := <-respChan:
+			if len(resp.Messages) == 0 {
+				continue
+			}
+
+			if !p.waitRateLimit(stopChan, len(resp.Messages)) {
+				p.nackAll(resp.Messages)
+				return
+			}
+
+			select {
+			case jobs <- resp.Messages:
+			case <-stopChan:
+				p.nackAll(resp.Messages)
+				return
+			}
+		case err := <-errChan:
+			p.onReceiveError(err)
+		case <-stopChan:
+			return
+		}
+	}
+}
+
+func (p *Consumer) drainBatch(respChan chan BatchMessageReceiveResponse, errChan chan error, loopDone chan bool) {
+	for {
+		select {
+		case resp := <-respChan:
+			p.nackAll(resp.Messages)
+		case <-errChan:
+		case <-loopDone:
+			return
+		}
+	}
+}
+
+func (p *Consumer) processBatch(messages []MessageReceiveResponse) {
+	p.acquireSlot()
+	defer p.releaseSlot()
+
+	admitted := make([]MessageReceiveResponse, 0, len(messages))
+	for _, message := range messages {
+		if p.admit(message) {
+			admitted = append(admitted, message)
+		}
+	}
+
+	if len(admitted) == 0 {
+		return
+	}
+
+	inflights := make([]*inflightMessage, len(admitted))
+	for i, message := range admitted {
+		inflights[i] = p.startInflight(message)
+		defer p.untrack(inflights[i])
+	}
+
+	errs := p.handleBatch(admitted)
+
+	receiptHandles := make([]string, 0, len(admitted))
+	for i, inflight := range inflights {
+		var err error
+		if i < len(errs) {
+			err = errs[i]
+		}
+		p.finishDedup(admitted[i], err)
+
+		message, ok := inflight.settle()
+		if !ok {
+			continue
+		}
+
+		p.countHandled(err)
+
+		if err != nil {
+			p.nack(message)
+			continue
+		}
+
+		receiptHandles = append(receiptHandles, message.ReceiptHandle)
+	}
+
+	if len(receiptHandles) == 0 {
+		return
+	}
+
+	if err := p.queue.BatchDeleteMessage(receiptHandles...); err != nil {
+		p.onError(err)
+		return
+	}
+	atomic.AddInt64(&p.counters.acked, int64(len(receiptHandles)))
+}
+
+// handleBatch fails the whole batch if the handler panics.
+func (p *Consumer) handleBatch(messages []MessageReceiveResponse) (errs []error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err := ERR_HANDLER_PANIC.New(errors.Params{"id": messages[0].MessageId, "panic": r, "stack": string(debug.Stack())})
+			p.onError(err)
+
+			errs = make([]error, len(messages))
+			for i := range errs {
+				errs[i] = err
+			}
+		}
+	}()
+
+	return p.batchHandler(messages)
+}
+
+func (p *Consumer) nackAll(messages []MessageReceiveResponse) {
+	for _, message := range messages {
+		p.nack(message)
+	}
+}
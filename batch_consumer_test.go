@@ -0,0 +1,104 @@
+package ali_mns_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gogap/ali_mns"
+)
+
+func TestBatchConsumer(t *testing.T) {
+	failBodies := func(messages []ali_mns.MessageReceiveResponse) (errs []error) {
+		errs = make([]error, len(messages))
+		for i, message := range messages {
+			if string(message.MessageBody) == "fail" {
+				errs[i] = errors.New("failed")
+			}
+		}
+		return
+	}
+
+	for _, test := range []struct {
+		name       string
+		bodies     []string
+		handler    ali_mns.BatchMessageHandler
+		batchSize  int32
+		wantAcked  int64
+		wantNacked int64
+		wantPanic  bool
+	}{
+		{"AllSucceed", []string{"a", "b", "c", "d", "e"}, func([]ali_mns.MessageReceiveResponse) []error { return nil }, 16, 5, 0, false},
+		{"SomeFail", []string{"a", "fail", "b", "fail"}, failBodies, 16, 2, 2, false},
+		{"SmallBatches", []string{"a", "b", "c", "d", "e"}, func([]ali_mns.MessageReceiveResponse) []error { return nil }, 2, 5, 0, false},
+		{"Panic", []string{"a", "b"}, func([]ali_mns.MessageReceiveResponse) []error { panic("boom") }, 16, 0, 2, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server, queue := newTestQueue(t)
+
+			for _, body := range test.bodies {
+				if _, err := queue.SendMessage(ali_mns.MessageSendRequest{MessageBody: []byte(body)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			locker := sync.Mutex{}
+			largest := 0
+			var handlerErrs []error
+
+			consumer := ali_mns.NewBatchConsumer(queue, func(messages []ali_mns.MessageReceiveResponse) []error {
+				locker.Lock()
+				if len(messages) > largest {
+					largest = len(messages)
+				}
+				locker.Unlock()
+				return test.handler(messages)
+			},
+				ali_mns.WithBatchSize(test.batchSize),
+				ali_mns.WithWaitSeconds(1),
+				ali_mns.WithNackVisibilityTimeout(60),
+				ali_mns.WithErrorHandler(func(err error) {
+					locker.Lock()
+					defer locker.Unlock()
+					handlerErrs = append(handlerErrs, err)
+				}))
+			consumer.Start()
+			defer consumer.Stop()
+
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				stats := consumer.Stats()
+				if stats.Acked+stats.Nacked >= int64(len(test.bodies)) {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("settled %d of %d messages", stats.Acked+stats.Nacked, len(test.bodies))
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			if stats := consumer.Stats(); stats.Acked != test.wantAcked || stats.Nacked != test.wantNacked {
+				t.Fatalf("acked %d and nacked %d messages, want %d and %d", stats.Acked, stats.Nacked, test.wantAcked, test.wantNacked)
+			}
+
+			fake := server.Queue("test")
+			if attr := fake.Attributes(); attr.ActiveMessages != 0 || attr.InactiveMessages != test.wantNacked {
+				t.Fatalf("queue holds %d active and %d inactive messages, want 0 and %d", attr.ActiveMessages, attr.InactiveMessages, test.wantNacked)
+			}
+			if test.wantAcked > 0 && fake.Stats().Operations["DeleteMessage"] != 0 {
+				t.Fatal("successful messages were deleted one by one")
+			}
+
+			locker.Lock()
+			defer locker.Unlock()
+
+			if largest > int(test.batchSize) {
+				t.Fatalf("handler got %d messages at once, more than the batch size %d", largest, test.batchSize)
+			}
+			if panicked := len(handlerErrs) > 0 && ali_mns.ERR_HANDLER_PANIC.IsEqual(handlerErrs[0]); panicked != test.wantPanic {
+				t.Fatalf("reported errors %v, want a panic: %t", handlerErrs, test.wantPanic)
+			}
+		})
+	}
+}
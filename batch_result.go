@@ -0,0 +1,206 @@
+package ali_mns
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"time"
+
+	"github.com/gogap/errors"
+)
+
+// batchSendEntry is a <Message> or <Error> entry of a batch send response,
+// successful entries carry MessageId, failed ones ErrorCode.
+type batchSendEntry struct {
+	MessageId      string `xml:"MessageId"`
+	MessageBodyMD5 string `xml:"MessageBodyMD5"`
+	Code           string `xml:"Code"`
+	Message        string `xml:"Message"`
+	ErrorCode      string `xml:"ErrorCode"`
+	ErrorMessage   string `xml:"ErrorMessage"`
+	RequestId      string `xml:"RequestId"`
+	HostId         string `xml:"HostId"`
+}
+
+func (p *batchSendEntry) response() (resp MessageSendResponse) {
+	resp.MessageId = p.MessageId
+	resp.MessageBodyMD5 = p.MessageBodyMD5
+	resp.Code = p.Code
+	resp.Message = p.Message
+	resp.RequestId = p.RequestId
+	resp.HostId = p.HostId
+
+	if p.ErrorCode != "" {
+		resp.Code = p.ErrorCode
+		resp.Message = p.ErrorMessage
+	}
+
+	return
+}
+
+// UnmarshalXML keeps the order of mixed success and error entries, so
+// Messages[i] is the result of the i-th sent message.
+func (p *BatchMessageSendResponse) UnmarshalXML(d *xml.Decoder, start xml.StartElement) (err error) {
+	if start.Name.Local != "Messages" {
+		return fmt.Errorf("expected element type <Messages> but have <%s>", start.Name.Local)
+	}
+
+	p.XMLName = start.Name
+	p.Messages = nil
+
+	for {
+		var token xml.Token
+		if token, err = d.Token(); err != nil {
+			return
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			entry := batchSendEntry{}
+			if err = d.DecodeElement(&entry, &t); err != nil {
+				return
+			}
+
+			if t.Name.Local == "Message" || t.Name.Local == "Error" {
+				p.Messages = append(p.Messages, entry.response())
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+func newPartialFailure(failed int, total int, resource string) error {
+	return wrapError(ERR_MNS_BATCH_SEND_PARTIAL_FAILURE.New(errors.Params{"failed": failed, "total": total, "resource": resource}))
+}
+
+func (p *BatchMessageSendResponse) failedEntries() (failed int, total int) {
+	for _, message := range p.Messages {
+		if message.Code != "" {
+			failed++
+		}
+	}
+	return failed, len(p.Messages)
+}
+
+type BatchSendEntryResult struct {
+	Index    int
+	Response MessageSendResponse
+	Code     string
+	Message  string
+}
+
+func (p BatchSendEntryResult) Succeeded() bool {
+	return p.Code == ""
+}
+
+// Err returns the error of a failed entry, built from the template mapped to
+// its code like any other MNS error.
+func (p BatchSendEntryResult) Err() error {
+	if p.Succeeded() {
+		return nil
+	}
+
+	return ParseError(ErrorMessageResponse{
+		Code:      p.Code,
+		Message:   p.Message,
+		RequestId: p.Response.RequestId,
+		HostId:    p.Response.HostId,
+	}, fmt.Sprintf("batch entry %d", p.Index))
+}
+
+// BatchSendResult tells which messages of a batch were sent. Entries are in
+// the order of the sent messages.
+type BatchSendResult struct {
+	Entries   []BatchSendEntryResult
+	RequestId string
+}
+
+// Result returns the per-entry results of a batch send. BatchSendMessage
+// returns them along with ERR_MNS_BATCH_SEND_PARTIAL_FAILURE when only some
+// messages failed.
+func (p BatchMessageSendResponse) Result() (result BatchSendResult) {
+	result.RequestId = p.RequestId
+
+	for i, message := range p.Messages {
+		result.Entries = append(result.Entries, BatchSendEntryResult{
+			Index:    i,
+			Response: message,
+			Code:     message.Code,
+			Message:  message.Message,
+		})
+	}
+
+	return
+}
+
+func (p BatchSendResult) Succeeded() (entries []BatchSendEntryResult) {
+	for _, entry := range p.Entries {
+		if entry.Succeeded() {
+			entries = append(entries, entry)
+		}
+	}
+	return
+}
+
+func (p BatchSendResult) Failed() (entries []BatchSendEntryResult) {
+	for _, entry := range p.Entries {
+		if !entry.Succeeded() {
+			entries = append(entries, entry)
+		}
+	}
+	return
+}
+
+// WithBatchEntryRetry makes BatchSendMessage re-send the entries of a batch
+// that failed with a transient code, up to maxAttempts sends in total with an
+// exponential backoff in between. Entries that still fail are reported as a
+// partial failure.
+func WithBatchEntryRetry(maxAttempts int, baseDelay, maxDelay time.Duration) QueueOption {
+	return func(p *MNSQueue) {
+		p.batchEntryRetry = NewExponentialBackoff(maxAttempts, baseDelay, maxDelay)
+	}
+}
+
+// retryFailedEntries waits out the backoff on ctx, the context of the batch
+// send, so that stopping the receive loops leaves pending retries alone.
+func (p *MNSQueue) retryFailedEntries(ctx context.Context, batchRequest wireBatchMessageSendRequest, resp *BatchMessageSendResponse) (err error) {
+	for attempt := 1; ; attempt++ {
+		var indexes []int
+		retryRequest := wireBatchMessageSendRequest{}
+
+		for _, entry := range resp.Result().Failed() {
+			// failed entries were not enqueued, so they are safe to send
+			// again whatever the idempotence of the request
+			if entry.Index < len(batchRequest.Messages) && Retryable(entry.Err()) {
+				indexes = append(indexes, entry.Index)
+				retryRequest.Messages = append(retryRequest.Messages, batchRequest.Messages[entry.Index])
+			}
+		}
+
+		if len(indexes) == 0 || attempt >= p.batchEntryRetry.MaxAttempts {
+			break
+		}
+
+		if !sleepContext(ctx, p.clock, p.batchEntryRetry.backoff(attempt)) {
+			break
+		}
+
+		retryResp, e := p.batchSend(ctx, retryRequest)
+		if e != nil && !ERR_MNS_BATCH_SEND_PARTIAL_FAILURE.IsEqual(e) {
+			break
+		}
+
+		for i, index := range indexes {
+			if i < len(retryResp.Messages) {
+				resp.Messages[index] = retryResp.Messages[i]
+			}
+		}
+	}
+
+	if failed, total := resp.failedEntries(); failed > 0 {
+		err = newPartialFailure(failed, total, fmt.Sprintf("queues/%s/%s", p.name, "messages"))
+	}
+
+	return
+}
@@ -0,0 +1,119 @@
+package ali_mns
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+const (
+	// MaxBatchSize is the largest total size of the message bodies MNS
+	// accepts in one batch send.
+	MaxBatchSize = 65536
+
+	// MaxBatchMessages is the largest number of messages MNS accepts in
+	// one batch send.
+	MaxBatchMessages = 16
+
+	// batchChunkFailedCode is the Code of the entries of a batch part whose
+	// whole request failed.
+	batchChunkFailedCode = "BatchChunkFailed"
+)
+
+// WithBatchSendConcurrency sends up to concurrency parts of a split batch at
+// the same time. By default parts are sent one after another.
+func WithBatchSendConcurrency(concurrency int) QueueOption {
+	return func(p *MNSQueue) {
+		if concurrency > 0 {
+			p.batchSendConcurrency = concurrency
+		}
+	}
+}
+
+// splitBatch splits messages into batches MNS accepts: at most
+// MaxBatchMessages messages of at most MaxBatchSize bytes together.
+func splitBatch(messages []wireMessageSendRequest) (batches []wireBatchMessageSendRequest) {
+	batch := wireBatchMessageSendRequest{}
+	size := 0
+
+	for _, message := range messages {
+		n := len(message.MessageBody)
+
+		if len(batch.Messages) > 0 && (len(batch.Messages) >= MaxBatchMessages || size+n > MaxBatchSize) {
+			batches = append(batches, batch)
+			batch = wireBatchMessageSendRequest{}
+			size = 0
+		}
+
+		batch.Messages = append(batch.Messages, message)
+		size += n
+	}
+
+	if len(batch.Messages) > 0 {
+		batches = append(batches, batch)
+	}
+
+	return
+}
+
+// batchSendSplit sends every batch and merges the results in order. Entries
+// of a batch whose request failed as a whole get the code
+// "BatchChunkFailed", and the first such error is returned.
+func (p *MNSQueue) batchSendSplit(ctx context.Context, batches []wireBatchMessageSendRequest) (resp BatchMessageSendResponse, err error) {
+	if len(batches) == 1 {
+		return p.batchSendChunk(ctx, batches[0])
+	}
+
+	resps := make([]BatchMessageSendResponse, len(batches))
+	errs := make([]error, len(batches))
+
+	slots := make(chan struct{}, p.batchSendConcurrency)
+	wg := sync.WaitGroup{}
+
+	for i := range batches {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			resps[i], errs[i] = p.batchSendChunk(ctx, batches[i])
+		}(i)
+	}
+
+	wg.Wait()
+
+	for i, batch := range batches {
+		if resp.RequestId == "" {
+			resp.RequestId = resps[i].RequestId
+			resp.Meta = resps[i].Meta
+		}
+
+		if errs[i] == nil || ERR_MNS_BATCH_SEND_PARTIAL_FAILURE.IsEqual(errs[i]) {
+			resp.Messages = append(resp.Messages, resps[i].Messages...)
+			continue
+		}
+
+		if err == nil {
+			err = errs[i]
+		}
+
+		for range batch.Messages {
+			failed := MessageSendResponse{}
+			failed.Code = batchChunkFailedCode
+			failed.Message = errs[i].Error()
+			resp.Messages = append(resp.Messages, failed)
+		}
+	}
+
+	if err != nil {
+		return
+	}
+
+	if failed, total := resp.failedEntries(); failed > 0 {
+		err = newPartialFailure(failed, total, fmt.Sprintf("queues/%s/%s", p.name, "messages"))
+	}
+
+	return
+}
@@ -0,0 +1,229 @@
+package ali_mns_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gogap/ali_mns"
+	"github.com/gogap/ali_mns/alimnstest"
+)
+
+// batchServer serves like alimnstest.Server, but answers the first failing
+// batch sends with a partial failure whose entry failIndex failed with
+// failCode. Every batch send is reported on batches with its message count.
+type batchServer struct {
+	*alimnstest.Server
+	URL string
+
+	failing   int32
+	failIndex int
+	failCode  string
+	batches   chan int
+}
+
+func newBatchServer(t *testing.T, failing int32, failIndex int, failCode string) (server *batchServer) {
+	server = &batchServer{
+		Server:    alimnstest.NewServer(),
+		failing:   failing,
+		failIndex: failIndex,
+		failCode:  failCode,
+		batches:   make(chan int, 100),
+	}
+	t.Cleanup(server.Server.Close)
+
+	wrapper := httptest.NewServer(server)
+	t.Cleanup(wrapper.Close)
+	server.URL = wrapper.URL
+
+	client := ali_mns.NewAliMNSClient(server.URL, "test-id", "test-secret")
+	if err := ali_mns.NewMNSQueueManagerWithClient(client).CreateQueue(server.URL, "test", 0, 65536, 345600, 30, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	return
+}
+
+// queue returns the queue of the server built with opts.
+func (p *batchServer) queue(t *testing.T, opts ...ali_mns.QueueOption) *ali_mns.MNSQueue {
+	client := ali_mns.NewAliMNSClient(p.URL, "test-id", "test-secret")
+
+	queue, err := ali_mns.NewMNSQueueWithOptions("test", client, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return queue.(*ali_mns.MNSQueue)
+}
+
+func (p *batchServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if r.Method != http.MethodPost || !bytes.Contains(body, []byte("<Messages")) {
+		p.Server.ServeHTTP(w, r)
+		return
+	}
+
+	p.batches <- bytes.Count(body, []byte("<Message>"))
+
+	if atomic.AddInt32(&p.failing, -1) < 0 {
+		p.Server.ServeHTTP(w, r)
+		return
+	}
+
+	recorder := httptest.NewRecorder()
+	p.Server.ServeHTTP(recorder, r)
+
+	sent := ali_mns.BatchMessageSendResponse{}
+	if err := xml.Unmarshal(recorder.Body.Bytes(), &sent); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	out := bytes.NewBufferString(xml.Header + `<Messages xmlns="http://mns.aliyuncs.com/doc/v1/">`)
+	for i, message := range sent.Messages {
+		if i == p.failIndex {
+			fmt.Fprintf(out, "<Error><ErrorCode>%s</ErrorCode><ErrorMessage>injected</ErrorMessage></Error>", p.failCode)
+			continue
+		}
+		fmt.Fprintf(out, "<Message><MessageId>%s</MessageId><MessageBodyMD5>%s</MessageBodyMD5></Message>", message.MessageId, message.MessageBodyMD5)
+	}
+	out.WriteString("</Messages>")
+
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(http.StatusInternalServerError)
+	w.Write(out.Bytes())
+}
+
+func newBatch(n int) (messages []ali_mns.MessageSendRequest) {
+	for i := 0; i < n; i++ {
+		messages = append(messages, ali_mns.MessageSendRequest{MessageBody: ali_mns.Base64Bytes(fmt.Sprintf("message %d", i))})
+	}
+	return
+}
+
+func TestBatchEntryRetrySurvivesStop(t *testing.T) {
+	server := newBatchServer(t, 1, 0, "InternalError")
+	queue := server.queue(t, ali_mns.WithBatchEntryRetry(2, 200*time.Millisecond, 200*time.Millisecond))
+
+	type result struct {
+		resp ali_mns.BatchMessageSendResponse
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := queue.BatchSendMessage(newBatch(2)...)
+		done <- result{resp, err}
+	}()
+
+	<-server.batches
+	time.Sleep(50 * time.Millisecond)
+	queue.Stop()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			t.Fatalf("batch send failed: %v", r.err)
+		}
+		if failed := r.resp.Result().Failed(); len(failed) != 0 {
+			t.Fatalf("%d entries failed after the retry", len(failed))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("batch send did not return")
+	}
+
+	if retried := <-server.batches; retried != 1 {
+		t.Fatalf("retry sent %d messages, want 1", retried)
+	}
+}
+
+func TestBatchSendSplit(t *testing.T) {
+	large := func(n int) (messages []ali_mns.MessageSendRequest) {
+		for i := 0; i < n; i++ {
+			messages = append(messages, ali_mns.MessageSendRequest{MessageBody: bytes.Repeat([]byte{'x'}, 20000)})
+		}
+		return
+	}
+
+	for _, test := range []struct {
+		name     string
+		messages []ali_mns.MessageSendRequest
+		batches  []int
+	}{
+		{"One", newBatch(1), []int{1}},
+		{"Full", newBatch(ali_mns.MaxBatchMessages), []int{16}},
+		{"OverCount", newBatch(ali_mns.MaxBatchMessages + 1), []int{16, 1}},
+		{"ManyOverCount", newBatch(40), []int{16, 16, 8}},
+		{"OverSize", large(3), []int{2, 1}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server := newBatchServer(t, 0, 0, "")
+			queue := server.queue(t)
+
+			resp, err := queue.BatchSendMessage(test.messages...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Messages) != len(test.messages) {
+				t.Fatalf("got %d results, want %d", len(resp.Messages), len(test.messages))
+			}
+
+			for i, want := range test.batches {
+				if got := <-server.batches; got != want {
+					t.Fatalf("batch %d holds %d messages, want %d", i, got, want)
+				}
+			}
+			if len(server.batches) != 0 {
+				t.Fatalf("%d more batches sent than the %d expected", len(server.batches), len(test.batches))
+			}
+
+			if active := server.Queue("test").Attributes().ActiveMessages; active != int64(len(test.messages)) {
+				t.Fatalf("queue holds %d messages, want %d", active, len(test.messages))
+			}
+		})
+	}
+}
+
+func TestBatchSendPartialFailure(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		messages int
+		failed   int
+	}{
+		{"SingleBatch", 3, 1},
+		{"FirstOfSplitBatch", ali_mns.MaxBatchMessages + 2, 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server := newBatchServer(t, 1, 1, "InternalError")
+			queue := server.queue(t)
+
+			resp, err := queue.BatchSendMessage(newBatch(test.messages)...)
+			if !ali_mns.ERR_MNS_BATCH_SEND_PARTIAL_FAILURE.IsEqual(err) {
+				t.Fatalf("got error %v, want a partial failure", err)
+			}
+
+			result := resp.Result()
+			if len(result.Entries) != test.messages {
+				t.Fatalf("got %d entries, want %d", len(result.Entries), test.messages)
+			}
+
+			failed := result.Failed()
+			if len(failed) != test.failed {
+				t.Fatalf("%d entries failed, want %d", len(failed), test.failed)
+			}
+			if failed[0].Index != 1 || !ali_mns.ERR_MNS_INTERNAL_ERROR.IsEqual(failed[0].Err()) {
+				t.Fatalf("entry %d failed with %v, want entry 1 with an internal error", failed[0].Index, failed[0].Err())
+			}
+			if succeeded := len(result.Succeeded()); succeeded != test.messages-test.failed {
+				t.Fatalf("%d entries succeeded, want %d", succeeded, test.messages-test.failed)
+			}
+		})
+	}
+}
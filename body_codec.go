@@ -0,0 +1,169 @@
+package ali_mns
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+
+	"github.com/gogap/errors"
+)
+
+// BodyCodec converts message bodies to and from their MessageBody element.
+// MNS itself stores the element as is; this SDK base64 encodes by default,
+// while other SDKs and the console may put plain text there.
+type BodyCodec interface {
+	Encode(body []byte) string
+	Decode(body string) ([]byte, error)
+}
+
+type base64BodyCodec struct{}
+
+func (base64BodyCodec) Encode(body []byte) string {
+	return base64.StdEncoding.EncodeToString(body)
+}
+
+func (base64BodyCodec) Decode(body string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(body)
+}
+
+type rawBodyCodec struct{}
+
+func (rawBodyCodec) Encode(body []byte) string {
+	return string(body)
+}
+
+func (rawBodyCodec) Decode(body string) ([]byte, error) {
+	return []byte(body), nil
+}
+
+var (
+	Base64BodyCodec BodyCodec = base64BodyCodec{}
+	RawBodyCodec    BodyCodec = rawBodyCodec{}
+)
+
+// WithBodyCodec sets how the queue encodes sent and decodes received message
+// bodies, Base64BodyCodec by default.
+func WithBodyCodec(codec BodyCodec) QueueOption {
+	return func(p *MNSQueue) {
+		if codec != nil {
+			p.bodyCodec = codec
+		}
+	}
+}
+
+// checkBodyCodec fails if sent bodies are made binary, which only the
+// Base64BodyCodec carries through the XML of requests intact.
+func (p *MNSQueue) checkBodyCodec() error {
+	if p.bodyCodec == Base64BodyCodec {
+		return nil
+	}
+
+	if p.compressor != nil {
+		return ERR_BODY_CODEC_NOT_BASE64.New(errors.Params{"option": "compression", "name": p.name})
+	}
+
+	if p.keyProvider != nil {
+		return ERR_BODY_CODEC_NOT_BASE64.New(errors.Params{"option": "encryption", "name": p.name})
+	}
+
+	return nil
+}
+
+type wireMessageSendRequest struct {
+	MessageSendRequest
+	MessageBody string `xml:"MessageBody"`
+}
+
+type wireBatchMessageSendRequest struct {
+	XMLName  xml.Name                 `xml:"Messages"`
+	Messages []wireMessageSendRequest `xml:"Message"`
+}
+
+type wireMessageReceiveResponse struct {
+	MessageReceiveResponse
+	MessageBody string `xml:"MessageBody"`
+}
+
+type wireBatchMessageReceiveResponse struct {
+	XMLName   xml.Name                     `xml:"Messages"`
+	Messages  []wireMessageReceiveResponse `xml:"Message"`
+	RequestId string                       `xml:"-"`
+	Meta      ResponseMeta                 `xml:"-"`
+}
+
+func (p *wireBatchMessageReceiveResponse) setResponseMeta(meta ResponseMeta) {
+	p.Meta = meta
+	if meta.RequestId != "" {
+		p.RequestId = meta.RequestId
+	}
+	for i := range p.Messages {
+		p.Messages[i].setResponseMeta(meta)
+	}
+}
+
+// encodeMessage fails with ERR_MNS_MESSAGE_TOO_LARGE if the encoded body
+// exceeds the MaximumMessageSize of the queue.
+func (p *MNSQueue) encodeMessage(message MessageSendRequest) (wire wireMessageSendRequest, err error) {
+	compressed, err := p.compress(message.MessageBody)
+	if err != nil {
+		return
+	}
+
+	encrypted, err := p.encrypt(compressed)
+	if err != nil {
+		return
+	}
+
+	body := p.bodyCodec.Encode(encrypted)
+
+	if p.maxMessageSize > 0 && len(body) > int(p.maxMessageSize) {
+		err = wrapError(ERR_MNS_MESSAGE_TOO_LARGE.New(errors.Params{"size": len(body), "max": p.maxMessageSize, "name": p.name}))
+		return
+	}
+
+	wire = wireMessageSendRequest{
+		MessageSendRequest: message,
+		MessageBody:        body,
+	}
+
+	return
+}
+
+func (p *MNSQueue) decodeMessage(message wireMessageReceiveResponse) (resp MessageReceiveResponse, err error) {
+	resp = message.MessageReceiveResponse
+
+	if err = p.checkMD5(message.MessageId, message.MessageBody, message.MessageBodyMD5); err != nil {
+		return
+	}
+
+	body, e := p.bodyCodec.Decode(message.MessageBody)
+	if e != nil {
+		err = ERR_DECODE_BODY_FAILED.New(errors.Params{"err": e, "body": message.MessageBody})
+		return
+	}
+
+	if body, err = p.decrypt(body); err != nil {
+		return
+	}
+
+	if body, err = decompress(body); err != nil {
+		return
+	}
+	resp.MessageBody = Base64Bytes(body)
+
+	return
+}
+
+func (p *MNSQueue) decodeBatchMessage(messages wireBatchMessageReceiveResponse) (resp BatchMessageReceiveResponse, err error) {
+	resp.RequestId = messages.RequestId
+	resp.Meta = messages.Meta
+
+	for _, message := range messages.Messages {
+		var decoded MessageReceiveResponse
+		if decoded, err = p.decodeMessage(message); err != nil {
+			return
+		}
+		resp.Messages = append(resp.Messages, decoded)
+	}
+
+	return
+}
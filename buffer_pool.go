@@ -0,0 +1,66 @@
+package ali_mns
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// maxPooledBufferSize keeps the buffers of unusually large requests out of
+// the pool.
+const maxPooledBufferSize = 256 << 10
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// pooledBuffer goes back to the pool once every holder released it. The
+// transport may close a request body after the call returned, so both the
+// caller and the request body hold a reference.
+type pooledBuffer struct {
+	*bytes.Buffer
+	refs int32
+}
+
+func newPooledBuffer() *pooledBuffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+
+	return &pooledBuffer{Buffer: buf, refs: 1}
+}
+
+func (p *pooledBuffer) retain() {
+	atomic.AddInt32(&p.refs, 1)
+}
+
+func (p *pooledBuffer) release() {
+	if atomic.AddInt32(&p.refs, -1) != 0 {
+		return
+	}
+
+	if p.Cap() <= maxPooledBufferSize {
+		bufferPool.Put(p.Buffer)
+	}
+	p.Buffer = nil
+}
+
+// pooledBody releases its buffer on the first Close.
+type pooledBody struct {
+	io.ReadCloser
+	buffer *pooledBuffer
+	once   sync.Once
+}
+
+func newPooledBody(body io.ReadCloser, buffer *pooledBuffer) *pooledBody {
+	buffer.retain()
+	return &pooledBody{ReadCloser: body, buffer: buffer}
+}
+
+func (p *pooledBody) Close() (err error) {
+	err = p.ReadCloser.Close()
+	p.once.Do(p.buffer.release)
+	return
+}
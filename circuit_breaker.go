@@ -0,0 +1,144 @@
+package ali_mns
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gogap/errors"
+)
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuitBreaker fails requests fast once an endpoint failed threshold
+// times in a row. After the cool-down one request is let through; the
+// circuit closes if it succeeds and opens again if it fails.
+type circuitBreaker struct {
+	threshold int
+	coolDown  time.Duration
+
+	clock     Clock
+	state     circuitState
+	failures  int
+	openUntil time.Time
+	locker    sync.Mutex
+}
+
+// WithCircuitBreaker makes the client fail fast with ERR_CIRCUIT_BREAKER_OPEN
+// for coolDown after failures consecutive requests could not be sent or got
+// a 502, 503, 504 or InternalError response. Other error responses, e.g. of
+// a missing queue or a partially failed batch send, count as successes.
+func WithCircuitBreaker(failures int, coolDown time.Duration) ClientOption {
+	return func(p *AliMNSClient) {
+		if failures > 0 {
+			p.circuitBreaker = &circuitBreaker{threshold: failures, coolDown: coolDown, clock: SystemClock}
+		}
+	}
+}
+
+func (p *circuitBreaker) allow() (err error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	switch p.state {
+	case circuitOpen:
+		if p.clock.Now().Before(p.openUntil) {
+			break
+		}
+		p.state = circuitHalfOpen
+		return nil
+	case circuitHalfOpen:
+	default:
+		return nil
+	}
+
+	return ERR_CIRCUIT_BREAKER_OPEN.New(errors.Params{"failures": p.failures, "until": p.openUntil.Format(time.RFC3339)})
+}
+
+// record reports whether the circuit opened.
+func (p *circuitBreaker) record(failed bool) (opened bool) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if !failed {
+		p.state = circuitClosed
+		p.failures = 0
+		return
+	}
+
+	p.failures++
+	if p.state == circuitHalfOpen || p.failures >= p.threshold {
+		opened = p.state != circuitOpen
+		p.state = circuitOpen
+		p.openUntil = p.clock.Now().Add(p.coolDown)
+	}
+
+	return
+}
+
+// abandon undoes allow for a request whose outcome is unknown, so the next
+// request may probe the endpoint again.
+func (p *circuitBreaker) abandon() {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if p.state == circuitHalfOpen {
+		p.state = circuitOpen
+	}
+}
+
+// isEndpointFault reports whether resp tells the endpoint is failing. A 500
+// without an MNS body, e.g. from a proxy, counts as a fault too.
+func isEndpointFault(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	case http.StatusInternalServerError:
+	default:
+		return false
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if err != nil {
+		return true
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return true
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "Error":
+			errResp := ErrorMessageResponse{}
+			if decoder.DecodeElement(&errResp, &start) != nil {
+				return true
+			}
+			return errResp.Code == "InternalError"
+		case "Messages":
+			// the partial failure of a batch send
+			return false
+		}
+
+		return true
+	}
+}
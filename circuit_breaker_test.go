@@ -0,0 +1,146 @@
+package ali_mns_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gogap/ali_mns"
+	"github.com/gogap/ali_mns/alimnstest"
+	"github.com/gogap/ali_mns/alimnstest/fixtures"
+)
+
+// newFlakyServer serves like alimnstest.Server, but answers 500 while
+// failing is set.
+func newFlakyServer(t *testing.T) (url string, failing *int32) {
+	failing = new(int32)
+
+	server := alimnstest.NewServer()
+	t.Cleanup(server.Close)
+
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		server.ServeHTTP(w, r)
+	}))
+	t.Cleanup(flaky.Close)
+
+	return flaky.URL, failing
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	type step struct {
+		fail    bool
+		advance time.Duration
+		open    bool
+	}
+
+	for _, test := range []struct {
+		name  string
+		steps []step
+	}{
+		{"StaysClosedBelowThreshold", []step{{fail: true}, {}, {fail: true}, {}}},
+		{"OpensAtThreshold", []step{{fail: true}, {fail: true}, {open: true}, {advance: 30 * time.Second, open: true}}},
+		{"ClosesAfterSuccessfulProbe", []step{{fail: true}, {fail: true}, {advance: time.Minute}, {}, {fail: true}, {}}},
+		{"ReopensAfterFailedProbe", []step{{fail: true}, {fail: true}, {advance: time.Minute, fail: true}, {open: true}}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			url, failing := newFlakyServer(t)
+			clock := alimnstest.NewFakeClock(time.Time{})
+
+			requests := 0
+			client := ali_mns.NewAliMNSClient(url, "test-id", "test-secret",
+				ali_mns.WithCircuitBreaker(2, time.Minute),
+				ali_mns.WithClock(clock),
+				ali_mns.OnRequest(func(ali_mns.Method, string, map[string]string) { requests++ }))
+
+			for i, step := range test.steps {
+				clock.Advance(step.advance)
+
+				if step.fail {
+					atomic.StoreInt32(failing, 1)
+				} else {
+					atomic.StoreInt32(failing, 0)
+				}
+
+				before := requests
+				resp, err := client.Send(ali_mns.GET, nil, nil, "queues")
+				if resp != nil {
+					resp.Body.Close()
+				}
+
+				if open := ali_mns.ERR_CIRCUIT_BREAKER_OPEN.IsEqual(err); open != step.open {
+					t.Fatalf("step %d: circuit open: %t, want %t, err: %v", i, open, step.open, err)
+				}
+				if hooked := requests > before; hooked == step.open {
+					t.Fatalf("step %d: request hooks fired: %t, circuit open: %t", i, hooked, step.open)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerIgnoresCancelledRequests(t *testing.T) {
+	url, _ := newFlakyServer(t)
+	client := ali_mns.NewAliMNSClient(url, "test-id", "test-secret", ali_mns.WithCircuitBreaker(1, time.Minute))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.(ali_mns.ContextSender).SendContext(ctx, ali_mns.GET, nil, nil, "queues"); err == nil {
+			t.Fatal("request with a cancelled context succeeded")
+		}
+	}
+
+	resp, err := client.Send(ali_mns.GET, nil, nil, "queues")
+	if err != nil {
+		t.Fatalf("request after cancelled ones failed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestCircuitBreakerFailures(t *testing.T) {
+	internalError := `<?xml version="1.0" encoding="UTF-8"?><Error xmlns="http://mns.aliyuncs.com/doc/v1/"><Code>InternalError</Code><Message>injected</Message></Error>`
+
+	for _, test := range []struct {
+		name     string
+		status   int
+		body     string
+		wantOpen bool
+	}{
+		{"InternalError", http.StatusInternalServerError, internalError, true},
+		{"BareInternalServerError", http.StatusInternalServerError, "", true},
+		{"BadGateway", http.StatusBadGateway, "", true},
+		{"ServiceUnavailable", http.StatusServiceUnavailable, "", true},
+		{"GatewayTimeout", http.StatusGatewayTimeout, "", true},
+		{"BatchSendPartialFailure", http.StatusInternalServerError, fixtures.BatchSendMessagePartialFailure.Body, false},
+		{"QueueNotExist", http.StatusNotFound, fixtures.QueueNotExistError.Body, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.status)
+				w.Write([]byte(test.body))
+			}))
+			t.Cleanup(server.Close)
+
+			client := ali_mns.NewAliMNSClient(server.URL, "test-id", "test-secret", ali_mns.WithCircuitBreaker(1, time.Minute))
+
+			resp, err := client.Send(ali_mns.POST, nil, nil, "queues/test/messages")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			_, err = client.Send(ali_mns.POST, nil, nil, "queues/test/messages")
+			if open := ali_mns.ERR_CIRCUIT_BREAKER_OPEN.IsEqual(err); open != test.wantOpen {
+				t.Fatalf("circuit open: %t, want %t, err: %v", open, test.wantOpen, err)
+			}
+		})
+	}
+}
@@ -1,37 +1,68 @@
 package ali_mns
 
 import (
+	"bytes"
+	"context"
 	"crypto/md5"
+	"crypto/tls"
 	"encoding/base64"
-	"encoding/xml"
+	"encoding/hex"
 	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"runtime"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/gogap/errors"
-	"github.com/mreiferson/go-httpclient"
 )
 
 const (
-	version = "2015-06-06"
+	version    = "2015-06-06"
+	sdkVersion = "1.0.0"
 )
 
 const (
 	DefaultTimeout int64 = 35
 )
 
+type ConnectionPool struct {
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	IdleConnTimeout     time.Duration
+}
+
 var (
+	DefaultConnectionPool = ConnectionPool{
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: http.DefaultMaxIdleConnsPerHost,
+		IdleConnTimeout:     time.Second * 90,
+	}
+)
+
+const (
+	ENV_ACCESS_KEY_ID     = "ALIBABA_CLOUD_ACCESS_KEY_ID"
+	ENV_ACCESS_KEY_SECRET = "ALIBABA_CLOUD_ACCESS_KEY_SECRET"
+	ENV_SECURITY_TOKEN    = "ALIBABA_CLOUD_SECURITY_TOKEN"
+	ENV_MNS_ENDPOINT      = "MNS_ENDPOINT"
+)
+
+var (
+	// Deprecated: use WithClock, which also controls timers. SystemClock
+	// still reads the time from TimeNowFunc.
 	TimeNowFunc = time.Now
 )
 
 type Method string
 
 var (
-	errMapping map[string]errors.ErrCodeTemplate
+	errMapping       map[string]errors.ErrCodeTemplate
+	errMappingLocker sync.RWMutex
 )
 
 func init() {
@@ -45,23 +76,112 @@ const (
 	DELETE        = "DELETE"
 )
 
-type MNSClient interface {
+type Sender interface {
 	Send(method Method, headers map[string]string, message interface{}, resource string) (resp *http.Response, err error)
+}
+
+type SenderFunc func(method Method, headers map[string]string, message interface{}, resource string) (resp *http.Response, err error)
+
+func (p SenderFunc) Send(method Method, headers map[string]string, message interface{}, resource string) (resp *http.Response, err error) {
+	return p(method, headers, message, resource)
+}
+
+// Middleware wraps every call made through the client. Middlewares run
+// before the request is signed, so headers they add are signed as well.
+// Middlewares needing the context of the call return a ContextSender, e.g. a
+// ContextSenderFunc, and pass the context on with SendWithContext.
+type Middleware func(next Sender) Sender
+
+// ContextSenderFunc is a Sender whose calls carry a context. Called through
+// Send it gets context.Background().
+type ContextSenderFunc func(ctx context.Context, method Method, headers map[string]string, message interface{}, resource string) (resp *http.Response, err error)
+
+func (p ContextSenderFunc) Send(method Method, headers map[string]string, message interface{}, resource string) (resp *http.Response, err error) {
+	return p(context.Background(), method, headers, message, resource)
+}
+
+func (p ContextSenderFunc) SendContext(ctx context.Context, method Method, headers map[string]string, message interface{}, resource string) (resp *http.Response, err error) {
+	return p(ctx, method, headers, message, resource)
+}
+
+// SendWithContext sends through sender with ctx if it is a ContextSender,
+// and without it otherwise.
+func SendWithContext(ctx context.Context, sender Sender, method Method, headers map[string]string, message interface{}, resource string) (resp *http.Response, err error) {
+	if contextSender, ok := sender.(ContextSender); ok {
+		return contextSender.SendContext(ctx, method, headers, message, resource)
+	}
+	return sender.Send(method, headers, message, resource)
+}
+
+// boundSender sends with ctx unless it is given another context, so the
+// call keeps its context through middlewares that only call Send.
+type boundSender struct {
+	ctx  context.Context
+	send ContextSenderFunc
+}
+
+func (p boundSender) Send(method Method, headers map[string]string, message interface{}, resource string) (resp *http.Response, err error) {
+	return p.send(p.ctx, method, headers, message, resource)
+}
+
+func (p boundSender) SendContext(ctx context.Context, method Method, headers map[string]string, message interface{}, resource string) (resp *http.Response, err error) {
+	return p.send(ctx, method, headers, message, resource)
+}
+
+// ContextSender is implemented by clients whose requests can be cancelled.
+// Queues use it to abort in-flight long polls when stopped.
+type ContextSender interface {
+	SendContext(ctx context.Context, method Method, headers map[string]string, message interface{}, resource string) (resp *http.Response, err error)
+}
+
+type MNSClient interface {
+	Sender
 	SetProxy(url string)
 }
 
 type AliMNSClient struct {
-	Timeout     int64
-	url         string
-	credential  Credential
-	accessKeyId string
-	client      *http.Client
-	proxyURL    string
+	Timeout       int64
+	url           string
+	credential    Credential
+	accessKeyId   string
+	securityToken string
+	client        *http.Client
+	proxyURL      string
+
+	customClient    *http.Client
+	customTransport http.RoundTripper
+	tlsConfig       *tls.Config
+
+	retry RetryPolicy
+
+	encoder MNSEncoder
+
+	circuitBreaker *circuitBreaker
+
+	logger Logger
+
+	clock Clock
+
+	middlewares []Middleware
+
+	requestHooks  []RequestHook
+	responseHooks []ResponseHook
+	errorHooks    []ErrorHook
+
+	errorCounter errorCounter
+
+	debug *debugDumper
+
+	userAgent string
+
+	resolver *CachingResolver
+
+	connectionPool ConnectionPool
 
 	clientLocker sync.Mutex
 }
 
-func NewAliMNSClient(url, accessKeyId, accessKeySecret string) MNSClient {
+func NewAliMNSClient(url, accessKeyId, accessKeySecret string, opts ...ClientOption) MNSClient {
 	if url == "" {
 		panic("ali-mns: message queue url is empty")
 	}
@@ -72,52 +192,200 @@ func NewAliMNSClient(url, accessKeyId, accessKeySecret string) MNSClient {
 	aliMNSClient.credential = credential
 	aliMNSClient.accessKeyId = accessKeyId
 	aliMNSClient.url = url
+	aliMNSClient.userAgent = defaultUserAgent()
+	aliMNSClient.connectionPool = DefaultConnectionPool
+	aliMNSClient.encoder = NewAliMNSEncoder()
+	aliMNSClient.logger = NopLogger
+	aliMNSClient.clock = SystemClock
 
 	if globalurl := os.Getenv(GLOBAL_PROXY); globalurl != "" {
 		aliMNSClient.proxyURL = globalurl
 	}
 
+	for _, opt := range opts {
+		opt(aliMNSClient)
+	}
+
+	if aliMNSClient.circuitBreaker != nil {
+		aliMNSClient.circuitBreaker.clock = aliMNSClient.clock
+	}
+
+	if aliMNSClient.credential == nil {
+		panic("ali-mns: credential is nil")
+	}
+
 	aliMNSClient.initClient()
 
 	return aliMNSClient
 }
 
+func defaultUserAgent() string {
+	return fmt.Sprintf("ali_mns-go/%s (%s; %s)", sdkVersion, runtime.GOOS, runtime.GOARCH)
+}
+
+func NewAliMNSClientFromEnv(opts ...ClientOption) (client MNSClient, err error) {
+	url := os.Getenv(ENV_MNS_ENDPOINT)
+	accessKeyId := os.Getenv(ENV_ACCESS_KEY_ID)
+	accessKeySecret := os.Getenv(ENV_ACCESS_KEY_SECRET)
+
+	for _, env := range []struct{ name, value string }{
+		{ENV_MNS_ENDPOINT, url},
+		{ENV_ACCESS_KEY_ID, accessKeyId},
+		{ENV_ACCESS_KEY_SECRET, accessKeySecret},
+	} {
+		if env.value == "" {
+			err = ERR_ENV_VARIABLE_NOT_SET.New(errors.Params{"name": env.name})
+			return
+		}
+	}
+
+	if securityToken := os.Getenv(ENV_SECURITY_TOKEN); securityToken != "" {
+		opts = append([]ClientOption{WithSecurityToken(securityToken)}, opts...)
+	}
+
+	client = NewAliMNSClient(url, accessKeyId, accessKeySecret, opts...)
+
+	return
+}
+
 func (p *AliMNSClient) SetProxy(url string) {
+	p.clientLocker.Lock()
+	defer p.clientLocker.Unlock()
+
 	if url == p.proxyURL {
 		return
 	}
 
 	p.proxyURL = url
+	p.buildClient()
 }
 
 func (p *AliMNSClient) initClient() {
-
 	p.clientLocker.Lock()
 	defer p.clientLocker.Unlock()
 
+	p.buildClient()
+}
+
+// buildClient must be called with clientLocker held. Every proxy change
+// builds a new transport, so requests in flight keep the one they started
+// with.
+func (p *AliMNSClient) buildClient() {
 	timeoutInt := DefaultTimeout
 
 	if p.Timeout > 0 {
 		timeoutInt = p.Timeout
 	}
 
+	if p.customClient != nil {
+		p.client = p.customClient
+		return
+	}
+
 	timeout := time.Second * time.Duration(timeoutInt)
 
-	transport := &httpclient.Transport{
-		Proxy:                 p.proxy,
-		ConnectTimeout:        time.Second * 3,
-		RequestTimeout:        timeout,
+	if p.customTransport != nil {
+		p.client = &http.Client{Transport: p.customTransport, Timeout: timeout + time.Second}
+		return
+	}
+
+	dialer := &net.Dialer{Timeout: time.Second * 3, KeepAlive: time.Second * 30}
+
+	transport := &http.Transport{
+		Proxy:                 proxyFunc(p.proxyURL),
+		DialContext:           dialer.DialContext,
 		ResponseHeaderTimeout: timeout + time.Second,
+		TLSClientConfig:       p.tlsConfig,
+		TLSHandshakeTimeout:   time.Second * 10,
+		MaxIdleConns:          p.connectionPool.MaxIdleConns,
+		MaxIdleConnsPerHost:   p.connectionPool.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       p.connectionPool.MaxConnsPerHost,
+		IdleConnTimeout:       p.connectionPool.IdleConnTimeout,
+	}
+
+	if p.resolver != nil {
+		transport.DialContext = p.resolver.DialContext
+	}
+
+	if p.client != nil {
+		if old, ok := p.client.Transport.(*http.Transport); ok {
+			old.CloseIdleConnections()
+		}
 	}
 
-	p.client = &http.Client{Transport: transport}
+	p.client = &http.Client{Transport: transport, Timeout: timeout}
+}
+
+// Use appends middlewares to the chain. The first middleware registered is
+// the outermost one. The chain is assembled for every call, so middlewares
+// should keep their state outside of the returned Sender.
+func (p *AliMNSClient) Use(middlewares ...Middleware) {
+	p.clientLocker.Lock()
+	defer p.clientLocker.Unlock()
+
+	p.middlewares = append(p.middlewares, middlewares...)
+}
+
+func (p *AliMNSClient) httpClient() *http.Client {
+	p.clientLocker.Lock()
+	defer p.clientLocker.Unlock()
+
+	return p.client
+}
+
+// proxiesRequests reports whether the transport of the client honors the
+// proxy of withRequestProxy, which a custom client or transport does not.
+func (p *AliMNSClient) proxiesRequests() bool {
+	return p.customClient == nil && p.customTransport == nil
+}
+
+func (p *AliMNSClient) proxy() string {
+	p.clientLocker.Lock()
+	defer p.clientLocker.Unlock()
+
+	return p.proxyURL
+}
+
+func (p *AliMNSClient) retryPolicy() RetryPolicy {
+	return p.retry
+}
+
+// parseProxyURL accepts full proxy URLs as well as bare host:port and
+// user:pass@host:port forms, which are treated as http proxies.
+func parseProxyURL(rawURL string) (*url.URL, error) {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	return url.Parse(rawURL)
 }
 
-func (p *AliMNSClient) proxy(req *http.Request) (*url.URL, error) {
-	if p.proxyURL != "" {
-		return url.Parse(p.proxyURL)
+// proxyFunc uses the proxy of the request context if there is one, so a
+// queue can have its own proxy without changing the client for others.
+// Otherwise it prefers the MNS specific proxy settings and falls back to the
+// standard HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables.
+func proxyFunc(rawURL string) func(*http.Request) (*url.URL, error) {
+	clientProxy := http.ProxyFromEnvironment
+	if rawURL != "" {
+		proxyURL, err := parseProxyURL(rawURL)
+		clientProxy = func(*http.Request) (*url.URL, error) {
+			return proxyURL, err
+		}
 	}
-	return nil, nil
+
+	return func(req *http.Request) (*url.URL, error) {
+		if requestProxy, ok := req.Context().Value(proxyContextKey{}).(string); ok {
+			return parseProxyURL(requestProxy)
+		}
+		return clientProxy(req)
+	}
+}
+
+type proxyContextKey struct{}
+
+// withRequestProxy sends the requests made with ctx through the proxy at
+// rawURL. Only the transport AliMNSClient builds honors it.
+func withRequestProxy(ctx context.Context, rawURL string) context.Context {
+	return context.WithValue(ctx, proxyContextKey{}, rawURL)
 }
 
 func (p *AliMNSClient) authorization(method Method, headers map[string]string, resource string) (authHeader string, err error) {
@@ -130,8 +398,74 @@ func (p *AliMNSClient) authorization(method Method, headers map[string]string, r
 	return
 }
 
+// Ping lists at most one queue to verify connectivity and credentials. It
+// is not retried, so latency is the round-trip of a single request.
+func (p *AliMNSClient) Ping() (latency time.Duration, err error) {
+	headers := map[string]string{"x-mns-ret-number": "1"}
+
+	start := p.clock.Now()
+	_, err = sendWithRetry(context.Background(), p, NewAliMNSDecoder(), nil, GET, headers, nil, "queues", &Queues{})
+	latency = p.clock.Now().Sub(start)
+
+	return
+}
+
+// DoRaw signs and sends body as is and returns the raw response, for APIs
+// not wrapped by this package. Non-2xx responses are mapped to MNS errors,
+// rawBody is returned either way. The call is not retried.
+func (p *AliMNSClient) DoRaw(method Method, resource string, headers map[string]string, body []byte) (statusCode int, header http.Header, rawBody []byte, err error) {
+	if body == nil {
+		body = []byte{}
+	}
+
+	var resp *http.Response
+	if resp, err = p.Send(method, headers, body, resource); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	statusCode = resp.StatusCode
+	header = resp.Header
+
+	if rawBody, err = ioutil.ReadAll(resp.Body); err != nil {
+		err = ERR_READ_RESPONSE_BODY_FAILED.New(errors.Params{"err": err})
+		return
+	}
+
+	if !isSuccessStatus(statusCode) {
+		err = decodeErrorResponse(NewAliMNSDecoder(), p.clock, resp, bytes.NewReader(rawBody), resource)
+	}
+
+	return
+}
+
 func (p *AliMNSClient) Send(method Method, headers map[string]string, message interface{}, resource string) (resp *http.Response, err error) {
+	return p.SendContext(context.Background(), method, headers, message, resource)
+}
+
+func (p *AliMNSClient) SendContext(ctx context.Context, method Method, headers map[string]string, message interface{}, resource string) (resp *http.Response, err error) {
+	p.clientLocker.Lock()
+	middlewares := p.middlewares
+	p.clientLocker.Unlock()
+
+	var sender Sender = boundSender{ctx: ctx, send: p.send}
+
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		sender = middlewares[i](sender)
+	}
+
+	return SendWithContext(ctx, sender, method, headers, message, resource)
+}
+
+func (p *AliMNSClient) send(ctx context.Context, method Method, headers map[string]string, message interface{}, resource string) (resp *http.Response, err error) {
+	if p.circuitBreaker != nil {
+		if err = p.circuitBreaker.allow(); err != nil {
+			return
+		}
+	}
+
 	var xmlContent []byte
+	var buffer *pooledBuffer
 
 	if message == nil {
 		xmlContent = []byte{}
@@ -142,17 +476,19 @@ func (p *AliMNSClient) Send(method Method, headers map[string]string, message in
 				xmlContent = m
 			}
 		default:
-			if bXml, e := xml.Marshal(message); e != nil {
+			buffer = newPooledBuffer()
+			defer buffer.release()
+
+			if e := p.encoder.Encode(buffer, message); e != nil {
 				err = ERR_MARSHAL_MESSAGE_FAILED.New(errors.Params{"err": e})
 				return
-			} else {
-				xmlContent = bXml
 			}
+			xmlContent = buffer.Bytes()
 		}
 	}
 
 	xmlMD5 := md5.Sum(xmlContent)
-	strMd5 := fmt.Sprintf("%x", xmlMD5)
+	strMd5 := hex.EncodeToString(xmlMD5[:])
 
 	if headers == nil {
 		headers = make(map[string]string)
@@ -161,10 +497,18 @@ func (p *AliMNSClient) Send(method Method, headers map[string]string, message in
 	headers[MQ_VERSION] = version
 	headers[CONTENT_TYPE] = "application/xml"
 	headers[CONTENT_MD5] = base64.StdEncoding.EncodeToString([]byte(strMd5))
-	headers[DATE] = now().UTC().Format(http.TimeFormat)
+	headers[DATE] = p.clock.Now().UTC().Format(http.TimeFormat)
+
+	if p.securityToken != "" {
+		headers[SECURITY_TOKEN] = p.securityToken
+	}
+
+	if _, exist := headers[USER_AGENT]; !exist {
+		headers[USER_AGENT] = p.userAgent
+	}
 
 	if authHeader, e := p.authorization(method, headers, fmt.Sprintf("/%s", resource)); e != nil {
-		err = ERR_GENERAL_AUTH_HEADER_FAILED.New(errors.Params{"err": e})
+		err = ERR_GENERAL_AUTH_HEADER_FAILED.New(errors.Params{"err": p.redactError(e)})
 		return
 	} else {
 		headers[AUTHORIZATION] = authHeader
@@ -172,20 +516,61 @@ func (p *AliMNSClient) Send(method Method, headers map[string]string, message in
 
 	url := p.url + "/" + resource
 
-	postBodyReader := strings.NewReader(string(xmlContent))
+	postBodyReader := bytes.NewReader(xmlContent)
 
 	var req *http.Request
 	if req, err = http.NewRequest(string(method), url, postBodyReader); err != nil {
 		err = ERR_CREATE_NEW_REQUEST_FAILED.New(errors.Params{"err": err})
 		return
 	}
+	req = req.WithContext(ctx)
+
+	if buffer != nil {
+		req.Body = newPooledBody(req.Body, buffer)
+	}
 
 	for header, value := range headers {
 		req.Header.Add(header, value)
 	}
 
-	if resp, err = p.client.Do(req); err != nil {
-		err = ERR_SEND_REQUEST_FAILED.New(errors.Params{"err": err})
+	p.fireRequestHooks(method, resource, headers)
+
+	if p.debug != nil {
+		p.debug.dumpRequest(method, url, headers, xmlContent)
+	}
+
+	countRequestStart()
+	start := p.clock.Now()
+	resp, err = p.httpClient().Do(req)
+	duration := p.clock.Now().Sub(start)
+	countRequestEnd(resp, err)
+	p.fireResponseHooks(resp, duration, err)
+
+	if p.circuitBreaker != nil {
+		// a cancelled request tells nothing about the endpoint, e.g. a
+		// receive loop aborted by Stop
+		if isCanceled(err) {
+			p.circuitBreaker.abandon()
+		} else if p.circuitBreaker.record(err != nil || isEndpointFault(resp)) {
+			p.logger.Warn("circuit breaker opened", "endpoint", p.url, "cool_down", p.circuitBreaker.coolDown)
+		}
+	}
+
+	if err != nil {
+		p.logger.Warn("send request failed", "method", method, "resource", resource, "duration", duration, "err", p.redactError(err))
+	} else {
+		p.logger.Debug("request sent", "method", method, "resource", resource, "status", resp.StatusCode, "duration", duration, "request_id", resp.Header.Get(MNS_REQUEST_ID))
+	}
+
+	if p.debug != nil {
+		p.debug.dumpResponse(resp, p.redactError(err))
+	}
+
+	if err != nil {
+		err = &MNSError{
+			ErrCode: ERR_SEND_REQUEST_FAILED.New(errors.Params{"err": p.redactError(err)}),
+			cause:   err,
+		}
 		return
 	}
 
@@ -194,38 +579,95 @@ func (p *AliMNSClient) Send(method Method, headers map[string]string, message in
 
 func initMNSErrors() {
 	errMapping = map[string]errors.ErrCodeTemplate{
-		"AccessDenied":               ERR_MNS_ACCESS_DENIED,
-		"InvalidAccessKeyId":         ERR_MNS_INVALID_ACCESS_KEY_ID,
-		"InternalError":              ERR_MNS_INTERNAL_ERROR,
-		"InvalidAuthorizationHeader": ERR_MNS_INVALID_AUTHORIZATION_HEADER,
-		"InvalidDateHeader":          ERR_MNS_INVALID_DATE_HEADER,
-		"InvalidArgument":            ERR_MNS_INVALID_ARGUMENT,
-		"InvalidDegist":              ERR_MNS_INVALID_DEGIST,
-		"InvalidRequestURL":          ERR_MNS_INVALID_REQUEST_URL,
-		"InvalidQueryString":         ERR_MNS_INVALID_QUERY_STRING,
-		"MalformedXML":               ERR_MNS_MALFORMED_XML,
-		"MissingAuthorizationHeader": ERR_MNS_MISSING_AUTHORIZATION_HEADER,
-		"MissingDateHeader":          ERR_MNS_MISSING_DATE_HEADER,
-		"MissingVersionHeader":       ERR_MNS_MISSING_VERSION_HEADER,
-		"MissingReceiptHandle":       ERR_MNS_MISSING_RECEIPT_HANDLE,
-		"MissingVisibilityTimeout":   ERR_MNS_MISSING_VISIBILITY_TIMEOUT,
-		"MessageNotExist":            ERR_MNS_MESSAGE_NOT_EXIST,
-		"QueueDeletedRecently":       ERR_MNS_QUEUE_DELETED_RECENTLY,
-		"InvalidQueueName":           ERR_MNS_INVALID_QUEUE_NAME,
-		"QueueNameLengthError":       ERR_MNS_QUEUE_NAME_LENGTH_ERROR,
-		"QueueNotExist":              ERR_MNS_QUEUE_NOT_EXIST,
-		"ReceiptHandleError":         ERR_MNS_RECEIPT_HANDLE_ERROR,
-		"SignatureDoesNotMatch":      ERR_MNS_SIGNATURE_DOES_NOT_MATCH,
-		"TimeExpired":                ERR_MNS_TIME_EXPIRED,
-		"QpsLimitExceeded":           ERR_MNS_QPS_LIMIT_EXCEEDED,
+		"AccessDenied":                ERR_MNS_ACCESS_DENIED,
+		"InvalidAccessKeyId":          ERR_MNS_INVALID_ACCESS_KEY_ID,
+		"InternalError":               ERR_MNS_INTERNAL_ERROR,
+		"InvalidAuthorizationHeader":  ERR_MNS_INVALID_AUTHORIZATION_HEADER,
+		"InvalidDateHeader":           ERR_MNS_INVALID_DATE_HEADER,
+		"InvalidArgument":             ERR_MNS_INVALID_ARGUMENT,
+		"InvalidDegist":               ERR_MNS_INVALID_DEGIST,
+		"InvalidRequestURL":           ERR_MNS_INVALID_REQUEST_URL,
+		"InvalidQueryString":          ERR_MNS_INVALID_QUERY_STRING,
+		"MalformedXML":                ERR_MNS_MALFORMED_XML,
+		"MissingAuthorizationHeader":  ERR_MNS_MISSING_AUTHORIZATION_HEADER,
+		"MissingDateHeader":           ERR_MNS_MISSING_DATE_HEADER,
+		"MissingVersionHeader":        ERR_MNS_MISSING_VERSION_HEADER,
+		"MissingReceiptHandle":        ERR_MNS_MISSING_RECEIPT_HANDLE,
+		"MissingVisibilityTimeout":    ERR_MNS_MISSING_VISIBILITY_TIMEOUT,
+		"MessageNotExist":             ERR_MNS_MESSAGE_NOT_EXIST,
+		"QueueDeletedRecently":        ERR_MNS_QUEUE_DELETED_RECENTLY,
+		"InvalidQueueName":            ERR_MNS_INVALID_QUEUE_NAME,
+		"QueueNameLengthError":        ERR_MNS_QUEUE_NAME_LENGTH_ERROR,
+		"QueueNotExist":               ERR_MNS_QUEUE_NOT_EXIST,
+		"ReceiptHandleError":          ERR_MNS_RECEIPT_HANDLE_ERROR,
+		"SignatureDoesNotMatch":       ERR_MNS_SIGNATURE_DOES_NOT_MATCH,
+		"TimeExpired":                 ERR_MNS_TIME_EXPIRED,
+		"QpsLimitExceeded":            ERR_MNS_QPS_LIMIT_EXCEEDED,
+		"QueueAlreadyExist":           ERR_MNS_QUEUE_ALREADY_EXIST,
+		"TopicAlreadyExist":           ERR_MNS_TOPIC_ALREADY_EXIST,
+		"TopicNotExist":               ERR_MNS_TOPIC_NOT_EXIST,
+		"TopicNameInvalid":            ERR_MNS_TOPIC_NAME_INVALID,
+		"TopicNameLengthError":        ERR_MNS_TOPIC_NAME_LENGTH_ERROR,
+		"SubscriptionAlreadyExist":    ERR_MNS_SUBSCRIPTION_ALREADY_EXIST,
+		"SubscriptionNotExist":        ERR_MNS_SUBSCRIPTION_NOT_EXIST,
+		"SubscriptionNameInvalid":     ERR_MNS_SUBSCRIPTION_NAME_INVALID,
+		"SubscriptionNameLengthError": ERR_MNS_SUBSCRIPTION_NAME_LENGTH_ERROR,
+		"EndpointInvalid":             ERR_MNS_ENDPOINT_INVALID,
+		"BatchSendFail":               ERR_MNS_BATCH_SEND_FAIL,
+		"BatchDeleteFail":             ERR_MNS_BATCH_DELETE_FAIL,
+		"MessageBodyTooLarge":         ERR_MNS_MESSAGE_BODY_TOO_LARGE,
+		"InvalidMessageTag":           ERR_MNS_INVALID_MESSAGE_TAG,
+	}
+}
+
+// RegisterErrorCode makes error responses with the MNS error code code fail
+// with template, replacing the built-in mapping if there is one. The template
+// is rendered with the params "resp" (an ErrorMessageResponse), "resource"
+// and "name", the queue of the resource if any.
+func RegisterErrorCode(code string, template errors.ErrCodeTemplate) {
+	errMappingLocker.Lock()
+	defer errMappingLocker.Unlock()
+
+	errMapping[code] = template
+}
+
+// queueNameOf returns the queue a resource such as queues/name/messages
+// belongs to, empty for other resources.
+func queueNameOf(resource string) string {
+	if !strings.HasPrefix(resource, "queues/") {
+		return ""
+	}
+
+	name := strings.TrimPrefix(resource, "queues/")
+	if i := strings.IndexAny(name, "/?"); i >= 0 {
+		name = name[:i]
 	}
+
+	return name
 }
 
 func ParseError(resp ErrorMessageResponse, resource string) (err error) {
-	if errCodeTemplate, exist := errMapping[resp.Code]; exist {
-		err = errCodeTemplate.New(errors.Params{"resp": resp, "resource": resource})
+	return parseError(resp, resource, 0)
+}
+
+func parseError(resp ErrorMessageResponse, resource string, statusCode int) (err error) {
+	errMappingLocker.RLock()
+	errCodeTemplate, exist := errMapping[resp.Code]
+	errMappingLocker.RUnlock()
+
+	params := errors.Params{"resp": resp, "resource": resource, "name": queueNameOf(resource)}
+
+	var errCode errors.ErrCode
+	if exist {
+		errCode = errCodeTemplate.New(params)
 	} else {
-		err = ERR_MNS_UNKNOWN_CODE.New(errors.Params{"resp": resp, "resource": resource})
+		errCode = ERR_MNS_UNKNOWN_CODE.New(params)
+	}
+
+	return &MNSError{
+		ErrCode:    errCode,
+		response:   resp,
+		resource:   resource,
+		statusCode: statusCode,
 	}
-	return
 }
@@ -0,0 +1,126 @@
+package ali_mns
+
+import (
+	"crypto/tls"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type ClientOption func(*AliMNSClient)
+
+// WithCredential replaces the built-in HMAC-SHA1 signer, e.g. with a
+// hardware-backed key or a remote signing proxy.
+func WithCredential(credential Credential) ClientOption {
+	return func(p *AliMNSClient) {
+		p.credential = credential
+	}
+}
+
+// WithSecurityToken sets the STS token sent with every request when using
+// temporary credentials.
+func WithSecurityToken(securityToken string) ClientOption {
+	return func(p *AliMNSClient) {
+		p.securityToken = securityToken
+	}
+}
+
+// WithHTTPClient sends every request through httpClient as is. Timeout,
+// proxy and transport settings of the client are not applied to it.
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(p *AliMNSClient) {
+		p.customClient = httpClient
+	}
+}
+
+// WithTransport replaces the internal transport while keeping the client
+// request timeout. Proxy settings are left to the supplied transport.
+func WithTransport(transport http.RoundTripper) ClientOption {
+	return func(p *AliMNSClient) {
+		p.customTransport = transport
+	}
+}
+
+// WithRetry retries transient failures of idempotent calls (and throttled
+// calls of any kind) up to maxAttempts times with jittered exponential
+// backoff.
+func WithRetry(maxAttempts int, baseDelay, maxDelay time.Duration) ClientOption {
+	return func(p *AliMNSClient) {
+		p.retry = NewExponentialBackoff(maxAttempts, baseDelay, maxDelay)
+	}
+}
+
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(p *AliMNSClient) {
+		p.retry = policy
+	}
+}
+
+// WithTLSConfig sets the TLS configuration of the internal transport, e.g.
+// one returned by NewTLSConfig. It has no effect together with
+// WithHTTPClient or WithTransport.
+func WithTLSConfig(config *tls.Config) ClientOption {
+	return func(p *AliMNSClient) {
+		p.tlsConfig = config
+	}
+}
+
+// WithProxy routes requests through the given proxy, which may carry basic
+// auth credentials (user:pass@host:port). It takes precedence over
+// MNS_GLOBAL_PROXY.
+func WithProxy(proxyURL string) ClientOption {
+	return func(p *AliMNSClient) {
+		p.proxyURL = proxyURL
+	}
+}
+
+func WithMiddleware(middlewares ...Middleware) ClientOption {
+	return func(p *AliMNSClient) {
+		p.middlewares = append(p.middlewares, middlewares...)
+	}
+}
+
+// WithUserAgentSuffix appends an application identifier to the default
+// User-Agent, e.g. "order-service/2.3".
+func WithUserAgentSuffix(suffix string) ClientOption {
+	return func(p *AliMNSClient) {
+		if suffix = strings.TrimSpace(suffix); suffix != "" {
+			p.userAgent = defaultUserAgent() + " " + suffix
+		}
+	}
+}
+
+// WithDNSCache resolves the endpoint through resolver instead of hitting
+// DNS on every new connection. A resolver may be shared by many clients, it
+// keeps its own clock rather than the one of WithClock.
+func WithDNSCache(resolver *CachingResolver) ClientOption {
+	return func(p *AliMNSClient) {
+		p.resolver = resolver
+	}
+}
+
+// WithConnectionPool tunes connection reuse of the internal transport.
+// Zero fields keep the values of DefaultConnectionPool.
+func WithConnectionPool(pool ConnectionPool) ClientOption {
+	return func(p *AliMNSClient) {
+		if pool.MaxIdleConns > 0 {
+			p.connectionPool.MaxIdleConns = pool.MaxIdleConns
+		}
+		if pool.MaxIdleConnsPerHost > 0 {
+			p.connectionPool.MaxIdleConnsPerHost = pool.MaxIdleConnsPerHost
+		}
+		if pool.MaxConnsPerHost > 0 {
+			p.connectionPool.MaxConnsPerHost = pool.MaxConnsPerHost
+		}
+		if pool.IdleConnTimeout > 0 {
+			p.connectionPool.IdleConnTimeout = pool.IdleConnTimeout
+		}
+	}
+}
+
+// WithEncoder replaces the XML marshaling of request bodies.
+func WithEncoder(encoder MNSEncoder) ClientOption {
+	return func(p *AliMNSClient) {
+		p.encoder = encoder
+	}
+}
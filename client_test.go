@@ -0,0 +1,84 @@
+package ali_mns_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/gogap/ali_mns"
+	"github.com/gogap/ali_mns/alimnstest"
+)
+
+type contextKey struct{}
+
+func TestMiddlewareContext(t *testing.T) {
+	// passes next.Send on without a context
+	plain := func(next ali_mns.Sender) ali_mns.Sender {
+		return ali_mns.SenderFunc(next.Send)
+	}
+
+	for _, test := range []struct {
+		name   string
+		before []ali_mns.Middleware
+		after  []ali_mns.Middleware
+		want   interface{}
+	}{
+		{"Alone", nil, nil, "caller"},
+		{"BehindPlain", []ali_mns.Middleware{plain}, nil, nil},
+		{"InFrontOfPlain", nil, []ali_mns.Middleware{plain}, "caller"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var got interface{}
+			tracing := func(next ali_mns.Sender) ali_mns.Sender {
+				return ali_mns.ContextSenderFunc(func(ctx context.Context, method ali_mns.Method, headers map[string]string, message interface{}, resource string) (*http.Response, error) {
+					if ali_mns.OperationName(method, message, resource) == "SendMessage" {
+						got = ctx.Value(contextKey{})
+					}
+					return ali_mns.SendWithContext(ctx, next, method, headers, message, resource)
+				})
+			}
+
+			middlewares := append(append(test.before, tracing), test.after...)
+
+			server := alimnstest.NewServer()
+			defer server.Close()
+
+			client := ali_mns.NewAliMNSClient(server.URL, "test-id", "test-secret", ali_mns.WithMiddleware(middlewares...))
+			if err := ali_mns.NewMNSQueueManagerWithClient(client).CreateQueue(server.URL, "test", 0, 65536, 345600, 30, 0); err != nil {
+				t.Fatal(err)
+			}
+
+			queue, err := ali_mns.NewMNSQueueWithOptions("test", client)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.WithValue(context.Background(), contextKey{}, "caller")
+			if _, err := queue.(ali_mns.ContextMessageSender).SendMessageContext(ctx, ali_mns.MessageSendRequest{MessageBody: []byte("traced")}); err != nil {
+				t.Fatal(err)
+			}
+
+			if got != test.want {
+				t.Errorf("middleware got context value %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMiddlewareKeepsCancellation(t *testing.T) {
+	plain := func(next ali_mns.Sender) ali_mns.Sender {
+		return ali_mns.SenderFunc(next.Send)
+	}
+
+	server := alimnstest.NewServer()
+	defer server.Close()
+
+	client := ali_mns.NewAliMNSClient(server.URL, "test-id", "test-secret", ali_mns.WithMiddleware(plain))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := client.(ali_mns.ContextSender).SendContext(ctx, ali_mns.GET, nil, nil, "queues"); err == nil {
+		t.Fatal("request with a cancelled context succeeded")
+	}
+}
@@ -0,0 +1,126 @@
+package ali_mns
+
+import (
+	"context"
+	"time"
+)
+
+// Clock tells the time and waits for clients, queues, their rate limiters
+// and consumers, so tests can control time with a fake such as
+// alimnstest.FakeClock. Queue managers, producers and dedup stores use the
+// clock of the client or queue they work with, DNS caches have their own,
+// see WithResolverClock.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+type systemClock struct{}
+
+// Now honors TimeNowFunc, for code still overriding it.
+func (systemClock) Now() time.Time {
+	return now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (p systemTimer) C() <-chan time.Time {
+	return p.Timer.C
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (p systemTicker) C() <-chan time.Time {
+	return p.Ticker.C
+}
+
+// SystemClock is the real time, it is the default clock.
+var SystemClock Clock = systemClock{}
+
+// clockHolder lets queues and consumers default to the clock of the client
+// or queue they use.
+type clockHolder interface {
+	getClock() Clock
+}
+
+func clockOf(v interface{}) Clock {
+	if holder, ok := v.(clockHolder); ok {
+		return holder.getClock()
+	}
+	return SystemClock
+}
+
+func WithClock(clock Clock) ClientOption {
+	return func(p *AliMNSClient) {
+		if clock != nil {
+			p.clock = clock
+		}
+	}
+}
+
+// WithQueueClock overrides the clock the queue takes from its client.
+func WithQueueClock(clock Clock) QueueOption {
+	return func(p *MNSQueue) {
+		if clock != nil {
+			p.clock = clock
+		}
+	}
+}
+
+// WithConsumerClock overrides the clock the consumer takes from its queue.
+func WithConsumerClock(clock Clock) ConsumerOption {
+	return func(p *Consumer) {
+		if clock != nil {
+			p.clock = clock
+		}
+	}
+}
+
+func (p *AliMNSClient) getClock() Clock {
+	return p.clock
+}
+
+func (p *MNSQueue) getClock() Clock {
+	return p.clock
+}
+
+// sleepContext sleeps for d on clock and reports false if ctx is done
+// before.
+func sleepContext(ctx context.Context, clock Clock, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := clock.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
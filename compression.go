@@ -0,0 +1,170 @@
+package ali_mns
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/gogap/errors"
+)
+
+const (
+	DefaultCompressMinSize = 1024
+)
+
+// MaxDecompressedSize is the largest body a compressed message may expand
+// to. Bigger ones fail to decompress, so a small message cannot make a
+// consumer allocate without bound.
+var MaxDecompressedSize int64 = 4 << 20
+
+// compressedMagic prefixes compressed bodies, followed by the ID of the
+// Compressor, so receivers detect them whatever their own settings.
+var compressedMagic = []byte{0x00, 'm', 'z'}
+
+// Compressor compresses message bodies. IDs 0-15 are reserved for the
+// compressors of this package and its subpackages. Decompress should fail
+// without expanding bodies beyond MaxDecompressedSize.
+type Compressor interface {
+	ID() byte
+	Compress(body []byte) ([]byte, error)
+	Decompress(body []byte) ([]byte, error)
+}
+
+var (
+	compressors       = map[byte]Compressor{}
+	compressorsLocker sync.RWMutex
+)
+
+// RegisterCompressor makes bodies compressed by c decompressed on receive.
+func RegisterCompressor(c Compressor) {
+	compressorsLocker.Lock()
+	defer compressorsLocker.Unlock()
+
+	compressors[c.ID()] = c
+}
+
+func init() {
+	RegisterCompressor(GzipCompressor)
+}
+
+type gzipCompressor struct {
+	level int
+}
+
+var GzipCompressor Compressor = NewGzipCompressor(gzip.DefaultCompression)
+
+func NewGzipCompressor(level int) Compressor {
+	return &gzipCompressor{level: level}
+}
+
+func (p *gzipCompressor) ID() byte {
+	return 1
+}
+
+func (p *gzipCompressor) Compress(body []byte) (compressed []byte, err error) {
+	buf := bytes.Buffer{}
+
+	var writer *gzip.Writer
+	if writer, err = gzip.NewWriterLevel(&buf, p.level); err != nil {
+		return
+	}
+
+	if _, err = writer.Write(body); err != nil {
+		return
+	}
+
+	if err = writer.Close(); err != nil {
+		return
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (p *gzipCompressor) Decompress(body []byte) (decompressed []byte, err error) {
+	var reader *gzip.Reader
+	if reader, err = gzip.NewReader(bytes.NewReader(body)); err != nil {
+		return
+	}
+	defer reader.Close()
+
+	if decompressed, err = ioutil.ReadAll(io.LimitReader(reader, MaxDecompressedSize+1)); err != nil {
+		return
+	}
+
+	if int64(len(decompressed)) > MaxDecompressedSize {
+		return nil, errDecompressedTooLarge()
+	}
+
+	return
+}
+
+func errDecompressedTooLarge() error {
+	return fmt.Errorf("decompressed body exceeds %d bytes", MaxDecompressedSize)
+}
+
+// WithCompression compresses sent bodies of at least minSize bytes,
+// DefaultCompressMinSize by default, when that makes them smaller.
+// Compressed bodies are binary, so NewMNSQueueWithOptions fails unless the
+// queue uses the Base64BodyCodec.
+func WithCompression(c Compressor, minSize ...int) QueueOption {
+	return func(p *MNSQueue) {
+		p.compressor = c
+		p.compressMinSize = DefaultCompressMinSize
+		if len(minSize) == 1 && minSize[0] >= 0 {
+			p.compressMinSize = minSize[0]
+		}
+	}
+}
+
+func (p *MNSQueue) compress(body []byte) (compressed []byte, err error) {
+	if p.compressor == nil || len(body) < p.compressMinSize {
+		return body, nil
+	}
+
+	data, e := p.compressor.Compress(body)
+	if e != nil {
+		err = ERR_COMPRESS_BODY_FAILED.New(errors.Params{"err": e})
+		return
+	}
+
+	if len(compressedMagic)+1+len(data) >= len(body) {
+		return body, nil
+	}
+
+	compressed = make([]byte, 0, len(compressedMagic)+1+len(data))
+	compressed = append(compressed, compressedMagic...)
+	compressed = append(compressed, p.compressor.ID())
+	compressed = append(compressed, data...)
+
+	return
+}
+
+// decompress returns body as is unless it carries the magic of a registered
+// Compressor. Bodies expanding beyond MaxDecompressedSize fail.
+func decompress(body []byte) (decompressed []byte, err error) {
+	if len(body) <= len(compressedMagic) || !bytes.HasPrefix(body, compressedMagic) {
+		return body, nil
+	}
+
+	compressorsLocker.RLock()
+	c, exist := compressors[body[len(compressedMagic)]]
+	compressorsLocker.RUnlock()
+
+	if !exist {
+		return body, nil
+	}
+
+	if decompressed, err = c.Decompress(body[len(compressedMagic)+1:]); err != nil {
+		err = ERR_DECOMPRESS_BODY_FAILED.New(errors.Params{"err": err})
+		return
+	}
+
+	if int64(len(decompressed)) > MaxDecompressedSize {
+		return nil, ERR_DECOMPRESS_BODY_FAILED.New(errors.Params{"err": errDecompressedTooLarge()})
+	}
+
+	return
+}
@@ -0,0 +1,105 @@
+package ali_mns_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogap/ali_mns"
+	"github.com/gogap/ali_mns/alimnstest"
+)
+
+func TestCompressionRoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		body       string
+		compressed bool
+	}{
+		{"Small", "small body", false},
+		{"Compressible", strings.Repeat("compressible ", 1000), true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server, queue := newTestQueue(t, ali_mns.WithCompression(ali_mns.GzipCompressor))
+
+			if _, err := queue.SendStringMessage(test.body); err != nil {
+				t.Fatal(err)
+			}
+
+			wire := peekWireBody(t, server.Queue("test"))
+			if compressed := len(wire) < len(test.body); compressed != test.compressed {
+				t.Errorf("sent %d bytes for a body of %d, compressed: %t, want %t", len(wire), len(test.body), compressed, test.compressed)
+			}
+
+			resp, err := receiveOne(t, queue)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(resp.MessageBody) != test.body {
+				t.Errorf("received %q, want %q", resp.MessageBody, test.body)
+			}
+		})
+	}
+}
+
+// peekWireBody returns the body of the next message of queue as sent by
+// the client, base64 decoded.
+func peekWireBody(t *testing.T, queue *alimnstest.FakeQueue) []byte {
+	t.Helper()
+
+	respChan := make(chan ali_mns.MessageReceiveResponse, 1)
+	errChan := make(chan error, 1)
+	go queue.PeekMessage(respChan, errChan)
+	defer queue.Stop()
+
+	var resp ali_mns.MessageReceiveResponse
+	select {
+	case resp = <-respChan:
+	case err := <-errChan:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message peeked within 5s")
+	}
+
+	body, err := base64.StdEncoding.DecodeString(string(resp.MessageBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestCompressionNeedsBase64BodyCodec(t *testing.T) {
+	server := alimnstest.NewServer()
+	defer server.Close()
+
+	client := ali_mns.NewAliMNSClient(server.URL, "test-id", "test-secret")
+	if err := ali_mns.NewMNSQueueManagerWithClient(client).CreateQueue(server.URL, "test", 0, 65536, 345600, 30, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := ali_mns.NewMNSQueueWithOptions("test", client, ali_mns.WithBodyCodec(ali_mns.RawBodyCodec), ali_mns.WithCompression(ali_mns.GzipCompressor))
+	if !ali_mns.ERR_BODY_CODEC_NOT_BASE64.IsEqual(err) {
+		t.Fatalf("got %v, want ERR_BODY_CODEC_NOT_BASE64", err)
+	}
+}
+
+func TestDecompressionLimit(t *testing.T) {
+	server, queue := newTestQueue(t)
+
+	buf := bytes.Buffer{}
+	writer := gzip.NewWriter(&buf)
+	writer.Write(make([]byte, ali_mns.MaxDecompressedSize+1))
+	writer.Close()
+
+	// the magic of gzip compressed bodies, followed by the compressed body
+	body := append([]byte{0x00, 'm', 'z', 1}, buf.Bytes()...)
+	if _, err := server.Queue("test").SendMessage(ali_mns.MessageSendRequest{MessageBody: []byte(base64.StdEncoding.EncodeToString(body))}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := receiveOne(t, queue); !ali_mns.ERR_DECOMPRESS_BODY_FAILED.IsEqual(err) {
+		t.Fatalf("got %v, want ERR_DECOMPRESS_BODY_FAILED", err)
+	}
+}
@@ -0,0 +1,463 @@
+package ali_mns
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gogap/errors"
+)
+
+var (
+	DefaultNackVisibilityTimeout int64 = 1
+)
+
+// MessageHandler processes one message. Returning nil deletes the message,
+// returning an error makes it visible again for redelivery.
+type MessageHandler func(message MessageReceiveResponse) error
+
+type ConsumerOption func(*Consumer)
+
+// WithRateLimit caps how many messages per second are handed to the
+// handler, independent of the API QPS limit of the queue.
+func WithRateLimit(messagesPerSecond float64) ConsumerOption {
+	return func(p *Consumer) {
+		if messagesPerSecond > 0 {
+			p.rateLimiter = newTokenBucket(messagesPerSecond, 1)
+		}
+	}
+}
+
+// WithConcurrency sets how many messages are handled at the same time.
+// Receiving pauses while all workers are busy.
+func WithConcurrency(workers int) ConsumerOption {
+	return func(p *Consumer) {
+		if workers > 0 {
+			p.concurrency = workers
+		}
+	}
+}
+
+func WithWaitSeconds(waitSeconds int64) ConsumerOption {
+	return func(p *Consumer) {
+		p.waitSeconds = []int64{waitSeconds}
+	}
+}
+
+// WithNackVisibilityTimeout sets how many seconds a failed message stays
+// invisible before it is redelivered.
+func WithNackVisibilityTimeout(seconds int64) ConsumerOption {
+	return func(p *Consumer) {
+		if seconds > 0 {
+			p.nackVisibilityTimeout = seconds
+		}
+	}
+}
+
+// WithErrorHandler receives receive, delete and visibility errors, which
+// are otherwise dropped. Empty polls (MessageNotExist) are not reported.
+func WithErrorHandler(handler func(err error)) ConsumerOption {
+	return func(p *Consumer) {
+		p.errorHandler = handler
+	}
+}
+
+type Consumer struct {
+	queue        AliMNSQueue
+	handler      MessageHandler
+	batchHandler BatchMessageHandler
+	batchSize    int32
+
+	concurrency           int
+	waitSeconds           []int64
+	nackVisibilityTimeout int64
+	heartbeatTimeout      int64
+	errorHandler          func(err error)
+
+	deadLetterQueue AliMNSQueue
+	maxDequeueCount int64
+
+	dedupStore  DedupStore
+	dedupWindow time.Duration
+	dedupLease  time.Duration
+	dedupKey    DedupKeyFunc
+
+	partitionKey PartitionKeyFunc
+	rateLimiter  *tokenBucket
+	sharedSlots  chan struct{}
+
+	running  bool
+	stopChan chan bool
+	doneChan chan bool
+	locker   sync.Mutex
+
+	inflight       map[*inflightMessage]bool
+	inflightLocker sync.Mutex
+
+	counters consumerCounters
+
+	logger Logger
+	clock  Clock
+}
+
+type inflightMessage struct {
+	message   MessageReceiveResponse
+	heartbeat *visibilityHeartbeat
+	settled   bool
+	locker    sync.Mutex
+}
+
+// settle stops the heartbeat and claims the message for acknowledgement.
+// It returns false if the message was already settled, i.e. released by
+// Shutdown while its handler was still running.
+func (p *inflightMessage) settle() (message MessageReceiveResponse, ok bool) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if p.settled {
+		return p.message, false
+	}
+	p.settled = true
+
+	if p.heartbeat != nil {
+		p.message.ReceiptHandle = p.heartbeat.stop()
+	}
+
+	return p.message, true
+}
+
+func NewConsumer(queue AliMNSQueue, handler MessageHandler, opts ...ConsumerOption) *Consumer {
+	if handler == nil {
+		panic("ali_mns: consumer handler could not be nil")
+	}
+
+	consumer := newConsumer(queue, opts...)
+	consumer.handler = handler
+
+	return consumer
+}
+
+func newConsumer(queue AliMNSQueue, opts ...ConsumerOption) *Consumer {
+	if queue == nil {
+		panic("ali_mns: consumer queue could not be nil")
+	}
+
+	consumer := &Consumer{
+		queue:                 queue,
+		concurrency:           1,
+		batchSize:             DefaultNumOfMessages,
+		nackVisibilityTimeout: DefaultNackVisibilityTimeout,
+		dedupLease:            DefaultDedupLease,
+		inflight:              make(map[*inflightMessage]bool),
+		logger:                loggerOf(queue),
+		clock:                 clockOf(queue),
+	}
+
+	for _, opt := range opts {
+		opt(consumer)
+	}
+
+	if consumer.rateLimiter != nil {
+		consumer.rateLimiter.setClock(consumer.clock)
+	}
+
+	if store, ok := consumer.dedupStore.(*MemoryDedupStore); ok {
+		store.setClock(consumer.clock)
+	}
+
+	return consumer
+}
+
+// Start begins consuming in the background. It is a no-op if the consumer
+// is already running.
+func (p *Consumer) Start() {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if p.running {
+		return
+	}
+
+	p.running = true
+	p.stopChan = make(chan bool)
+	p.doneChan = make(chan bool)
+
+	p.logger.Info("consumer started", "queue", p.queue.Name(), "concurrency", p.concurrency)
+
+	if p.batchHandler != nil {
+		go p.runBatch(p.stopChan, p.doneChan)
+		return
+	}
+
+	go p.run(p.stopChan, p.doneChan)
+}
+
+// Stop stops receiving and waits for the messages being handled to finish.
+func (p *Consumer) Stop() {
+	p.Shutdown(context.Background())
+}
+
+// Shutdown stops receiving new messages and waits for in-flight handlers to
+// complete; their messages are acknowledged as usual. If ctx is done first,
+// the messages of handlers still running are made visible again and the
+// error of ctx is returned. Those handlers keep running but their result is
+// ignored.
+func (p *Consumer) Shutdown(ctx context.Context) (err error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if !p.running {
+		return
+	}
+
+	close(p.stopChan)
+	p.running = false
+
+	select {
+	case <-p.doneChan:
+		p.logger.Info("consumer stopped", "queue", p.queue.Name())
+	case <-ctx.Done():
+		p.releaseInflight()
+		err = ctx.Err()
+		p.logger.Warn("consumer shutdown timed out, released in-flight messages", "queue", p.queue.Name(), "err", err)
+	}
+
+	return
+}
+
+func (p *Consumer) releaseInflight() {
+	p.inflightLocker.Lock()
+	inflight := make([]*inflightMessage, 0, len(p.inflight))
+	for message := range p.inflight {
+		inflight = append(inflight, message)
+	}
+	p.inflightLocker.Unlock()
+
+	for _, message := range inflight {
+		if m, ok := message.settle(); ok {
+			p.nack(m)
+		}
+	}
+}
+
+func (p *Consumer) run(stopChan, doneChan chan bool) {
+	defer close(doneChan)
+
+	respChan := make(chan MessageReceiveResponse)
+	errChan := make(chan error)
+	loopDone := make(chan bool)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		defer close(loopDone)
+		if receiver, ok := p.queue.(ContextReceiver); ok {
+			receiver.ReceiveMessageContext(ctx, respChan, errChan, p.waitSeconds...)
+			return
+		}
+		p.queue.ReceiveMessage(respChan, errChan, p.waitSeconds...)
+	}()
+
+	pool := newWorkerPool(p.concurrency, p.partitionKey, p.process)
+
+	defer func() {
+		pool.close()
+		p.stopReceiving(cancel)
+		p.drain(respChan, errChan, loopDone)
+		pool.wait()
+	}()
+
+	for {
+		select {
+		case message := <-respChan:
+			if !p.waitRateLimit(stopChan, 1) {
+				p.nack(message)
+				return
+			}
+
+			select {
+			case pool.jobsFor(message) <- message:
+			case <-stopChan:
+				p.nack(message)
+				return
+			}
+		case err := <-errChan:
+			p.onReceiveError(err)
+		case <-stopChan:
+			return
+		}
+	}
+}
+
+// stopReceiving ends the receive loop of the consumer, by cancel if the
+// queue is a ContextReceiver. Other queues can only be stopped as a whole,
+// ending every loop running on them.
+func (p *Consumer) stopReceiving(cancel context.CancelFunc) {
+	cancel()
+
+	if _, ok := p.queue.(ContextReceiver); !ok {
+		p.queue.Stop()
+	}
+}
+
+// waitRateLimit waits for n messages worth of rate and reports false if
+// the consumer was stopped while waiting.
+func (p *Consumer) waitRateLimit(stopChan chan bool, n int) bool {
+	if p.rateLimiter == nil {
+		return true
+	}
+
+	var delay time.Duration
+	for i := 0; i < n; i++ {
+		delay = p.rateLimiter.reserve()
+	}
+
+	if delay <= 0 {
+		return true
+	}
+
+	timer := p.clock.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+		return true
+	case <-stopChan:
+		return false
+	}
+}
+
+// drain releases messages the receive loop delivers while it winds down.
+func (p *Consumer) drain(respChan chan MessageReceiveResponse, errChan chan error, loopDone chan bool) {
+	for {
+		select {
+		case message := <-respChan:
+			p.nack(message)
+		case <-errChan:
+		case <-loopDone:
+			return
+		}
+	}
+}
+
+func (p *Consumer) process(message MessageReceiveResponse) {
+	p.acquireSlot()
+	defer p.releaseSlot()
+
+	if !p.admit(message) {
+		return
+	}
+
+	inflight := p.startInflight(message)
+	defer p.untrack(inflight)
+
+	err := p.handle(message)
+	p.finishDedup(message, err)
+
+	message, ok := inflight.settle()
+	if !ok {
+		return
+	}
+
+	p.countHandled(err)
+
+	if err != nil {
+		p.nack(message)
+		return
+	}
+
+	p.ack(message)
+}
+
+// admit settles dead-lettered and duplicate messages itself and reports
+// whether the message should go to the handler.
+func (p *Consumer) admit(message MessageReceiveResponse) bool {
+	atomic.AddInt64(&p.counters.received, 1)
+
+	if p.shouldDeadLetter(message) {
+		p.deadLetter(message)
+		return false
+	}
+
+	switch p.checkDuplicate(message) {
+	case dedupProcessed:
+		atomic.AddInt64(&p.counters.duplicates, 1)
+		p.ack(message)
+		return false
+	case dedupInFlight:
+		p.nack(message)
+		return false
+	}
+
+	return true
+}
+
+func (p *Consumer) startInflight(message MessageReceiveResponse) *inflightMessage {
+	inflight := &inflightMessage{message: message}
+	if p.heartbeatTimeout > 0 {
+		inflight.heartbeat = p.startHeartbeat(message)
+	}
+
+	p.track(inflight)
+
+	return inflight
+}
+
+// handle turns a panicking handler into an error, which is reported and
+// nacks the message like any other failure.
+func (p *Consumer) handle(message MessageReceiveResponse) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = ERR_HANDLER_PANIC.New(errors.Params{"id": message.MessageId, "panic": r, "stack": string(debug.Stack())})
+			p.onError(err)
+		}
+	}()
+
+	return p.handler(message)
+}
+
+func (p *Consumer) track(message *inflightMessage) {
+	p.inflightLocker.Lock()
+	defer p.inflightLocker.Unlock()
+
+	p.inflight[message] = true
+}
+
+func (p *Consumer) untrack(message *inflightMessage) {
+	p.inflightLocker.Lock()
+	defer p.inflightLocker.Unlock()
+
+	delete(p.inflight, message)
+}
+
+func (p *Consumer) ack(message MessageReceiveResponse) {
+	if err := p.queue.DeleteMessage(message.ReceiptHandle); err != nil {
+		p.onError(err)
+		return
+	}
+	atomic.AddInt64(&p.counters.acked, 1)
+}
+
+func (p *Consumer) nack(message MessageReceiveResponse) {
+	if _, err := p.queue.ChangeMessageVisibility(message.ReceiptHandle, p.nackVisibilityTimeout); err != nil {
+		p.onError(err)
+		return
+	}
+	atomic.AddInt64(&p.counters.nacked, 1)
+}
+
+func (p *Consumer) onReceiveError(err error) {
+	if ERR_MNS_MESSAGE_NOT_EXIST.IsEqual(err) {
+		return
+	}
+	p.onError(err)
+}
+
+func (p *Consumer) onError(err error) {
+	p.logger.Error("consumer error", "queue", p.queue.Name(), "err", err)
+
+	if p.errorHandler != nil {
+		p.errorHandler(err)
+	}
+}
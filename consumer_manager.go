@@ -0,0 +1,159 @@
+package ali_mns
+
+import (
+	"context"
+	"sync"
+)
+
+// QueueMessageHandler is the MessageHandler of a ConsumerManager, told which
+// queue the message came from.
+type QueueMessageHandler func(queueName string, message MessageReceiveResponse) error
+
+// ConsumerManager runs one Consumer per queue. All of them share a pool of
+// concurrency handler slots and are shut down together. A consumer takes a
+// slot before it looks at a received message, so messages waiting for a
+// slot are not counted or deduplicated yet.
+type ConsumerManager struct {
+	handler QueueMessageHandler
+	opts    []ConsumerOption
+	slots   chan struct{}
+
+	consumers map[string]*Consumer
+	running   bool
+	locker    sync.Mutex
+}
+
+func NewConsumerManager(handler QueueMessageHandler, concurrency int, opts ...ConsumerOption) *ConsumerManager {
+	if handler == nil {
+		panic("ali_mns: consumer handler could not be nil")
+	}
+
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	slots := make(chan struct{}, concurrency)
+
+	return &ConsumerManager{
+		handler:   handler,
+		opts:      append([]ConsumerOption{WithConcurrency(concurrency), withSharedSlots(slots)}, opts...),
+		slots:     slots,
+		consumers: make(map[string]*Consumer),
+	}
+}
+
+// AddQueues starts consuming the given queues, right away if the manager
+// is running. Queues already managed are skipped.
+func (p *ConsumerManager) AddQueues(queues ...AliMNSQueue) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	for _, queue := range queues {
+		if _, exist := p.consumers[queue.Name()]; exist {
+			continue
+		}
+
+		name := queue.Name()
+		consumer := NewConsumer(queue, func(message MessageReceiveResponse) error {
+			return p.handler(name, message)
+		}, p.opts...)
+
+		p.consumers[name] = consumer
+
+		if p.running {
+			consumer.Start()
+		}
+	}
+}
+
+// DiscoverQueues lists every queue of endpoint whose name starts with prefix
+// and adds it to the manager. It stops at the first queue it fails to open.
+func (p *ConsumerManager) DiscoverQueues(client MNSClient, manager AliQueueManager, endpoint string, prefix string) (names []string, err error) {
+	iter := NewQueueIterator(manager, endpoint, prefix)
+	for iter.Next() {
+		name := iter.Queue().Name()
+		names = append(names, name)
+
+		if p.manages(name) {
+			continue
+		}
+
+		var queue AliMNSQueue
+		if queue, err = NewMNSQueueWithOptions(name, client); err != nil {
+			return
+		}
+		p.AddQueues(queue)
+	}
+
+	return names, iter.Err()
+}
+
+func (p *ConsumerManager) manages(queueName string) bool {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	_, exist := p.consumers[queueName]
+	return exist
+}
+
+func (p *ConsumerManager) Start() {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.running = true
+	for _, consumer := range p.consumers {
+		consumer.Start()
+	}
+}
+
+func (p *ConsumerManager) Stop() {
+	p.Shutdown(context.Background())
+}
+
+// Shutdown shuts every consumer down in parallel, see Consumer.Shutdown.
+func (p *ConsumerManager) Shutdown(ctx context.Context) (err error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.running = false
+
+	errs := make(chan error, len(p.consumers))
+	wg := sync.WaitGroup{}
+
+	for _, consumer := range p.consumers {
+		wg.Add(1)
+		go func(consumer *Consumer) {
+			defer wg.Done()
+			errs <- consumer.Shutdown(ctx)
+		}(consumer)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for e := range errs {
+		if e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return
+}
+
+func withSharedSlots(slots chan struct{}) ConsumerOption {
+	return func(p *Consumer) {
+		p.sharedSlots = slots
+	}
+}
+
+func (p *Consumer) acquireSlot() {
+	if p.sharedSlots != nil {
+		p.sharedSlots <- struct{}{}
+	}
+}
+
+func (p *Consumer) releaseSlot() {
+	if p.sharedSlots != nil {
+		<-p.sharedSlots
+	}
+}
@@ -0,0 +1,48 @@
+package ali_mns
+
+import (
+	"sync/atomic"
+)
+
+// ConsumerStats counts the messages of a consumer since it was created.
+// Processed and Failed count handler results, Acked and Nacked the
+// successful deletes and visibility changes, whatever their cause.
+type ConsumerStats struct {
+	Received     int64 `json:"received"`
+	Processed    int64 `json:"processed"`
+	Failed       int64 `json:"failed"`
+	Acked        int64 `json:"acked"`
+	Nacked       int64 `json:"nacked"`
+	DeadLettered int64 `json:"dead_lettered"`
+	Duplicates   int64 `json:"duplicates"`
+}
+
+type consumerCounters struct {
+	received     int64
+	processed    int64
+	failed       int64
+	acked        int64
+	nacked       int64
+	deadLettered int64
+	duplicates   int64
+}
+
+func (p *Consumer) Stats() ConsumerStats {
+	return ConsumerStats{
+		Received:     atomic.LoadInt64(&p.counters.received),
+		Processed:    atomic.LoadInt64(&p.counters.processed),
+		Failed:       atomic.LoadInt64(&p.counters.failed),
+		Acked:        atomic.LoadInt64(&p.counters.acked),
+		Nacked:       atomic.LoadInt64(&p.counters.nacked),
+		DeadLettered: atomic.LoadInt64(&p.counters.deadLettered),
+		Duplicates:   atomic.LoadInt64(&p.counters.duplicates),
+	}
+}
+
+func (p *Consumer) countHandled(err error) {
+	if err != nil {
+		atomic.AddInt64(&p.counters.failed, 1)
+		return
+	}
+	atomic.AddInt64(&p.counters.processed, 1)
+}
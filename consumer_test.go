@@ -0,0 +1,222 @@
+package ali_mns_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gogap/ali_mns"
+)
+
+func TestConsumerShutdownRightAfterStart(t *testing.T) {
+	_, queue := newTestQueue(t)
+
+	for i := 0; i < 50; i++ {
+		consumer := ali_mns.NewConsumer(queue, func(ali_mns.MessageReceiveResponse) error { return nil }, ali_mns.WithWaitSeconds(1))
+		consumer.Start()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		err := consumer.Shutdown(ctx)
+		cancel()
+
+		if err != nil {
+			t.Fatalf("iteration %d: %s", i, err)
+		}
+	}
+}
+
+func TestConsumerStopRightAfterStart(t *testing.T) {
+	_, queue := newTestQueue(t)
+
+	for i := 0; i < 50; i++ {
+		consumer := ali_mns.NewBatchConsumer(queue, func([]ali_mns.MessageReceiveResponse) []error { return nil }, ali_mns.WithWaitSeconds(1))
+		consumer.Start()
+
+		done := make(chan bool)
+		go func() {
+			defer close(done)
+			consumer.Stop()
+		}()
+
+		waitClosed(t, done, 5*time.Second, "Stop")
+	}
+}
+
+func TestConsumerShutdownLeavesSharedQueueRunning(t *testing.T) {
+	_, queue := newTestQueue(t)
+
+	first := ali_mns.NewConsumer(queue, func(ali_mns.MessageReceiveResponse) error { return nil }, ali_mns.WithWaitSeconds(1))
+
+	handled := make(chan string, 10)
+	second := ali_mns.NewConsumer(queue, func(message ali_mns.MessageReceiveResponse) error {
+		handled <- message.MessageId
+		return nil
+	}, ali_mns.WithWaitSeconds(1))
+
+	first.Start()
+	second.Start()
+	defer second.Stop()
+
+	time.Sleep(20 * time.Millisecond)
+	first.Stop()
+
+	resp, err := queue.SendStringMessage("for the second consumer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case id := <-handled:
+		if id != resp.MessageId {
+			t.Fatalf("handled %s, want %s", id, resp.MessageId)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stopping a consumer stopped the other consumer of the queue")
+	}
+}
+
+func TestConsumersSendAndStopConcurrently(t *testing.T) {
+	server, queue := newTestQueue(t)
+
+	const messages = 100
+
+	handled := make(map[string]bool)
+	locker := sync.Mutex{}
+	handler := func(message ali_mns.MessageReceiveResponse) error {
+		locker.Lock()
+		defer locker.Unlock()
+
+		handled[message.MessageId] = true
+		return nil
+	}
+
+	consumers := []*ali_mns.Consumer{
+		ali_mns.NewConsumer(queue, handler, ali_mns.WithConcurrency(4), ali_mns.WithWaitSeconds(1)),
+		ali_mns.NewConsumer(queue, handler, ali_mns.WithConcurrency(2), ali_mns.WithWaitSeconds(1)),
+	}
+	for _, consumer := range consumers {
+		consumer.Start()
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < messages/4; j++ {
+				if _, err := queue.SendStringMessage("message"); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		locker.Lock()
+		n := len(handled)
+		locker.Unlock()
+
+		if n == messages {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("handled %d of %d messages", n, messages)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stopped := sync.WaitGroup{}
+	for _, consumer := range consumers {
+		stopped.Add(1)
+		go func(consumer *ali_mns.Consumer) {
+			defer stopped.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if err := consumer.Shutdown(ctx); err != nil {
+				t.Error(err)
+			}
+		}(consumer)
+	}
+	stopped.Wait()
+
+	if attr := server.Queue("test").Attributes(); attr.ActiveMessages+attr.InactiveMessages != 0 {
+		t.Fatalf("%d messages left in the queue", attr.ActiveMessages+attr.InactiveMessages)
+	}
+}
+
+func TestConsumerDedup(t *testing.T) {
+	for _, test := range []struct {
+		name           string
+		bodies         []string
+		failFirst      bool
+		staleClaim     bool
+		wantCalls      int32
+		wantDuplicates int64
+		wantNacked     int64
+	}{
+		// the copy received while the first one is handled comes back
+		// and is then deleted as a duplicate
+		{"ConcurrentCopiesHandledOnce", []string{"same", "same"}, false, false, 1, 1, 1},
+		{"FailedMessageHandledAgain", []string{"once"}, true, false, 2, 0, 1},
+		// the claim of a consumer that died while handling expires
+		{"StaleClaimExpires", []string{"once"}, false, true, 1, 0, 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, queue := newTestQueue(t)
+
+			store := ali_mns.NewMemoryDedupStore()
+			if test.staleClaim {
+				key := ali_mns.DedupByBodyHash(ali_mns.MessageReceiveResponse{MessageBody: []byte(test.bodies[0])})
+				if _, err := store.AddIfAbsent("claim:"+key, 200*time.Millisecond); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var calls int32
+			consumer := ali_mns.NewConsumer(queue, func(ali_mns.MessageReceiveResponse) error {
+				if atomic.AddInt32(&calls, 1) == 1 && test.failFirst {
+					return errors.New("failed")
+				}
+				time.Sleep(100 * time.Millisecond)
+				return nil
+			},
+				ali_mns.WithDedup(store, time.Minute, ali_mns.DedupByBodyHash),
+				ali_mns.WithDedupLease(200*time.Millisecond),
+				ali_mns.WithConcurrency(2),
+				ali_mns.WithNackVisibilityTimeout(1),
+				ali_mns.WithWaitSeconds(1))
+
+			for _, body := range test.bodies {
+				if _, err := queue.SendStringMessage(body); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			consumer.Start()
+			defer consumer.Stop()
+
+			deadline := time.Now().Add(5 * time.Second)
+			for consumer.Stats().Acked < int64(len(test.bodies)) {
+				if time.Now().After(deadline) {
+					t.Fatalf("acked %d of %d messages", consumer.Stats().Acked, len(test.bodies))
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			if calls := atomic.LoadInt32(&calls); calls != test.wantCalls {
+				t.Fatalf("handler called %d times, want %d", calls, test.wantCalls)
+			}
+			if stats := consumer.Stats(); stats.Duplicates != test.wantDuplicates || stats.Nacked != test.wantNacked {
+				t.Fatalf("%d duplicates and %d nacked, want %d and %d", stats.Duplicates, stats.Nacked, test.wantDuplicates, test.wantNacked)
+			}
+		})
+	}
+}
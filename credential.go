@@ -12,13 +12,17 @@ import (
 )
 
 const (
-	AUTHORIZATION = "Authorization"
-	CONTENT_TYPE  = "Content-Type"
-	CONTENT_MD5   = "Content-MD5"
-	MQ_VERSION    = "x-mns-version"
-	HOST          = "Host"
-	DATE          = "Date"
-	KEEP_ALIVE    = "Keep-Alive"
+	AUTHORIZATION  = "Authorization"
+	CONTENT_TYPE   = "Content-Type"
+	CONTENT_MD5    = "Content-MD5"
+	MQ_VERSION     = "x-mns-version"
+	HOST           = "Host"
+	DATE           = "Date"
+	KEEP_ALIVE     = "Keep-Alive"
+	SECURITY_TOKEN = "security-token"
+	MNS_REQUEST_ID = "x-mns-request-id"
+	USER_AGENT     = "User-Agent"
+	RETRY_AFTER    = "Retry-After"
 )
 
 type Credential interface {
@@ -0,0 +1,26 @@
+package ali_mns_test
+
+import (
+	"testing"
+
+	"github.com/gogap/ali_mns"
+)
+
+func BenchmarkSignature(b *testing.B) {
+	credential := ali_mns.NewAliMNSCredential("benchmark-secret")
+	headers := map[string]string{
+		ali_mns.CONTENT_TYPE: "application/xml",
+		ali_mns.CONTENT_MD5:  "ZjA0NTQ1MzE5ODE3ZGE5YWZkMWViNDc5NDQ2ZTYyMmE=",
+		ali_mns.DATE:         "Thu, 15 Oct 2026 08:00:00 GMT",
+		ali_mns.MQ_VERSION:   "2015-06-06",
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := credential.Signature(ali_mns.POST, headers, "/queues/test/messages"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package ali_mns
+
+import (
+	"sync/atomic"
+)
+
+// WithDeadLetterQueue moves messages that have been received more than
+// maxDequeueCount times to deadLetterQueue instead of handling them again.
+func WithDeadLetterQueue(deadLetterQueue AliMNSQueue, maxDequeueCount int64) ConsumerOption {
+	return func(p *Consumer) {
+		p.deadLetterQueue = deadLetterQueue
+		p.maxDequeueCount = maxDequeueCount
+	}
+}
+
+func (p *Consumer) shouldDeadLetter(message MessageReceiveResponse) bool {
+	return p.deadLetterQueue != nil &&
+		p.maxDequeueCount > 0 &&
+		message.DequeueCount > p.maxDequeueCount
+}
+
+// deadLetter copies the message to the dead-letter queue and only then
+// deletes the original. If the copy fails the message is left on the source
+// queue; if the delete fails it may end up in the dead-letter queue twice.
+func (p *Consumer) deadLetter(message MessageReceiveResponse) {
+	request := MessageSendRequest{
+		MessageBody: message.MessageBody,
+		Priority:    message.Priority,
+	}
+
+	if _, err := p.deadLetterQueue.SendMessage(request); err != nil {
+		p.onError(err)
+		p.nack(message)
+		return
+	}
+
+	atomic.AddInt64(&p.counters.deadLettered, 1)
+	fireMessageEvent(p.queue, MessageEvent{
+		Type:          MessageDeadLettered,
+		MessageId:     message.MessageId,
+		ReceiptHandle: message.ReceiptHandle,
+		DequeueCount:  message.DequeueCount,
+	})
+	p.ack(message)
+}
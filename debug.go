@@ -0,0 +1,88 @@
+package ali_mns
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type debugDumper struct {
+	writer io.Writer
+	locker sync.Mutex
+}
+
+// WithDebug dumps every request (credentials redacted) and raw response to
+// w. It is meant for diagnosing signature and MalformedXML problems.
+func WithDebug(w io.Writer) ClientOption {
+	return func(p *AliMNSClient) {
+		if w == nil {
+			p.debug = nil
+			return
+		}
+		p.debug = &debugDumper{writer: w}
+	}
+}
+
+func (p *debugDumper) dumpRequest(method Method, url string, headers map[string]string, body []byte) {
+	buf := bytes.NewBuffer(nil)
+	fmt.Fprintf(buf, "---> %s %s\n", method, url)
+	writeDebugHeaders(buf, redactHeaders(headers))
+	fmt.Fprintf(buf, "\n%s\n", body)
+
+	p.write(buf.Bytes())
+}
+
+// dumpResponse reads the whole body and puts an in-memory copy back on resp.
+func (p *debugDumper) dumpResponse(resp *http.Response, errMsg string) {
+	buf := bytes.NewBuffer(nil)
+
+	if resp == nil {
+		fmt.Fprintf(buf, "<--- error: %s\n\n", errMsg)
+		p.write(buf.Bytes())
+		return
+	}
+
+	fmt.Fprintf(buf, "<--- %s\n", resp.Status)
+
+	headers := map[string]string{}
+	for name := range resp.Header {
+		headers[name] = resp.Header.Get(name)
+	}
+	writeDebugHeaders(buf, redactHeaders(headers))
+
+	body, e := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if e != nil {
+		fmt.Fprintf(buf, "\nread body failed: %s\n\n", e)
+	} else {
+		fmt.Fprintf(buf, "\n%s\n\n", body)
+	}
+
+	p.write(buf.Bytes())
+}
+
+func (p *debugDumper) write(data []byte) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.writer.Write(data)
+}
+
+func writeDebugHeaders(w io.Writer, headers map[string]string) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(w, "%s: %s\n", name, strings.TrimSpace(headers[name]))
+	}
+}
@@ -10,15 +10,35 @@ type MNSDecoder interface {
 }
 
 type AliMNSDecoder struct {
+	strict bool
 }
 
-func NewAliMNSDecoder() MNSDecoder {
-	return &AliMNSDecoder{}
+type DecoderOption func(*AliMNSDecoder)
+
+// WithStrictDecoding makes the decoder fail on elements the target has no
+// field for, on missing elements of fields without omitempty and on
+// responses that are not UTF-8, to catch changes of the MNS API early.
+func WithStrictDecoding() DecoderOption {
+	return func(p *AliMNSDecoder) {
+		p.strict = true
+	}
+}
+
+func NewAliMNSDecoder(opts ...DecoderOption) MNSDecoder {
+	decoder := &AliMNSDecoder{}
+	for _, opt := range opts {
+		opt(decoder)
+	}
+	return decoder
 }
 
 func (p *AliMNSDecoder) Decode(reader io.Reader, v interface{}) (err error) {
+	if p.strict {
+		return decodeStrict(reader, v)
+	}
+
 	decoder := xml.NewDecoder(reader)
-	err = decoder.Decode(&v)
+	err = decoder.Decode(v)
 
 	return
 }
@@ -0,0 +1,76 @@
+package ali_mns_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/gogap/ali_mns"
+)
+
+func BenchmarkDecodeMessage(b *testing.B) {
+	body := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<Message xmlns="http://mns.aliyuncs.com/doc/v1/">
+  <MessageId>5F290C926D472878-2-14D9529A8FA-200000001</MessageId>
+  <ReceiptHandle>1-ODU4OTkzNDU5My0xNDMyNzI3ODI3LTItOA==</ReceiptHandle>
+  <MessageBodyMD5>C5DD56A39F5F7BB8B3337C6D11B6D8C7</MessageBodyMD5>
+  <MessageBody>` + base64.StdEncoding.EncodeToString(benchmarkBody) + `</MessageBody>
+  <EnqueueTime>1250700979248</EnqueueTime>
+  <NextVisibleTime>1250700799348</NextVisibleTime>
+  <FirstDequeueTime>1250700779318</FirstDequeueTime>
+  <DequeueCount>1</DequeueCount>
+  <Priority>8</Priority>
+</Message>`)
+
+	for _, bench := range []struct {
+		name    string
+		decoder ali_mns.MNSDecoder
+	}{
+		{"Default", ali_mns.NewAliMNSDecoder()},
+		{"Strict", ali_mns.NewAliMNSDecoder(ali_mns.WithStrictDecoding())},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(benchmarkBody)))
+
+			for i := 0; i < b.N; i++ {
+				resp := ali_mns.MessageReceiveResponse{}
+				if err := bench.decoder.Decode(bytes.NewReader(body), &resp); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestQueueAttributeJSONAliases(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		json        string
+		delay       int32
+		pollingWait int32
+	}{
+		{"Released", `{"delay_senconds":5,"polling_wait_secods":10}`, 5, 10},
+		{"Corrected", `{"delay_seconds":5,"polling_wait_seconds":10}`, 5, 10},
+		{"Neither", `{"visibility_timeout":30}`, 0, 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			attr := ali_mns.QueueAttribute{}
+			if err := json.Unmarshal([]byte(test.json), &attr); err != nil {
+				t.Fatal(err)
+			}
+			if attr.DelaySeconds != test.delay || attr.PollingWaitSeconds != test.pollingWait {
+				t.Errorf("got DelaySeconds %d, PollingWaitSeconds %d, want %d, %d", attr.DelaySeconds, attr.PollingWaitSeconds, test.delay, test.pollingWait)
+			}
+
+			req := ali_mns.CreateQueueRequest{}
+			if err := json.Unmarshal([]byte(test.json), &req); err != nil {
+				t.Fatal(err)
+			}
+			if req.DelaySeconds != test.delay || req.PollingWaitSeconds != test.pollingWait {
+				t.Errorf("got DelaySeconds %d, PollingWaitSeconds %d, want %d, %d", req.DelaySeconds, req.PollingWaitSeconds, test.delay, test.pollingWait)
+			}
+		})
+	}
+}
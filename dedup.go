@@ -0,0 +1,242 @@
+package ali_mns
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// DedupStore remembers processed messages so a consumer can skip the
+// duplicates MNS at-least-once delivery produces.
+type DedupStore interface {
+	Exists(key string) (exist bool, err error)
+	Add(key string, window time.Duration) (err error)
+}
+
+// AtomicDedupStore is implemented by stores that can check and add a key in
+// one step. Consumers then claim a message with AddIfAbsent for a short
+// lease before handling it, so two consumers never both handle it, and
+// Remove the claim once the handler returned.
+type AtomicDedupStore interface {
+	AddIfAbsent(key string, window time.Duration) (added bool, err error)
+	Remove(key string) (err error)
+}
+
+var (
+	DefaultDedupWindow = time.Hour
+
+	// DefaultDedupLease is the default visibility timeout of MNS queues.
+	DefaultDedupLease = time.Second * 30
+)
+
+// dedupClaimPrefix tells the claim of a message being handled from the key
+// of a processed one.
+const dedupClaimPrefix = "claim:"
+
+type DedupKeyFunc func(message MessageReceiveResponse) string
+
+func DedupByMessageId(message MessageReceiveResponse) string {
+	return message.MessageId
+}
+
+// DedupByBodyHash treats messages with the same body as duplicates, which
+// also catches a producer sending the same payload twice.
+func DedupByBodyHash(message MessageReceiveResponse) string {
+	sum := md5.Sum(message.MessageBody)
+	return hex.EncodeToString(sum[:])
+}
+
+// WithDedup skips messages whose key was processed successfully within
+// window; duplicates are deleted without calling the handler. Keys default
+// to DedupByMessageId. With an AtomicDedupStore a message is also claimed
+// while it is handled, see WithDedupLease.
+func WithDedup(store DedupStore, window time.Duration, keyFunc ...DedupKeyFunc) ConsumerOption {
+	return func(p *Consumer) {
+		if window <= 0 {
+			window = DefaultDedupWindow
+		}
+		p.dedupStore = store
+		p.dedupWindow = window
+		p.dedupKey = DedupByMessageId
+		if len(keyFunc) == 1 && keyFunc[0] != nil {
+			p.dedupKey = keyFunc[0]
+		}
+	}
+}
+
+// WithDedupLease sets how long the claim on a message being handled lasts,
+// about the visibility timeout of the queue. Copies received meanwhile are
+// released for redelivery rather than deleted, and the claim of a consumer
+// that died while handling expires after lease.
+func WithDedupLease(lease time.Duration) ConsumerOption {
+	return func(p *Consumer) {
+		if lease > 0 {
+			p.dedupLease = lease
+		}
+	}
+}
+
+type dedupState int
+
+const (
+	dedupNew dedupState = iota
+	dedupProcessed
+	dedupInFlight
+)
+
+// checkDuplicate claims new messages on an AtomicDedupStore. It reports
+// errors of the store and then treats the message as new, preferring a
+// duplicate over a lost message.
+func (p *Consumer) checkDuplicate(message MessageReceiveResponse) dedupState {
+	if p.dedupStore == nil {
+		return dedupNew
+	}
+
+	key := p.dedupKey(message)
+
+	if p.isProcessed(key) {
+		return dedupProcessed
+	}
+
+	store, ok := p.dedupStore.(AtomicDedupStore)
+	if !ok {
+		return dedupNew
+	}
+
+	claimed, err := store.AddIfAbsent(dedupClaimPrefix+key, p.dedupLease)
+	if err != nil {
+		p.onError(err)
+		return dedupNew
+	}
+
+	if !claimed {
+		return dedupInFlight
+	}
+
+	// the holder of the previous claim may have finished in between
+	if p.isProcessed(key) {
+		p.releaseClaim(key)
+		return dedupProcessed
+	}
+
+	return dedupNew
+}
+
+func (p *Consumer) isProcessed(key string) bool {
+	exist, err := p.dedupStore.Exists(key)
+	if err != nil {
+		p.onError(err)
+		return false
+	}
+
+	return exist
+}
+
+func (p *Consumer) releaseClaim(key string) {
+	store, ok := p.dedupStore.(AtomicDedupStore)
+	if !ok {
+		return
+	}
+
+	if err := store.Remove(dedupClaimPrefix + key); err != nil {
+		p.onError(err)
+	}
+}
+
+// finishDedup remembers a message handled without err for the dedup window
+// and releases its claim.
+func (p *Consumer) finishDedup(message MessageReceiveResponse, err error) {
+	if p.dedupStore == nil {
+		return
+	}
+
+	key := p.dedupKey(message)
+
+	if err == nil {
+		if e := p.dedupStore.Add(key, p.dedupWindow); e != nil {
+			p.onError(e)
+		}
+	}
+
+	p.releaseClaim(key)
+}
+
+// MemoryDedupStore keeps keys in memory. It tells time by the clock of the
+// consumer it is used by.
+type MemoryDedupStore struct {
+	entries   map[string]time.Time
+	lastSweep time.Time
+	clock     Clock
+	locker    sync.Mutex
+}
+
+func NewMemoryDedupStore() *MemoryDedupStore {
+	return &MemoryDedupStore{
+		entries:   make(map[string]time.Time),
+		lastSweep: SystemClock.Now(),
+		clock:     SystemClock,
+	}
+}
+
+func (p *MemoryDedupStore) setClock(clock Clock) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.clock = clock
+	p.lastSweep = clock.Now()
+}
+
+func (p *MemoryDedupStore) Exists(key string) (exist bool, err error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	expireAt, exist := p.entries[key]
+	if exist && p.clock.Now().After(expireAt) {
+		delete(p.entries, key)
+		exist = false
+	}
+
+	return
+}
+
+func (p *MemoryDedupStore) Add(key string, window time.Duration) (err error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	now := p.clock.Now()
+	p.entries[key] = now.Add(window)
+
+	if now.Sub(p.lastSweep) > time.Minute {
+		for k, expireAt := range p.entries {
+			if now.After(expireAt) {
+				delete(p.entries, k)
+			}
+		}
+		p.lastSweep = now
+	}
+
+	return
+}
+
+func (p *MemoryDedupStore) AddIfAbsent(key string, window time.Duration) (added bool, err error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if expireAt, exist := p.entries[key]; exist && !p.clock.Now().After(expireAt) {
+		return false, nil
+	}
+
+	p.entries[key] = p.clock.Now().Add(window)
+
+	return true, nil
+}
+
+func (p *MemoryDedupStore) Remove(key string) (err error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	delete(p.entries, key)
+
+	return
+}
@@ -0,0 +1,192 @@
+package ali_mns
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	DefaultDepthMonitorInterval = time.Minute
+)
+
+type DepthMetric int
+
+const (
+	ActiveMessages DepthMetric = iota
+	InactiveMessages
+	DelayMessages
+)
+
+func (p DepthMetric) String() string {
+	switch p {
+	case ActiveMessages:
+		return "ActiveMessages"
+	case InactiveMessages:
+		return "InactiveMessages"
+	case DelayMessages:
+		return "DelayMessages"
+	}
+	return "Unknown"
+}
+
+func (p DepthMetric) value(attr QueueAttribute) int64 {
+	switch p {
+	case InactiveMessages:
+		return attr.InactiveMessages
+	case DelayMessages:
+		return attr.DelayMessages
+	}
+	return attr.ActiveMessages
+}
+
+// DepthThreshold calls OnAbove when Metric of Queue rises above Threshold
+// and OnBelow when it falls back to Threshold or below. Either may be nil.
+type DepthThreshold struct {
+	Queue     string
+	Metric    DepthMetric
+	Threshold int64
+	OnAbove   func(attr QueueAttribute)
+	OnBelow   func(attr QueueAttribute)
+}
+
+// DepthMonitor polls the attributes of queues and fires the callbacks of
+// their thresholds when they are crossed, e.g. to scale consumers or alert.
+// Nothing fires on the first poll of a queue that is below its threshold.
+type DepthMonitor struct {
+	manager  AliQueueManager
+	endpoint string
+	interval time.Duration
+
+	thresholds   []*depthThreshold
+	errorHandler func(queue string, err error)
+
+	stopChan chan bool
+	doneChan chan bool
+	locker   sync.Mutex
+}
+
+type depthThreshold struct {
+	DepthThreshold
+	above bool
+}
+
+func NewDepthMonitor(manager AliQueueManager, endpoint string, interval time.Duration) *DepthMonitor {
+	if interval <= 0 {
+		interval = DefaultDepthMonitorInterval
+	}
+
+	return &DepthMonitor{
+		manager:  manager,
+		endpoint: endpoint,
+		interval: interval,
+	}
+}
+
+func (p *DepthMonitor) AddThreshold(threshold DepthThreshold) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.thresholds = append(p.thresholds, &depthThreshold{DepthThreshold: threshold})
+}
+
+// OnError receives the errors of polling a queue, which are otherwise
+// dropped.
+func (p *DepthMonitor) OnError(handler func(queue string, err error)) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.errorHandler = handler
+}
+
+// Start polls in the background, right away and then every interval. It is
+// a no-op if the monitor is already running.
+func (p *DepthMonitor) Start() {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if p.stopChan != nil {
+		return
+	}
+
+	p.stopChan = make(chan bool)
+	p.doneChan = make(chan bool)
+
+	go p.run(p.stopChan, p.doneChan)
+}
+
+func (p *DepthMonitor) Stop() {
+	p.locker.Lock()
+	stopChan, doneChan := p.stopChan, p.doneChan
+	p.stopChan, p.doneChan = nil, nil
+	p.locker.Unlock()
+
+	if stopChan == nil {
+		return
+	}
+
+	close(stopChan)
+	<-doneChan
+}
+
+func (p *DepthMonitor) run(stopChan, doneChan chan bool) {
+	defer close(doneChan)
+
+	clock := SystemClock
+	if manager, ok := p.manager.(*MNSQueueManager); ok {
+		clock = clockOf(manager.clientFor(p.endpoint))
+	}
+
+	ticker := clock.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.poll()
+
+		select {
+		case <-ticker.C():
+		case <-stopChan:
+			return
+		}
+	}
+}
+
+func (p *DepthMonitor) poll() {
+	p.locker.Lock()
+	thresholds := append([]*depthThreshold(nil), p.thresholds...)
+	errorHandler := p.errorHandler
+	p.locker.Unlock()
+
+	attrs := map[string]QueueAttribute{}
+	failed := map[string]bool{}
+
+	for _, threshold := range thresholds {
+		if failed[threshold.Queue] {
+			continue
+		}
+
+		attr, exist := attrs[threshold.Queue]
+		if !exist {
+			var err error
+			if attr, err = p.manager.GetQueueAttributes(p.endpoint, threshold.Queue); err != nil {
+				failed[threshold.Queue] = true
+				if errorHandler != nil {
+					errorHandler(threshold.Queue, err)
+				}
+				continue
+			}
+			attrs[threshold.Queue] = attr
+		}
+
+		above := threshold.Metric.value(attr) > threshold.Threshold
+		if above == threshold.above {
+			continue
+		}
+		threshold.above = above
+
+		if above && threshold.OnAbove != nil {
+			threshold.OnAbove(attr)
+		} else if !above && threshold.OnBelow != nil {
+			threshold.OnBelow(attr)
+		}
+	}
+}
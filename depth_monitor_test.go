@@ -0,0 +1,107 @@
+package ali_mns_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gogap/ali_mns"
+	"github.com/gogap/ali_mns/alimnstest"
+)
+
+func TestDepthMonitor(t *testing.T) {
+	clock := alimnstest.NewFakeClock(time.Time{})
+
+	server := alimnstest.NewServer(alimnstest.WithServerClock(clock))
+	t.Cleanup(server.Close)
+
+	client := ali_mns.NewAliMNSClient(server.URL, "test-id", "test-secret", ali_mns.WithClock(clock))
+	manager := ali_mns.NewMNSQueueManagerWithClient(client)
+	if err := manager.CreateQueue(server.URL, "test", 0, 65536, 345600, 30, 0); err != nil {
+		t.Fatal(err)
+	}
+	queue := server.Queue("test")
+
+	valueOf := func(metric ali_mns.DepthMetric, attr ali_mns.QueueAttribute) int64 {
+		if metric == ali_mns.DelayMessages {
+			return attr.DelayMessages
+		}
+		return attr.ActiveMessages
+	}
+
+	events := make(chan string, 10)
+	threshold := func(queue string, metric ali_mns.DepthMetric, threshold int64) ali_mns.DepthThreshold {
+		return ali_mns.DepthThreshold{
+			Queue:     queue,
+			Metric:    metric,
+			Threshold: threshold,
+			OnAbove:   func(attr ali_mns.QueueAttribute) { events <- fmt.Sprintf("above %s %d", metric, valueOf(metric, attr)) },
+			OnBelow:   func(attr ali_mns.QueueAttribute) { events <- fmt.Sprintf("below %s %d", metric, valueOf(metric, attr)) },
+		}
+	}
+
+	// the failing queue comes last, so its error tells a poll is done
+	polled := make(chan error, 10)
+
+	monitor := ali_mns.NewDepthMonitor(manager, server.URL, time.Minute)
+	monitor.AddThreshold(threshold("test", ali_mns.ActiveMessages, 2))
+	monitor.AddThreshold(threshold("test", ali_mns.DelayMessages, 0))
+	monitor.AddThreshold(threshold("missing", ali_mns.ActiveMessages, 0))
+	monitor.OnError(func(queue string, err error) {
+		if queue != "missing" {
+			t.Errorf("polling %s failed: %v", queue, err)
+		}
+		polled <- err
+	})
+
+	send := func(n int, delaySeconds int64) func() {
+		return func() {
+			for i := 0; i < n; i++ {
+				queue.SendMessage(ali_mns.MessageSendRequest{MessageBody: []byte("depth"), DelaySeconds: delaySeconds})
+			}
+		}
+	}
+
+	for i, step := range []struct {
+		name   string
+		action func()
+		events []string
+	}{
+		{"BelowOnFirstPoll", monitor.Start, nil},
+		{"RisesAbove", send(3, 0), []string{"above ActiveMessages 3"}},
+		{"StaysAbove", func() {}, nil},
+		{"OtherMetric", send(1, 3600), []string{"above DelayMessages 1"}},
+		{"FallsBelow", func() {
+			queue.BatchReceiveMessageFunc(func(message ali_mns.MessageReceiveResponse) error {
+				return queue.DeleteMessage(message.ReceiptHandle)
+			}, 2, 0)
+		}, []string{"below ActiveMessages 1"}},
+		{"RisesAboveAgain", send(2, 0), []string{"above ActiveMessages 3"}},
+	} {
+		step.action()
+
+		if i > 0 {
+			clock.Advance(time.Minute)
+		}
+
+		select {
+		case err := <-polled:
+			if !ali_mns.ERR_MNS_QUEUE_NOT_EXIST.IsEqual(err) {
+				t.Fatalf("%s: polling the missing queue failed with %v", step.name, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: queues not polled", step.name)
+		}
+
+		var fired []string
+		for len(events) > 0 {
+			fired = append(fired, <-events)
+		}
+		if !reflect.DeepEqual(fired, step.events) {
+			t.Fatalf("%s: fired %q, want %q", step.name, fired, step.events)
+		}
+	}
+
+	monitor.Stop()
+}
@@ -0,0 +1,154 @@
+package ali_mns
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultDNSRefreshInterval = time.Minute
+)
+
+type dnsCacheEntry struct {
+	addrs      []string
+	resolvedAt time.Time
+	refreshing int32
+	next       uint32
+}
+
+// CachingResolver caches host lookups and looks them up again once they are
+// older than a fixed refresh interval. The TTL of the DNS records is not
+// known to net.Resolver and is ignored. Stale entries are still served while
+// being refreshed in the background, and are kept when the refresh fails, so
+// a flaky resolver never blocks a request that has been resolved before.
+type CachingResolver struct {
+	refreshInterval time.Duration
+	resolver        HostResolver
+	dialer          *net.Dialer
+	clock           Clock
+
+	entries map[string]*dnsCacheEntry
+	locker  sync.RWMutex
+}
+
+// HostResolver looks up the addresses of hosts, like net.Resolver.
+type HostResolver interface {
+	LookupHost(ctx context.Context, host string) (addrs []string, err error)
+}
+
+type ResolverOption func(*CachingResolver)
+
+// WithHostResolver makes the resolver look hosts up by resolver instead of
+// net.DefaultResolver, e.g. a net.Resolver of a given DNS server.
+func WithHostResolver(resolver HostResolver) ResolverOption {
+	return func(p *CachingResolver) {
+		if resolver != nil {
+			p.resolver = resolver
+		}
+	}
+}
+
+// WithResolverClock makes the resolver tell the age of its entries by clock.
+// The resolver does not use the clock of the clients it is shared by.
+func WithResolverClock(clock Clock) ResolverOption {
+	return func(p *CachingResolver) {
+		if clock != nil {
+			p.clock = clock
+		}
+	}
+}
+
+// NewCachingResolver returns a resolver refreshing its entries every
+// refreshInterval, DefaultDNSRefreshInterval if it is not positive.
+func NewCachingResolver(refreshInterval time.Duration, opts ...ResolverOption) *CachingResolver {
+	if refreshInterval <= 0 {
+		refreshInterval = DefaultDNSRefreshInterval
+	}
+
+	resolver := &CachingResolver{
+		refreshInterval: refreshInterval,
+		resolver:        net.DefaultResolver,
+		dialer:          &net.Dialer{Timeout: time.Second * 3, KeepAlive: time.Second * 30},
+		clock:           SystemClock,
+		entries:         make(map[string]*dnsCacheEntry),
+	}
+
+	for _, opt := range opts {
+		opt(resolver)
+	}
+
+	return resolver
+}
+
+func (p *CachingResolver) LookupHost(ctx context.Context, host string) (addrs []string, err error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []string{host}, nil
+	}
+
+	p.locker.RLock()
+	entry, exist := p.entries[host]
+	p.locker.RUnlock()
+
+	if !exist {
+		return p.refresh(ctx, host)
+	}
+
+	if p.clock.Now().Sub(entry.resolvedAt) > p.refreshInterval && atomic.CompareAndSwapInt32(&entry.refreshing, 0, 1) {
+		go func() {
+			defer atomic.StoreInt32(&entry.refreshing, 0)
+			p.refresh(context.Background(), host)
+		}()
+	}
+
+	return entry.addrs, nil
+}
+
+func (p *CachingResolver) refresh(ctx context.Context, host string) (addrs []string, err error) {
+	if addrs, err = p.resolver.LookupHost(ctx, host); err != nil {
+		return
+	}
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	entry := &dnsCacheEntry{addrs: addrs, resolvedAt: p.clock.Now()}
+	if old, exist := p.entries[host]; exist {
+		entry.next = atomic.LoadUint32(&old.next)
+	}
+	p.entries[host] = entry
+
+	return
+}
+
+// DialContext resolves addr through the cache and tries the addresses in
+// round-robin order until one connects.
+func (p *CachingResolver) DialContext(ctx context.Context, network, addr string) (conn net.Conn, err error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return
+	}
+
+	addrs, err := p.LookupHost(ctx, host)
+	if err != nil {
+		return
+	}
+
+	start := 0
+	p.locker.RLock()
+	if entry, exist := p.entries[host]; exist {
+		start = int(atomic.AddUint32(&entry.next, 1))
+	}
+	p.locker.RUnlock()
+
+	for i := range addrs {
+		ip := addrs[(start+i)%len(addrs)]
+		if conn, err = p.dialer.DialContext(ctx, network, net.JoinHostPort(ip, port)); err == nil {
+			return
+		}
+	}
+
+	return
+}
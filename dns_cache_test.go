@@ -0,0 +1,122 @@
+package ali_mns_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gogap/ali_mns"
+	"github.com/gogap/ali_mns/alimnstest"
+)
+
+// stubResolver answers lookups with addrs, or fails with err if set.
+type stubResolver struct {
+	addrs   []string
+	err     error
+	lookups int
+	locker  sync.Mutex
+}
+
+func (p *stubResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.lookups++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return p.addrs, nil
+}
+
+func (p *stubResolver) set(addrs []string, err error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.addrs, p.err = addrs, err
+}
+
+func (p *stubResolver) count() int {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	return p.lookups
+}
+
+func TestCachingResolver(t *testing.T) {
+	errResolve := errors.New("resolver down")
+	first, second := []string{"10.0.0.1"}, []string{"10.0.0.2", "10.0.0.3"}
+
+	stub := &stubResolver{addrs: first}
+	clock := alimnstest.NewFakeClock(time.Time{})
+	resolver := ali_mns.NewCachingResolver(time.Minute, ali_mns.WithHostResolver(stub), ali_mns.WithResolverClock(clock))
+
+	for _, step := range []struct {
+		name        string
+		advance     time.Duration
+		addrs       []string
+		err         error
+		want        []string
+		wantLookups int
+	}{
+		{"FirstLookup", 0, first, nil, first, 1},
+		{"Cached", 30 * time.Second, second, nil, first, 1},
+		// stale entries are served while they are refreshed
+		{"ExpiredServedStale", 31 * time.Second, second, nil, first, 2},
+		{"Refreshed", 0, second, nil, second, 2},
+		// a failed refresh keeps the entry
+		{"RefreshFails", time.Minute + time.Second, nil, errResolve, second, 3},
+	} {
+		clock.Advance(step.advance)
+		stub.set(step.addrs, step.err)
+
+		// refreshes run in the background
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			addrs, err := resolver.LookupHost(context.Background(), "mns.example.com")
+			if err != nil {
+				t.Fatalf("%s: %v", step.name, err)
+			}
+			if reflect.DeepEqual(addrs, step.want) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: got %v, want %v", step.name, addrs, step.want)
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		for stub.count() != step.wantLookups {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: %d lookups, want %d", step.name, stub.count(), step.wantLookups)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func TestCachingResolverErrors(t *testing.T) {
+	errResolve := errors.New("resolver down")
+	stub := &stubResolver{err: errResolve}
+	resolver := ali_mns.NewCachingResolver(time.Minute, ali_mns.WithHostResolver(stub))
+
+	if _, err := resolver.LookupHost(context.Background(), "mns.example.com"); err != errResolve {
+		t.Fatalf("got error %v, want %v", err, errResolve)
+	}
+
+	// failures are not cached
+	stub.set([]string{"10.0.0.1"}, nil)
+	if addrs, err := resolver.LookupHost(context.Background(), "mns.example.com"); err != nil || len(addrs) != 1 {
+		t.Fatalf("got %v and %v after the resolver recovered", addrs, err)
+	}
+
+	// addresses are not looked up
+	if addrs, err := resolver.LookupHost(context.Background(), "127.0.0.1"); err != nil || addrs[0] != "127.0.0.1" {
+		t.Fatalf("got %v and %v for an address", addrs, err)
+	}
+	if lookups := stub.count(); lookups != 2 {
+		t.Fatalf("%d lookups, want 2", lookups)
+	}
+}
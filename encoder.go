@@ -0,0 +1,26 @@
+package ali_mns
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// MNSEncoder renders the request bodies of a client. Messages passed as
+// []byte are sent as they are and do not go through the encoder.
+type MNSEncoder interface {
+	Encode(writer io.Writer, v interface{}) (err error)
+}
+
+type AliMNSEncoder struct {
+}
+
+func NewAliMNSEncoder() MNSEncoder {
+	return &AliMNSEncoder{}
+}
+
+func (p *AliMNSEncoder) Encode(writer io.Writer, v interface{}) (err error) {
+	encoder := xml.NewEncoder(writer)
+	err = encoder.Encode(v)
+
+	return
+}
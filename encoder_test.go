@@ -0,0 +1,27 @@
+package ali_mns_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/gogap/ali_mns"
+)
+
+// benchmarkBody is the message body benchmarks send and decode.
+var benchmarkBody = bytes.Repeat([]byte("ali_mns benchmark "), 64)
+
+func BenchmarkEncodeMessage(b *testing.B) {
+	encoder := ali_mns.NewAliMNSEncoder()
+	message := ali_mns.MessageSendRequest{MessageBody: benchmarkBody, Priority: 8}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkBody)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := encoder.Encode(ioutil.Discard, message); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package ali_mns
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/gogap/errors"
+)
+
+// encryptedMagic prefixes encrypted bodies. It is followed by the length of
+// the key id as uint16, the key id, the nonce and the AES-GCM ciphertext.
+var encryptedMagic = []byte{0x00, 'm', 'e', 1}
+
+// KeyProvider supplies the AES keys (16, 24 or 32 bytes) of encrypted
+// messages. The key id returned with an encryption key is stored alongside
+// the ciphertext and handed back to DecryptionKey on receive.
+type KeyProvider interface {
+	EncryptionKey() (key []byte, keyId []byte, err error)
+	DecryptionKey(keyId []byte) (key []byte, err error)
+}
+
+type staticKeyProvider struct {
+	current string
+	keys    map[string][]byte
+}
+
+// NewStaticKeyProvider encrypts with keys[current] and decrypts with any of
+// keys, so keys can be rotated while old messages are still queued.
+func NewStaticKeyProvider(current string, keys map[string][]byte) KeyProvider {
+	if _, exist := keys[current]; !exist {
+		panic("ali_mns: current key of static key provider not found")
+	}
+
+	return &staticKeyProvider{current: current, keys: keys}
+}
+
+func (p *staticKeyProvider) EncryptionKey() (key []byte, keyId []byte, err error) {
+	return p.keys[p.current], []byte(p.current), nil
+}
+
+func (p *staticKeyProvider) DecryptionKey(keyId []byte) (key []byte, err error) {
+	key, exist := p.keys[string(keyId)]
+	if !exist {
+		err = fmt.Errorf("key %q not found", keyId)
+	}
+	return
+}
+
+// WithEncryption encrypts sent bodies with AES-GCM and decrypts received
+// ones using keys of provider. Encrypted bodies are binary, so
+// NewMNSQueueWithOptions fails unless the queue uses the Base64BodyCodec.
+func WithEncryption(provider KeyProvider) QueueOption {
+	return func(p *MNSQueue) {
+		p.keyProvider = provider
+	}
+}
+
+func (p *MNSQueue) encrypt(body []byte) (encrypted []byte, err error) {
+	if p.keyProvider == nil {
+		return body, nil
+	}
+
+	if encrypted, err = sealBody(p.keyProvider, body); err != nil {
+		err = ERR_ENCRYPT_BODY_FAILED.New(errors.Params{"err": err})
+	}
+	return
+}
+
+// decrypt returns body as is unless it is encrypted and the queue has a
+// KeyProvider.
+func (p *MNSQueue) decrypt(body []byte) (decrypted []byte, err error) {
+	if p.keyProvider == nil || !bytes.HasPrefix(body, encryptedMagic) {
+		return body, nil
+	}
+
+	if decrypted, err = openBody(p.keyProvider, body); err != nil {
+		err = ERR_DECRYPT_BODY_FAILED.New(errors.Params{"err": err})
+	}
+	return
+}
+
+func sealBody(provider KeyProvider, body []byte) (sealed []byte, err error) {
+	key, keyId, err := provider.EncryptionKey()
+	if err != nil {
+		return
+	}
+
+	if len(keyId) > 0xffff {
+		err = fmt.Errorf("key id is too long")
+		return
+	}
+
+	var aead cipher.AEAD
+	if aead, err = newGCM(key); err != nil {
+		return
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return
+	}
+
+	sealed = make([]byte, 0, len(encryptedMagic)+2+len(keyId)+len(nonce)+len(body)+aead.Overhead())
+	sealed = append(sealed, encryptedMagic...)
+	sealed = append(sealed, byte(len(keyId)>>8), byte(len(keyId)))
+	sealed = append(sealed, keyId...)
+	sealed = append(sealed, nonce...)
+	sealed = aead.Seal(sealed, nonce, body, nil)
+
+	return
+}
+
+func openBody(provider KeyProvider, sealed []byte) (body []byte, err error) {
+	data := sealed[len(encryptedMagic):]
+	if len(data) < 2 {
+		err = fmt.Errorf("encrypted body is truncated")
+		return
+	}
+
+	keyIdLen := int(binary.BigEndian.Uint16(data))
+	data = data[2:]
+	if len(data) < keyIdLen {
+		err = fmt.Errorf("encrypted body is truncated")
+		return
+	}
+
+	keyId, data := data[:keyIdLen], data[keyIdLen:]
+
+	key, err := provider.DecryptionKey(keyId)
+	if err != nil {
+		return
+	}
+
+	var aead cipher.AEAD
+	if aead, err = newGCM(key); err != nil {
+		return
+	}
+
+	if len(data) < aead.NonceSize() {
+		err = fmt.Errorf("encrypted body is truncated")
+		return
+	}
+
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+}
+
+func newGCM(key []byte) (aead cipher.AEAD, err error) {
+	var block cipher.Block
+	if block, err = aes.NewCipher(key); err != nil {
+		return
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,86 @@
+package ali_mns_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gogap/ali_mns"
+	"github.com/gogap/ali_mns/alimnstest"
+)
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	keys := map[string][]byte{
+		"old": bytes.Repeat([]byte{1}, 16),
+		"new": bytes.Repeat([]byte{2}, 32),
+	}
+
+	for _, test := range []struct {
+		name    string
+		sendKey string
+		opts    []ali_mns.QueueOption
+	}{
+		{"Plain", "new", nil},
+		{"RotatedKey", "old", nil},
+		{"Compressed", "new", []ali_mns.QueueOption{ali_mns.WithCompression(ali_mns.GzipCompressor, 0)}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			opts := append([]ali_mns.QueueOption{ali_mns.WithEncryption(ali_mns.NewStaticKeyProvider(test.sendKey, keys))}, test.opts...)
+			server, sender := newTestQueue(t, opts...)
+
+			if _, err := sender.SendStringMessage("secret body"); err != nil {
+				t.Fatal(err)
+			}
+
+			if wire := peekWireBody(t, server.Queue("test")); bytes.Contains(wire, []byte("secret body")) {
+				t.Errorf("body was sent in plain text: %q", wire)
+			}
+
+			client := ali_mns.NewAliMNSClient(server.URL, "test-id", "test-secret")
+			receiver, err := ali_mns.NewMNSQueueWithOptions("test", client, ali_mns.WithEncryption(ali_mns.NewStaticKeyProvider("new", keys)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := receiveOne(t, receiver)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(resp.MessageBody) != "secret body" {
+				t.Errorf("received %q, want %q", resp.MessageBody, "secret body")
+			}
+		})
+	}
+}
+
+func TestEncryptionUnknownKey(t *testing.T) {
+	server, sender := newTestQueue(t, ali_mns.WithEncryption(ali_mns.NewStaticKeyProvider("a", map[string][]byte{"a": make([]byte, 16)})))
+	if _, err := sender.SendStringMessage("secret body"); err != nil {
+		t.Fatal(err)
+	}
+
+	client := ali_mns.NewAliMNSClient(server.URL, "test-id", "test-secret")
+	receiver, err := ali_mns.NewMNSQueueWithOptions("test", client, ali_mns.WithEncryption(ali_mns.NewStaticKeyProvider("b", map[string][]byte{"b": make([]byte, 16)})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := receiveOne(t, receiver); !ali_mns.ERR_DECRYPT_BODY_FAILED.IsEqual(err) {
+		t.Fatalf("got %v, want ERR_DECRYPT_BODY_FAILED", err)
+	}
+}
+
+func TestEncryptionNeedsBase64BodyCodec(t *testing.T) {
+	server := alimnstest.NewServer()
+	defer server.Close()
+
+	client := ali_mns.NewAliMNSClient(server.URL, "test-id", "test-secret")
+	if err := ali_mns.NewMNSQueueManagerWithClient(client).CreateQueue(server.URL, "test", 0, 65536, 345600, 30, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	provider := ali_mns.NewStaticKeyProvider("a", map[string][]byte{"a": make([]byte, 16)})
+	_, err := ali_mns.NewMNSQueueWithOptions("test", client, ali_mns.WithBodyCodec(ali_mns.RawBodyCodec), ali_mns.WithEncryption(provider))
+	if !ali_mns.ERR_BODY_CODEC_NOT_BASE64.IsEqual(err) {
+		t.Fatalf("got %v, want ERR_BODY_CODEC_NOT_BASE64", err)
+	}
+}
@@ -0,0 +1,29 @@
+package ali_mns
+
+import (
+	"fmt"
+	"strings"
+)
+
+type EndpointType int
+
+const (
+	EndpointTypePublic EndpointType = iota
+	EndpointTypeInternal
+	EndpointTypeVPC
+)
+
+// NewEndpoint builds the MNS endpoint of an account in a region, e.g.
+// https://1234567890.mns.cn-hangzhou-internal.aliyuncs.com
+func NewEndpoint(accountId, region string, endpointType EndpointType) string {
+	region = strings.ToLower(strings.TrimSpace(region))
+
+	switch endpointType {
+	case EndpointTypeInternal:
+		region += "-internal"
+	case EndpointTypeVPC:
+		region += "-internal-vpc"
+	}
+
+	return fmt.Sprintf("https://%s.mns.%s.aliyuncs.com", strings.TrimSpace(accountId), region)
+}
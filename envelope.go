@@ -0,0 +1,122 @@
+package ali_mns
+
+import (
+	"bytes"
+	"encoding/json"
+	"unicode/utf8"
+)
+
+// envelopeMarker starts every envelope, so receivers tell enveloped bodies
+// from plain ones.
+var envelopeMarker = []byte(`{"ali_mns_envelope":`)
+
+// envelope wraps a payload with user properties such as content type,
+// routing keys or trace ids, which MNS queue messages have no headers for.
+// The payload is kept in the first field that holds it as is: compact JSON
+// documents in Payload, other UTF-8 text in Text and binary data, base64
+// encoded, in Data, so the envelope adds little to the body size.
+type envelope struct {
+	Version    int               `json:"ali_mns_envelope"`
+	Properties map[string]string `json:"properties,omitempty"`
+	Payload    json.RawMessage   `json:"payload,omitempty"`
+	Text       string            `json:"text,omitempty"`
+	Data       []byte            `json:"data,omitempty"`
+}
+
+func (p *envelope) setPayload(payload []byte) {
+	switch {
+	case isCompactJSON(payload):
+		p.Payload = json.RawMessage(payload)
+	case utf8.Valid(payload):
+		p.Text = string(payload)
+	default:
+		p.Data = payload
+	}
+}
+
+func (p *envelope) payload() []byte {
+	switch {
+	case p.Payload != nil:
+		return p.Payload
+	case p.Data != nil:
+		return p.Data
+	}
+	return []byte(p.Text)
+}
+
+// isCompactJSON reports whether payload is a JSON document that encoding
+// it as a json.RawMessage leaves byte for byte the same.
+func isCompactJSON(payload []byte) bool {
+	if !utf8.Valid(payload) || !json.Valid(payload) {
+		return false
+	}
+
+	buf := bytes.Buffer{}
+	return json.Compact(&buf, payload) == nil && bytes.Equal(buf.Bytes(), payload)
+}
+
+// WithProperties wraps the body of the message in an envelope carrying
+// properties. Applying it to an enveloped body merges the properties.
+func WithProperties(properties map[string]string) SendOption {
+	return func(p *MessageSendRequest) {
+		env := envelope{Version: 1, Properties: map[string]string{}}
+
+		if payload, props, ok := openEnvelope(p.MessageBody); ok {
+			env.setPayload(payload)
+			for k, v := range props {
+				env.Properties[k] = v
+			}
+		} else {
+			env.setPayload(p.MessageBody)
+		}
+
+		for k, v := range properties {
+			env.Properties[k] = v
+		}
+
+		// HTML characters are kept as they are, escaping them would change
+		// JSON payloads
+		buf := bytes.Buffer{}
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+
+		// encoding cannot fail, Payload only ever holds valid JSON and the
+		// other fields are strings, bytes and numbers
+		encoder.Encode(env)
+
+		p.MessageBody = Base64Bytes(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+	}
+}
+
+func openEnvelope(body []byte) (payload []byte, properties map[string]string, ok bool) {
+	if !bytes.HasPrefix(body, envelopeMarker) {
+		return
+	}
+
+	env := envelope{}
+	if err := json.Unmarshal(body, &env); err != nil {
+		return
+	}
+
+	return env.payload(), env.Properties, true
+}
+
+// Payload returns the body of the message, unwrapped if it was sent with
+// WithProperties.
+func (p MessageReceiveResponse) Payload() []byte {
+	if payload, _, ok := openEnvelope(p.MessageBody); ok {
+		return payload
+	}
+	return p.MessageBody
+}
+
+// Properties returns the properties the message was sent with, nil if it
+// has none.
+func (p MessageReceiveResponse) Properties() map[string]string {
+	_, properties, _ := openEnvelope(p.MessageBody)
+	return properties
+}
+
+func (p MessageReceiveResponse) Property(key string) string {
+	return p.Properties()[key]
+}
@@ -0,0 +1,70 @@
+package ali_mns_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gogap/ali_mns"
+)
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	properties := map[string]string{"content-type": "test", "trace": "1"}
+
+	for _, test := range []struct {
+		name    string
+		payload []byte
+	}{
+		{"CompactJSON", []byte(`{"id":1,"tags":["a","b"],"html":"<b>&</b>"}`)},
+		{"IndentedJSON", []byte("{\n  \"id\": 1\n}")},
+		{"Text", []byte("plain <text> & \"quotes\"")},
+		{"Binary", []byte{0x00, 0xff, 0xfe, 'm', 'n', 's'}},
+		{"Empty", []byte{}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, queue := newTestQueue(t)
+
+			message, err := ali_mns.NewMessage(test.payload).WithProperties(properties).Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the payload is not base64 encoded inside the envelope
+			if overhead := len(message.MessageBody) - len(test.payload); overhead > 100 {
+				t.Errorf("envelope of %d bytes for a payload of %d", len(message.MessageBody), len(test.payload))
+			}
+
+			if _, err := queue.SendMessage(message); err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := receiveOne(t, queue)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(resp.Payload(), test.payload) {
+				t.Errorf("payload is %q, want %q", resp.Payload(), test.payload)
+			}
+			for k, v := range properties {
+				if resp.Property(k) != v {
+					t.Errorf("property %s is %q, want %q", k, resp.Property(k), v)
+				}
+			}
+		})
+	}
+}
+
+func TestEnvelopeMergesProperties(t *testing.T) {
+	message, err := ali_mns.NewMessage([]byte("payload")).
+		WithProperties(map[string]string{"a": "1", "b": "1"}).
+		WithProperties(map[string]string{"b": "2"}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := ali_mns.MessageReceiveResponse{MessageBody: message.MessageBody}
+	if string(resp.Payload()) != "payload" || resp.Property("a") != "1" || resp.Property("b") != "2" {
+		t.Errorf("got payload %q and properties %v", resp.Payload(), resp.Properties())
+	}
+}
@@ -0,0 +1,92 @@
+package ali_mns
+
+import (
+	"sync"
+)
+
+// ErrorStats is a snapshot of the failed requests of a client, counted by
+// MNS error code and by HTTP status. Every attempt is counted, retried ones
+// included. Requests that got no response are counted under status 0.
+type ErrorStats struct {
+	Codes    map[string]int64 `json:"codes"`
+	Statuses map[int]int64    `json:"statuses"`
+}
+
+// ErrorStatsReporter is implemented by clients counting their failed
+// requests, such as AliMNSClient.
+type ErrorStatsReporter interface {
+	ErrorStats() ErrorStats
+	ResetErrorStats()
+}
+
+type errorCounter struct {
+	codes    map[string]int64
+	statuses map[int]int64
+
+	locker sync.Mutex
+}
+
+func (p *errorCounter) record(statusCode int, err error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if p.statuses == nil {
+		p.codes = make(map[string]int64)
+		p.statuses = make(map[int]int64)
+	}
+
+	p.statuses[statusCode]++
+
+	if mnsErr, ok := err.(*MNSError); ok && mnsErr.ErrorCode() != "" {
+		p.codes[mnsErr.ErrorCode()]++
+	}
+}
+
+func (p *errorCounter) snapshot() (stats ErrorStats) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	stats.Codes = make(map[string]int64, len(p.codes))
+	for code, count := range p.codes {
+		stats.Codes[code] = count
+	}
+
+	stats.Statuses = make(map[int]int64, len(p.statuses))
+	for status, count := range p.statuses {
+		stats.Statuses[status] = count
+	}
+
+	return
+}
+
+func (p *errorCounter) reset() {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.codes = nil
+	p.statuses = nil
+}
+
+type errorRecorder interface {
+	recordError(statusCode int, err error)
+}
+
+func recordError(client MNSClient, statusCode int, err error) {
+	if recorder, ok := client.(errorRecorder); ok {
+		recorder.recordError(statusCode, err)
+	}
+}
+
+func (p *AliMNSClient) recordError(statusCode int, err error) {
+	p.errorCounter.record(statusCode, err)
+}
+
+// ErrorStats returns the failed requests counted since the client was
+// created or ResetErrorStats was called.
+func (p *AliMNSClient) ErrorStats() ErrorStats {
+	return p.errorCounter.snapshot()
+}
+
+func (p *AliMNSClient) ResetErrorStats() {
+	p.errorCounter.reset()
+}
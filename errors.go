@@ -19,40 +19,69 @@ var (
 	ERR_SEND_REQUEST_FAILED       = errors.TN(ALI_MNS_ERR_NS, 5, "send request failed, {{.err}}")
 	ERR_READ_RESPONSE_BODY_FAILED = errors.TN(ALI_MNS_ERR_NS, 6, "read response body failed, {{.err}}")
 
-	ERR_UNMARSHAL_ERROR_RESPONSE_FAILED = errors.TN(ALI_MNS_ERR_NS, 7, "unmarshal error response failed, {{.err}}")
+	ERR_UNMARSHAL_ERROR_RESPONSE_FAILED = errors.TN(ALI_MNS_ERR_NS, 7, "unmarshal error response failed, {{.err}}, status code: {{.status}}, body: \"{{.body}}\"")
 	ERR_UNMARSHAL_RESPONSE_FAILED       = errors.TN(ALI_MNS_ERR_NS, 8, "unmarshal response failed, {{.err}}")
 	ERR_DECODE_BODY_FAILED              = errors.TN(ALI_MNS_ERR_NS, 9, "decode body failed, {{.err}}, body: \"{{.body}}\"")
 	ERR_GET_BODY_DECODE_ELEMENT_ERROR   = errors.TN(ALI_MNS_ERR_NS, 10, "get body decode element error, local: {{.local}}, error: {{.err}}")
 
-	ERR_MNS_ACCESS_DENIED                = errors.TN(ALI_MNS_ERR_NS, 100, ali_MNS_ERR_TEMPSTR)
-	ERR_MNS_INVALID_ACCESS_KEY_ID        = errors.TN(ALI_MNS_ERR_NS, 101, ali_MNS_ERR_TEMPSTR)
-	ERR_MNS_INTERNAL_ERROR               = errors.TN(ALI_MNS_ERR_NS, 102, ali_MNS_ERR_TEMPSTR)
-	ERR_MNS_INVALID_AUTHORIZATION_HEADER = errors.TN(ALI_MNS_ERR_NS, 103, ali_MNS_ERR_TEMPSTR)
-	ERR_MNS_INVALID_DATE_HEADER          = errors.TN(ALI_MNS_ERR_NS, 104, ali_MNS_ERR_TEMPSTR)
-	ERR_MNS_INVALID_ARGUMENT             = errors.TN(ALI_MNS_ERR_NS, 105, ali_MNS_ERR_TEMPSTR)
-	ERR_MNS_INVALID_DEGIST               = errors.TN(ALI_MNS_ERR_NS, 106, ali_MNS_ERR_TEMPSTR)
-	ERR_MNS_INVALID_REQUEST_URL          = errors.TN(ALI_MNS_ERR_NS, 107, ali_MNS_ERR_TEMPSTR)
-	ERR_MNS_INVALID_QUERY_STRING         = errors.TN(ALI_MNS_ERR_NS, 108, ali_MNS_ERR_TEMPSTR)
-	ERR_MNS_MALFORMED_XML                = errors.TN(ALI_MNS_ERR_NS, 109, ali_MNS_ERR_TEMPSTR)
-	ERR_MNS_MISSING_AUTHORIZATION_HEADER = errors.TN(ALI_MNS_ERR_NS, 110, ali_MNS_ERR_TEMPSTR)
-	ERR_MNS_MISSING_DATE_HEADER          = errors.TN(ALI_MNS_ERR_NS, 111, ali_MNS_ERR_TEMPSTR)
-	ERR_MNS_MISSING_VERSION_HEADER       = errors.TN(ALI_MNS_ERR_NS, 112, ali_MNS_ERR_TEMPSTR)
-	ERR_MNS_MISSING_RECEIPT_HANDLE       = errors.TN(ALI_MNS_ERR_NS, 113, ali_MNS_ERR_TEMPSTR)
-	ERR_MNS_MISSING_VISIBILITY_TIMEOUT   = errors.TN(ALI_MNS_ERR_NS, 114, ali_MNS_ERR_TEMPSTR)
-	ERR_MNS_MESSAGE_NOT_EXIST            = errors.TN(ALI_MNS_ERR_NS, 115, ali_MNS_ERR_TEMPSTR)
-	ERR_MNS_QUEUE_DELETED_RECENTLY       = errors.TN(ALI_MNS_ERR_NS, 117, ali_MNS_ERR_TEMPSTR)
-	ERR_MNS_INVALID_QUEUE_NAME           = errors.TN(ALI_MNS_ERR_NS, 118, ali_MNS_ERR_TEMPSTR)
-	ERR_MNS_INVALID_VERSION_HEADER       = errors.TN(ALI_MNS_ERR_NS, 119, ali_MNS_ERR_TEMPSTR)
-	ERR_MNS_INVALID_CONTENT_TYPE         = errors.TN(ALI_MNS_ERR_NS, 120, ali_MNS_ERR_TEMPSTR)
-	ERR_MNS_QUEUE_NAME_LENGTH_ERROR      = errors.TN(ALI_MNS_ERR_NS, 121, ali_MNS_ERR_TEMPSTR)
-	ERR_MNS_QUEUE_NOT_EXIST              = errors.TN(ALI_MNS_ERR_NS, 122, ali_MNS_ERR_TEMPSTR)
-	ERR_MNS_RECEIPT_HANDLE_ERROR         = errors.TN(ALI_MNS_ERR_NS, 123, ali_MNS_ERR_TEMPSTR)
-	ERR_MNS_SIGNATURE_DOES_NOT_MATCH     = errors.TN(ALI_MNS_ERR_NS, 124, ali_MNS_ERR_TEMPSTR)
-	ERR_MNS_TIME_EXPIRED                 = errors.TN(ALI_MNS_ERR_NS, 125, ali_MNS_ERR_TEMPSTR)
-	ERR_MNS_QPS_LIMIT_EXCEEDED           = errors.TN(ALI_MNS_ERR_NS, 134, ali_MNS_ERR_TEMPSTR)
-	ERR_MNS_UNKNOWN_CODE                 = errors.TN(ALI_MNS_ERR_NS, 135, ali_MNS_ERR_TEMPSTR)
+	ERR_ENV_VARIABLE_NOT_SET   = errors.TN(ALI_MNS_ERR_NS, 11, "environment variable {{.name}} is not set")
+	ERR_LOAD_TLS_CONFIG_FAILED = errors.TN(ALI_MNS_ERR_NS, 12, "load tls config failed, {{.err}}")
+	ERR_HANDLER_PANIC          = errors.TN(ALI_MNS_ERR_NS, 13, "message handler panic, message id: {{.id}}, panic: {{.panic}}\n{{.stack}}")
+	ERR_PRODUCER_CLOSED        = errors.TN(ALI_MNS_ERR_NS, 14, "async producer is closed")
+	ERR_UNMARSHAL_BODY_FAILED  = errors.TN(ALI_MNS_ERR_NS, 15, "unmarshal message body failed, {{.err}}")
+	ERR_COMPRESS_BODY_FAILED   = errors.TN(ALI_MNS_ERR_NS, 16, "compress message body failed, {{.err}}")
+	ERR_DECOMPRESS_BODY_FAILED = errors.TN(ALI_MNS_ERR_NS, 17, "decompress message body failed, {{.err}}")
+	ERR_ENCRYPT_BODY_FAILED    = errors.TN(ALI_MNS_ERR_NS, 18, "encrypt message body failed, {{.err}}")
+	ERR_DECRYPT_BODY_FAILED    = errors.TN(ALI_MNS_ERR_NS, 19, "decrypt message body failed, {{.err}}")
+	ERR_DECODE_UNKNOWN_ELEMENT = errors.TN(ALI_MNS_ERR_NS, 20, "unknown element <{{.element}}> in <{{.parent}}>")
+	ERR_DECODE_MISSING_ELEMENT = errors.TN(ALI_MNS_ERR_NS, 21, "missing element <{{.element}}> in <{{.parent}}>")
+	ERR_DECODE_INVALID_CHARSET = errors.TN(ALI_MNS_ERR_NS, 22, "response is not utf-8 encoded, {{.err}}")
+	ERR_CIRCUIT_BREAKER_OPEN   = errors.TN(ALI_MNS_ERR_NS, 23, "circuit breaker is open after {{.failures}} consecutive failures, until {{.until}}")
+	ERR_BODY_CODEC_NOT_BASE64  = errors.TN(ALI_MNS_ERR_NS, 24, "{{.option}} makes message bodies binary and needs the base64 body codec, queue: {{.name}}")
+	ERR_QUEUE_PROXY_IGNORED    = errors.TN(ALI_MNS_ERR_NS, 25, "proxy of queue {{.name}} set by {{.env}} cannot be applied to a client with a custom http client or transport")
 
-	ERR_MNS_QUEUE_NAME_IS_TOO_LONG                 = errors.TN(ALI_MNS_ERR_NS, 126, "queue name is too long, the max length is 256")
+	ERR_MNS_ACCESS_DENIED                  = errors.TN(ALI_MNS_ERR_NS, 100, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_INVALID_ACCESS_KEY_ID          = errors.TN(ALI_MNS_ERR_NS, 101, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_INTERNAL_ERROR                 = errors.TN(ALI_MNS_ERR_NS, 102, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_INVALID_AUTHORIZATION_HEADER   = errors.TN(ALI_MNS_ERR_NS, 103, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_INVALID_DATE_HEADER            = errors.TN(ALI_MNS_ERR_NS, 104, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_INVALID_ARGUMENT               = errors.TN(ALI_MNS_ERR_NS, 105, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_INVALID_DEGIST                 = errors.TN(ALI_MNS_ERR_NS, 106, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_INVALID_REQUEST_URL            = errors.TN(ALI_MNS_ERR_NS, 107, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_INVALID_QUERY_STRING           = errors.TN(ALI_MNS_ERR_NS, 108, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_MALFORMED_XML                  = errors.TN(ALI_MNS_ERR_NS, 109, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_MISSING_AUTHORIZATION_HEADER   = errors.TN(ALI_MNS_ERR_NS, 110, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_MISSING_DATE_HEADER            = errors.TN(ALI_MNS_ERR_NS, 111, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_MISSING_VERSION_HEADER         = errors.TN(ALI_MNS_ERR_NS, 112, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_MISSING_RECEIPT_HANDLE         = errors.TN(ALI_MNS_ERR_NS, 113, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_MISSING_VISIBILITY_TIMEOUT     = errors.TN(ALI_MNS_ERR_NS, 114, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_MESSAGE_NOT_EXIST              = errors.TN(ALI_MNS_ERR_NS, 115, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_QUEUE_DELETED_RECENTLY         = errors.TN(ALI_MNS_ERR_NS, 117, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_INVALID_QUEUE_NAME             = errors.TN(ALI_MNS_ERR_NS, 118, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_INVALID_VERSION_HEADER         = errors.TN(ALI_MNS_ERR_NS, 119, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_INVALID_CONTENT_TYPE           = errors.TN(ALI_MNS_ERR_NS, 120, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_QUEUE_NAME_LENGTH_ERROR        = errors.TN(ALI_MNS_ERR_NS, 121, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_QUEUE_NOT_EXIST                = errors.TN(ALI_MNS_ERR_NS, 122, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_RECEIPT_HANDLE_ERROR           = errors.TN(ALI_MNS_ERR_NS, 123, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_SIGNATURE_DOES_NOT_MATCH       = errors.TN(ALI_MNS_ERR_NS, 124, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_TIME_EXPIRED                   = errors.TN(ALI_MNS_ERR_NS, 125, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_QPS_LIMIT_EXCEEDED             = errors.TN(ALI_MNS_ERR_NS, 134, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_UNKNOWN_CODE                   = errors.TN(ALI_MNS_ERR_NS, 135, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_TOPIC_ALREADY_EXIST            = errors.TN(ALI_MNS_ERR_NS, 148, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_TOPIC_NOT_EXIST                = errors.TN(ALI_MNS_ERR_NS, 149, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_TOPIC_NAME_INVALID             = errors.TN(ALI_MNS_ERR_NS, 150, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_TOPIC_NAME_LENGTH_ERROR        = errors.TN(ALI_MNS_ERR_NS, 151, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_SUBSCRIPTION_ALREADY_EXIST     = errors.TN(ALI_MNS_ERR_NS, 152, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_SUBSCRIPTION_NOT_EXIST         = errors.TN(ALI_MNS_ERR_NS, 153, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_SUBSCRIPTION_NAME_INVALID      = errors.TN(ALI_MNS_ERR_NS, 154, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_SUBSCRIPTION_NAME_LENGTH_ERROR = errors.TN(ALI_MNS_ERR_NS, 155, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_ENDPOINT_INVALID               = errors.TN(ALI_MNS_ERR_NS, 156, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_BATCH_SEND_FAIL                = errors.TN(ALI_MNS_ERR_NS, 157, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_BATCH_DELETE_FAIL              = errors.TN(ALI_MNS_ERR_NS, 158, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_MESSAGE_BODY_TOO_LARGE         = errors.TN(ALI_MNS_ERR_NS, 159, ali_MNS_ERR_TEMPSTR)
+	ERR_MNS_INVALID_MESSAGE_TAG            = errors.TN(ALI_MNS_ERR_NS, 160, ali_MNS_ERR_TEMPSTR)
+
+	ERR_MNS_QUEUE_NAME_IS_TOO_LONG                 = errors.TN(ALI_MNS_ERR_NS, 126, "queue name is too long, the max length is 255")
 	ERR_MNS_DELAY_SECONDS_RANGE_ERROR              = errors.TN(ALI_MNS_ERR_NS, 127, "queue delay seconds is not in range of (0~60480)")
 	ERR_MNS_MAX_MESSAGE_SIZE_RANGE_ERROR           = errors.TN(ALI_MNS_ERR_NS, 128, "max message size is not in range of (1024~65536)")
 	ERR_MNS_MSG_RETENTION_PERIOD_RANGE_ERROR       = errors.TN(ALI_MNS_ERR_NS, 129, "message retention period is not in range of (60~129600)")
@@ -61,4 +90,15 @@ var (
 	REE_MNS_GET_QUEUE_RET_NUMBER_RANGE_ERROR       = errors.TN(ALI_MNS_ERR_NS, 132, "get queue list param of ret number is not in range of (1~1000)")
 	ERR_MNS_QUEUE_ALREADY_EXIST_AND_HAVE_SAME_ATTR = errors.TN(ALI_MNS_ERR_NS, 133, "mns queue already exist, and the attribute is the same, queue name: {{.name}}")
 	ERR_MNS_QUEUE_ALREADY_EXIST                    = errors.TN(ALI_MNS_ERR_NS, 136, "mns queue already exist, and has different attribute, queue name: {{.name}}")
+	ERR_MNS_MESSAGE_ALREADY_SETTLED                = errors.TN(ALI_MNS_ERR_NS, 137, "message already acked or nacked, message id: {{.id}}")
+	ERR_MNS_BATCH_SEND_PARTIAL_FAILURE             = errors.TN(ALI_MNS_ERR_NS, 138, "batch send message partially failed, {{.failed}} of {{.total}} messages failed, resource: {{.resource}}")
+	ERR_MNS_MESSAGE_TOO_LARGE                      = errors.TN(ALI_MNS_ERR_NS, 139, "message body size {{.size}} exceeds the max message size {{.max}} of queue {{.name}}")
+	ERR_MNS_MESSAGE_BODY_MD5_MISMATCH              = errors.TN(ALI_MNS_ERR_NS, 140, "message body md5 mismatch, message id: {{.id}}, expected: {{.expected}}, actual: {{.actual}}")
+	ERR_MNS_MESSAGE_DELAY_SECONDS_RANGE_ERROR      = errors.TN(ALI_MNS_ERR_NS, 141, "message delay seconds is not in range of (0~604800)")
+	ERR_MNS_MESSAGE_PRIORITY_RANGE_ERROR           = errors.TN(ALI_MNS_ERR_NS, 142, "message priority is not in range of (1~16)")
+	ERR_MNS_WAIT_QUEUE_TIMEOUT                     = errors.TN(ALI_MNS_ERR_NS, 143, "wait for queue {{.name}} to be {{.state}} timed out")
+	ERR_MNS_QUEUE_PREFIX_IS_EMPTY                  = errors.TN(ALI_MNS_ERR_NS, 144, "queue prefix could not be empty")
+	ERR_MNS_QUEUE_NAME_IS_EMPTY                    = errors.TN(ALI_MNS_ERR_NS, 145, "queue name could not be empty")
+	ERR_MNS_QUEUE_NAME_INVALID_CHARACTER           = errors.TN(ALI_MNS_ERR_NS, 146, "queue name {{.name}} contains invalid character {{.char}}, only letters, digits and hyphens are allowed")
+	ERR_MNS_QUEUE_NAME_STARTS_WITH_HYPHEN          = errors.TN(ALI_MNS_ERR_NS, 147, "queue name {{.name}} could not start with a hyphen")
 )
@@ -0,0 +1,48 @@
+package ali_mns_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gogap/ali_mns"
+)
+
+func TestErrorCodeMapping(t *testing.T) {
+	ali_mns.RegisterErrorCode("TestThrottled", ali_mns.ERR_MNS_QPS_LIMIT_EXCEEDED)
+
+	for _, test := range []struct {
+		code   string
+		status int
+		want   error
+	}{
+		{"QueueNotExist", http.StatusNotFound, ali_mns.ErrQueueNotExist},
+		{"AccessDenied", http.StatusForbidden, ali_mns.ErrAccessDenied},
+		{"SignatureDoesNotMatch", http.StatusForbidden, ali_mns.ErrSignatureMismatch},
+		{"InternalError", http.StatusInternalServerError, ali_mns.ErrInternalError},
+		{"QpsLimitExceeded", http.StatusServiceUnavailable, ali_mns.ErrQpsLimitExceeded},
+		{"TopicNotExist", http.StatusNotFound, ali_mns.ErrTopicNotExist},
+		{"SubscriptionNotExist", http.StatusNotFound, ali_mns.ErrSubscriptionNotExist},
+		{"NoSuchCode", http.StatusBadRequest, ali_mns.ErrUnknownCode},
+		{"TestThrottled", http.StatusServiceUnavailable, ali_mns.ErrQpsLimitExceeded},
+	} {
+		t.Run(test.code, func(t *testing.T) {
+			server := newFailingServer(t, http.MethodPost, 1, test.status, test.code)
+			queue := server.queue(t, []ali_mns.ClientOption{ali_mns.WithRetryPolicy(ali_mns.NoRetry)})
+
+			_, err := queue.SendMessage(ali_mns.MessageSendRequest{MessageBody: []byte("mapped")})
+			if !errors.Is(err, test.want) {
+				t.Fatalf("got %v, want %v", err, test.want)
+			}
+
+			var mnsErr *ali_mns.MNSError
+			if !errors.As(err, &mnsErr) {
+				t.Fatalf("%v is not an *MNSError", err)
+			}
+			if mnsErr.ErrorCode() != test.code || mnsErr.StatusCode() != test.status || mnsErr.Resource() != "queues/test/messages" {
+				t.Fatalf("got code %q, status %d and resource %q, want %q, %d and queues/test/messages",
+					mnsErr.ErrorCode(), mnsErr.StatusCode(), mnsErr.Resource(), test.code, test.status)
+			}
+		})
+	}
+}
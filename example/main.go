@@ -3,7 +3,8 @@ package main
 import (
 	"encoding/json"
 	"io/ioutil"
-	"time"
+	"os"
+	"os/signal"
 
 	"github.com/gogap/ali_mns"
 	"github.com/gogap/logs"
@@ -14,7 +15,6 @@ type appConf struct {
 	Queue           string `json:"queue"`
 	AccessKeyId     string `json:"access_key_id"`
 	AccessKeySecret string `json:"access_key_secret"`
-	Delete          bool   `json:"delete"`
 }
 
 func main() {
@@ -34,32 +34,20 @@ func main() {
 
 	queue := ali_mns.NewMNSQueue(conf.Queue, client)
 
-	respChan := make(chan ali_mns.MessageReceiveResponse)
-	errChan := make(chan error)
-	go func() {
-		for {
-			select {
-			case resp := <-respChan:
-				{
-					logs.Pretty("message:", string(resp.MessageBody))
-					if conf.Delete {
-						if e := queue.DeleteMessage(resp.ReceiptHandle); e != nil {
-							logs.Error(e)
-						}
-					}
-				}
-			case err := <-errChan:
-				{
-					logs.Error(err)
-				}
-			}
-		}
+	consumer := ali_mns.NewConsumer(queue,
+		func(message ali_mns.MessageReceiveResponse) error {
+			logs.Pretty("message:", string(message.MessageBody))
+			return nil
+		},
+		ali_mns.WithErrorHandler(func(err error) {
+			logs.Error(err)
+		}))
 
-	}()
+	consumer.Start()
 
-	queue.ReceiveMessage(respChan, errChan)
-	for {
-		time.Sleep(time.Second * 1)
-	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	<-signals
 
+	consumer.Stop()
 }
@@ -0,0 +1,72 @@
+package ali_mns
+
+import (
+	"expvar"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// requestCounters count the requests of all clients in the process.
+var requestCounters struct {
+	total    int64
+	errors   int64
+	inflight int64
+}
+
+const expvarMapName = "ali_mns"
+
+var (
+	expvarOnce   sync.Once
+	expvarQueues = map[string]StatsReporter{}
+	expvarLocker sync.Mutex
+)
+
+func countRequestStart() {
+	atomic.AddInt64(&requestCounters.total, 1)
+	atomic.AddInt64(&requestCounters.inflight, 1)
+}
+
+func countRequestEnd(resp *http.Response, err error) {
+	atomic.AddInt64(&requestCounters.inflight, -1)
+	if err != nil || !isSuccessStatus(resp.StatusCode) {
+		atomic.AddInt64(&requestCounters.errors, 1)
+	}
+}
+
+// PublishExpvar publishes the request totals, error totals and in-flight
+// requests of all clients, and the QPS of queues, as the expvar map
+// "ali_mns". Calling it again adds queues. Queues that are no StatsReporter
+// are ignored.
+func PublishExpvar(queues ...AliMNSQueue) {
+	expvarLocker.Lock()
+	for _, queue := range queues {
+		if reporter, ok := queue.(StatsReporter); ok {
+			expvarQueues[queue.Name()] = reporter
+		}
+	}
+	expvarLocker.Unlock()
+
+	expvarOnce.Do(func() {
+		vars := expvar.NewMap(expvarMapName)
+		vars.Set("requests", expvar.Func(func() interface{} {
+			return atomic.LoadInt64(&requestCounters.total)
+		}))
+		vars.Set("errors", expvar.Func(func() interface{} {
+			return atomic.LoadInt64(&requestCounters.errors)
+		}))
+		vars.Set("inflight", expvar.Func(func() interface{} {
+			return atomic.LoadInt64(&requestCounters.inflight)
+		}))
+		vars.Set("queue_qps", expvar.Func(func() interface{} {
+			expvarLocker.Lock()
+			defer expvarLocker.Unlock()
+
+			qps := make(map[string]int32, len(expvarQueues))
+			for name, queue := range expvarQueues {
+				qps[name] = queue.Stats().QPS
+			}
+			return qps
+		}))
+	})
+}
@@ -0,0 +1,72 @@
+package ali_mns
+
+import (
+	"time"
+)
+
+// WithVisibilityHeartbeat keeps a message invisible while its handler runs
+// by extending the visibility to visibilityTimeout seconds at half that
+// interval, so slow handlers don't get their message redelivered.
+func WithVisibilityHeartbeat(visibilityTimeout int64) ConsumerOption {
+	return func(p *Consumer) {
+		if visibilityTimeout > 0 {
+			p.heartbeatTimeout = visibilityTimeout
+		}
+	}
+}
+
+type visibilityHeartbeat struct {
+	queue         AliMNSQueue
+	clock         Clock
+	receiptHandle string
+	stopChan      chan bool
+	doneChan      chan bool
+}
+
+func (p *Consumer) startHeartbeat(message MessageReceiveResponse) *visibilityHeartbeat {
+	heartbeat := &visibilityHeartbeat{
+		queue:         p.queue,
+		clock:         p.clock,
+		receiptHandle: message.ReceiptHandle,
+		stopChan:      make(chan bool),
+		doneChan:      make(chan bool),
+	}
+
+	interval := time.Duration(p.heartbeatTimeout) * time.Second / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	go heartbeat.run(interval, p.heartbeatTimeout, p.onError)
+
+	return heartbeat
+}
+
+func (p *visibilityHeartbeat) run(interval time.Duration, visibilityTimeout int64, onError func(error)) {
+	defer close(p.doneChan)
+
+	ticker := p.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			resp, err := p.queue.ChangeMessageVisibility(p.receiptHandle, visibilityTimeout)
+			if err != nil {
+				onError(err)
+				continue
+			}
+			p.receiptHandle = resp.ReceiptHandle
+		case <-p.stopChan:
+			return
+		}
+	}
+}
+
+// stop ends the heartbeat and returns the receipt handle to use from now
+// on, as every visibility change issues a new one.
+func (p *visibilityHeartbeat) stop() string {
+	close(p.stopChan)
+	<-p.doneChan
+	return p.receiptHandle
+}
@@ -0,0 +1,158 @@
+package ali_mns
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RequestHook is called right before a signed request is sent. Credentials
+// in headers are redacted.
+type RequestHook func(method Method, resource string, headers map[string]string)
+
+// ResponseHook is called once a request completes. err only reports
+// transport failures; MNS errors arrive as a non-2xx statusCode.
+type ResponseHook func(statusCode int, duration time.Duration, requestId string, err error)
+
+// ErrorHook is called once for every failed call made through the client,
+// after retries are exhausted. op is the name of the MNS API, such as
+// SendMessage or GetQueueAttributes.
+type ErrorHook func(op string, resource string, err error)
+
+func OnRequest(hook RequestHook) ClientOption {
+	return func(p *AliMNSClient) {
+		p.requestHooks = append(p.requestHooks, hook)
+	}
+}
+
+func OnResponse(hook ResponseHook) ClientOption {
+	return func(p *AliMNSClient) {
+		p.responseHooks = append(p.responseHooks, hook)
+	}
+}
+
+func OnError(hook ErrorHook) ClientOption {
+	return func(p *AliMNSClient) {
+		p.errorHooks = append(p.errorHooks, hook)
+	}
+}
+
+func (p *AliMNSClient) fireRequestHooks(method Method, resource string, headers map[string]string) {
+	if len(p.requestHooks) == 0 {
+		return
+	}
+
+	redacted := redactHeaders(headers)
+	for _, hook := range p.requestHooks {
+		hook(method, resource, redacted)
+	}
+}
+
+func (p *AliMNSClient) fireResponseHooks(resp *http.Response, duration time.Duration, err error) {
+	if len(p.responseHooks) == 0 {
+		return
+	}
+
+	statusCode, requestId := 0, ""
+	if resp != nil {
+		statusCode = resp.StatusCode
+		requestId = resp.Header.Get(MNS_REQUEST_ID)
+	}
+
+	for _, hook := range p.responseHooks {
+		hook(statusCode, duration, requestId, err)
+	}
+}
+
+type errorHookFirer interface {
+	fireErrorHooks(method Method, message interface{}, resource string, err error)
+}
+
+func (p *AliMNSClient) fireErrorHooks(method Method, message interface{}, resource string, err error) {
+	if len(p.errorHooks) == 0 {
+		return
+	}
+
+	op := OperationName(method, message, resource)
+	for _, hook := range p.errorHooks {
+		hook(op, resource, err)
+	}
+}
+
+func fireErrorHooks(client MNSClient, method Method, message interface{}, resource string, err error) {
+	if firer, ok := client.(errorHookFirer); ok {
+		firer.fireErrorHooks(method, message, resource, err)
+	}
+}
+
+// OperationName maps a request to the name of the MNS API it calls.
+func OperationName(method Method, message interface{}, resource string) string {
+	path, query := resource, ""
+	if i := strings.Index(resource, "?"); i >= 0 {
+		path, query = resource[:i], resource[i+1:]
+	}
+
+	hasParam := func(name string) bool {
+		for _, param := range strings.Split(query, "&") {
+			if strings.HasPrefix(param, name+"=") {
+				return true
+			}
+		}
+		return false
+	}
+
+	parts := strings.Split(path, "/")
+
+	switch {
+	case path == "" && hasParam("accountmeta"):
+		if method == GET {
+			return "GetAccountAttributes"
+		}
+		return "SetAccountAttributes"
+	case path == "queues" && method == GET:
+		return "ListQueue"
+	case len(parts) == 2 && parts[0] == "queues":
+		switch method {
+		case PUT:
+			if hasParam("metaoverride") {
+				return "SetQueueAttributes"
+			}
+			return "CreateQueue"
+		case GET:
+			return "GetQueueAttributes"
+		case DELETE:
+			return "DeleteQueue"
+		}
+	case len(parts) == 3 && parts[0] == "queues" && parts[2] == "messages":
+		batch := hasParam("numOfMessages")
+		switch method {
+		case POST:
+			switch message.(type) {
+			case BatchMessageSendRequest, *BatchMessageSendRequest,
+				wireBatchMessageSendRequest, *wireBatchMessageSendRequest:
+				return "BatchSendMessage"
+			}
+			return "SendMessage"
+		case GET:
+			if hasParam("peekonly") {
+				if batch {
+					return "BatchPeekMessage"
+				}
+				return "PeekMessage"
+			}
+			if batch {
+				return "BatchReceiveMessage"
+			}
+			return "ReceiveMessage"
+		case DELETE:
+			if hasParam("ReceiptHandle") {
+				return "DeleteMessage"
+			}
+			return "BatchDeleteMessage"
+		case PUT:
+			return "ChangeMessageVisibility"
+		}
+	}
+
+	return string(method) + " " + path
+}
@@ -0,0 +1,171 @@
+// Package kmskey provides an ali_mns.KeyProvider doing envelope encryption
+// with Aliyun KMS: every data key is generated by KMS and stored, encrypted
+// by the master key, alongside the ciphertext of the message.
+package kmskey
+
+import (
+	"encoding/base64"
+	"sync"
+	"time"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/kms"
+	"github.com/gogap/ali_mns"
+)
+
+const (
+	DefaultKeySpec    = "AES_256"
+	DefaultDataKeyTTL = 5 * time.Minute
+
+	// maxCachedKeys bounds the decrypted data keys kept by a Provider.
+	maxCachedKeys = 1024
+)
+
+// Client is the part of *kms.Client used by Provider.
+type Client interface {
+	GenerateDataKey(request *kms.GenerateDataKeyRequest) (response *kms.GenerateDataKeyResponse, err error)
+	Decrypt(request *kms.DecryptRequest) (response *kms.DecryptResponse, err error)
+}
+
+type Option func(*Provider)
+
+func WithKeySpec(keySpec string) Option {
+	return func(p *Provider) {
+		p.keySpec = keySpec
+	}
+}
+
+// WithDataKeyTTL sets how long a data key encrypts messages before a new one
+// is generated. Zero generates a data key per message.
+func WithDataKeyTTL(ttl time.Duration) Option {
+	return func(p *Provider) {
+		if ttl >= 0 {
+			p.dataKeyTTL = ttl
+		}
+	}
+}
+
+// WithEncryptionContext binds data keys to context, which must then be the
+// same on every producer and consumer.
+func WithEncryptionContext(context string) Option {
+	return func(p *Provider) {
+		p.encryptionContext = context
+	}
+}
+
+// WithClock makes the provider expire data keys by clock.
+func WithClock(clock ali_mns.Clock) Option {
+	return func(p *Provider) {
+		if clock != nil {
+			p.clock = clock
+		}
+	}
+}
+
+type Provider struct {
+	client            Client
+	keyId             string
+	keySpec           string
+	dataKeyTTL        time.Duration
+	encryptionContext string
+	clock             ali_mns.Clock
+
+	dataKey        []byte
+	dataKeyBlob    []byte
+	dataKeyExpires time.Time
+
+	cachedKeys map[string][]byte
+
+	locker sync.Mutex
+}
+
+// NewProvider generates data keys under the KMS master key keyId.
+func NewProvider(client Client, keyId string, opts ...Option) *Provider {
+	provider := &Provider{
+		client:     client,
+		keyId:      keyId,
+		keySpec:    DefaultKeySpec,
+		dataKeyTTL: DefaultDataKeyTTL,
+		clock:      ali_mns.SystemClock,
+		cachedKeys: make(map[string][]byte),
+	}
+
+	for _, opt := range opts {
+		opt(provider)
+	}
+
+	return provider
+}
+
+// EncryptionKey returns the current data key and its encrypted blob as key id.
+func (p *Provider) EncryptionKey() (key []byte, keyId []byte, err error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if p.dataKey != nil && p.clock.Now().Before(p.dataKeyExpires) {
+		return p.dataKey, p.dataKeyBlob, nil
+	}
+
+	request := kms.CreateGenerateDataKeyRequest()
+	request.KeyId = p.keyId
+	request.KeySpec = p.keySpec
+	request.EncryptionContext = p.encryptionContext
+
+	response, err := p.client.GenerateDataKey(request)
+	if err != nil {
+		return
+	}
+
+	if key, err = base64.StdEncoding.DecodeString(response.Plaintext); err != nil {
+		return
+	}
+
+	keyId = []byte(response.CiphertextBlob)
+
+	if p.dataKeyTTL > 0 {
+		p.dataKey = key
+		p.dataKeyBlob = keyId
+		p.dataKeyExpires = p.clock.Now().Add(p.dataKeyTTL)
+		p.cacheKey(response.CiphertextBlob, key)
+	}
+
+	return
+}
+
+// DecryptionKey decrypts the data key blob keyId with KMS.
+func (p *Provider) DecryptionKey(keyId []byte) (key []byte, err error) {
+	blob := string(keyId)
+
+	p.locker.Lock()
+	key, exist := p.cachedKeys[blob]
+	p.locker.Unlock()
+
+	if exist {
+		return
+	}
+
+	request := kms.CreateDecryptRequest()
+	request.CiphertextBlob = blob
+	request.EncryptionContext = p.encryptionContext
+
+	response, err := p.client.Decrypt(request)
+	if err != nil {
+		return
+	}
+
+	if key, err = base64.StdEncoding.DecodeString(response.Plaintext); err != nil {
+		return
+	}
+
+	p.locker.Lock()
+	p.cacheKey(blob, key)
+	p.locker.Unlock()
+
+	return
+}
+
+func (p *Provider) cacheKey(blob string, key []byte) {
+	if len(p.cachedKeys) >= maxCachedKeys {
+		p.cachedKeys = make(map[string][]byte)
+	}
+	p.cachedKeys[blob] = key
+}
@@ -0,0 +1,24 @@
+package ali_mns
+
+import (
+	"context"
+)
+
+// Limiter throttles the requests of a queue. *rate.Limiter of
+// golang.org/x/time/rate satisfies it, see the xrate package; shared
+// limiters let several instances stay under one QPS limit.
+type Limiter interface {
+	// Wait blocks until a request may be made or ctx is done.
+	Wait(ctx context.Context) error
+	// Allow reports whether a request may be made now, and takes its slot
+	// if so.
+	Allow() bool
+}
+
+// WithLimiter replaces the QPS limit of the queue with limiter. Throttling
+// by MNS then no longer lowers the request rate, that is up to limiter.
+func WithLimiter(limiter Limiter) QueueOption {
+	return func(p *MNSQueue) {
+		p.qpsLimiter = limiter
+	}
+}
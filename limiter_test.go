@@ -0,0 +1,122 @@
+package ali_mns_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gogap/ali_mns"
+)
+
+// countingLimiter counts its waits and, if block is set, holds them until
+// block is closed.
+type countingLimiter struct {
+	waits int32
+	block chan struct{}
+}
+
+func (p *countingLimiter) Wait(ctx context.Context) error {
+	atomic.AddInt32(&p.waits, 1)
+
+	if p.block == nil {
+		return nil
+	}
+
+	select {
+	case <-p.block:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *countingLimiter) Allow() bool {
+	return true
+}
+
+func TestLimiter(t *testing.T) {
+	message := ali_mns.MessageSendRequest{MessageBody: []byte("limited")}
+
+	for _, test := range []struct {
+		name string
+		call func(queue *ali_mns.MNSQueue, receiptHandle string) error
+	}{
+		{"SendMessage", func(queue *ali_mns.MNSQueue, _ string) error {
+			_, err := queue.SendMessage(message)
+			return err
+		}},
+		{"BatchSendMessage", func(queue *ali_mns.MNSQueue, _ string) error {
+			_, err := queue.BatchSendMessage(message, message, message)
+			return err
+		}},
+		{"DeleteMessage", func(queue *ali_mns.MNSQueue, receiptHandle string) error {
+			return queue.DeleteMessage(receiptHandle)
+		}},
+		{"BatchDeleteMessage", func(queue *ali_mns.MNSQueue, receiptHandle string) error {
+			return queue.BatchDeleteMessage(receiptHandle)
+		}},
+		{"ChangeMessageVisibility", func(queue *ali_mns.MNSQueue, receiptHandle string) error {
+			_, err := queue.ChangeMessageVisibility(receiptHandle, 60)
+			return err
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := &countingLimiter{}
+			server, queue := newTestQueue(t, ali_mns.WithLimiter(limiter))
+
+			if _, err := queue.SendMessage(message); err != nil {
+				t.Fatal(err)
+			}
+			// received from the server side, so no receive loop of queue
+			// waits on the limiter meanwhile
+			resp, err := receiveOne(t, server.Queue("test"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			atomic.StoreInt32(&limiter.waits, 0)
+
+			if err := test.call(queue, resp.ReceiptHandle); err != nil {
+				t.Fatal(err)
+			}
+			if waits := atomic.LoadInt32(&limiter.waits); waits != 1 {
+				t.Fatalf("waited %d times on the limiter, want once", waits)
+			}
+		})
+	}
+}
+
+func TestLimiterReplacesQPSLimit(t *testing.T) {
+	limiter := &countingLimiter{}
+	_, queue := newTestQueue(t, ali_mns.WithQPSLimit(1), ali_mns.WithLimiter(limiter))
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if _, err := queue.SendMessage(ali_mns.MessageSendRequest{MessageBody: []byte("unthrottled")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("5 sends took %s, the QPS limit was still applied", elapsed)
+	}
+	if waits := atomic.LoadInt32(&limiter.waits); waits != 5 {
+		t.Fatalf("waited %d times on the limiter, want 5", waits)
+	}
+}
+
+func TestLimiterWaitCancelled(t *testing.T) {
+	limiter := &countingLimiter{block: make(chan struct{})}
+	server, queue := newTestQueue(t, ali_mns.WithLimiter(limiter))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := queue.SendMessageContext(ctx, ali_mns.MessageSendRequest{MessageBody: []byte("never sent")}); err == nil {
+		t.Fatal("send succeeded while the limiter held it")
+	}
+	if active := server.Queue("test").Attributes().ActiveMessages; active != 0 {
+		t.Fatalf("queue holds %d messages, want none", active)
+	}
+}
@@ -0,0 +1,68 @@
+package ali_mns
+
+// Logger receives the diagnostics of clients, queues and consumers. fields
+// are alternating keys and values, e.g. "queue", name.
+type Logger interface {
+	Debug(msg string, fields ...interface{})
+	Info(msg string, fields ...interface{})
+	Warn(msg string, fields ...interface{})
+	Error(msg string, fields ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+// NopLogger drops everything, it is the default logger.
+var NopLogger Logger = nopLogger{}
+
+// loggerHolder lets queues and consumers default to the logger of the
+// client or queue they use.
+type loggerHolder interface {
+	getLogger() Logger
+}
+
+func loggerOf(v interface{}) Logger {
+	if holder, ok := v.(loggerHolder); ok {
+		return holder.getLogger()
+	}
+	return NopLogger
+}
+
+func WithLogger(logger Logger) ClientOption {
+	return func(p *AliMNSClient) {
+		if logger != nil {
+			p.logger = logger
+		}
+	}
+}
+
+// WithQueueLogger overrides the logger the queue takes from its client.
+func WithQueueLogger(logger Logger) QueueOption {
+	return func(p *MNSQueue) {
+		if logger != nil {
+			p.logger = logger
+		}
+	}
+}
+
+// WithConsumerLogger overrides the logger the consumer takes from its
+// queue.
+func WithConsumerLogger(logger Logger) ConsumerOption {
+	return func(p *Consumer) {
+		if logger != nil {
+			p.logger = logger
+		}
+	}
+}
+
+func (p *AliMNSClient) getLogger() Logger {
+	return p.logger
+}
+
+func (p *MNSQueue) getLogger() Logger {
+	return p.logger
+}
@@ -0,0 +1,33 @@
+package ali_mns
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"strings"
+
+	"github.com/gogap/errors"
+)
+
+// WithMD5Verification compares the MessageBodyMD5 returned by MNS for sent
+// and received messages with the digest of the body on the wire, failing
+// with ERR_MNS_MESSAGE_BODY_MD5_MISMATCH when they differ.
+func WithMD5Verification() QueueOption {
+	return func(p *MNSQueue) {
+		p.verifyMD5 = true
+	}
+}
+
+func (p *MNSQueue) checkMD5(messageId string, body string, expected string) (err error) {
+	if !p.verifyMD5 || expected == "" {
+		return
+	}
+
+	sum := md5.Sum([]byte(body))
+	actual := hex.EncodeToString(sum[:])
+
+	if !strings.EqualFold(actual, expected) {
+		err = wrapError(ERR_MNS_MESSAGE_BODY_MD5_MISMATCH.New(errors.Params{"id": messageId, "expected": expected, "actual": actual}))
+	}
+
+	return
+}
@@ -0,0 +1,87 @@
+package ali_mns_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/gogap/ali_mns"
+	"github.com/gogap/ali_mns/alimnstest"
+)
+
+var md5Element = regexp.MustCompile(`<MessageBodyMD5>[^<]*</MessageBodyMD5>`)
+
+// newCorruptMD5Server serves like alimnstest.Server, but answers with a
+// wrong MessageBodyMD5 when corrupt is set.
+func newCorruptMD5Server(t *testing.T, corrupt bool) (url string) {
+	server := alimnstest.NewServer()
+	t.Cleanup(server.Close)
+
+	wrapper := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !corrupt {
+			server.ServeHTTP(w, r)
+			return
+		}
+
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, r)
+
+		for key, values := range recorder.Header() {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(recorder.Code)
+		w.Write(md5Element.ReplaceAll(recorder.Body.Bytes(), []byte("<MessageBodyMD5>00000000000000000000000000000000</MessageBodyMD5>")))
+	}))
+	t.Cleanup(wrapper.Close)
+
+	return wrapper.URL
+}
+
+func TestMD5Verification(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		corrupt  bool
+		verify   bool
+		mismatch bool
+	}{
+		{"Matching", false, true, false},
+		{"Corrupted", true, true, true},
+		{"CorruptedUnverified", true, false, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			url := newCorruptMD5Server(t, test.corrupt)
+
+			client := ali_mns.NewAliMNSClient(url, "test-id", "test-secret")
+			if err := ali_mns.NewMNSQueueManagerWithClient(client).CreateQueue(url, "test", 0, 65536, 345600, 30, 0); err != nil {
+				t.Fatal(err)
+			}
+
+			var opts []ali_mns.QueueOption
+			if test.verify {
+				opts = append(opts, ali_mns.WithMD5Verification())
+			}
+			queue, err := ali_mns.NewMNSQueueWithOptions("test", client, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			message := ali_mns.MessageSendRequest{MessageBody: []byte("checked")}
+
+			_, err = queue.SendMessage(message)
+			if mismatch := ali_mns.ERR_MNS_MESSAGE_BODY_MD5_MISMATCH.IsEqual(err); mismatch != test.mismatch {
+				t.Fatalf("send: got error %v, want a mismatch: %t", err, test.mismatch)
+			}
+
+			_, err = queue.BatchSendMessage(message, message)
+			if mismatch := ali_mns.ERR_MNS_MESSAGE_BODY_MD5_MISMATCH.IsEqual(err); mismatch != test.mismatch {
+				t.Fatalf("batch send: got error %v, want a mismatch: %t", err, test.mismatch)
+			}
+
+			_, err = receiveOne(t, queue)
+			if mismatch := ali_mns.ERR_MNS_MESSAGE_BODY_MD5_MISMATCH.IsEqual(err); mismatch != test.mismatch {
+				t.Fatalf("receive: got error %v, want a mismatch: %t", err, test.mismatch)
+			}
+		})
+	}
+}
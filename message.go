@@ -2,7 +2,9 @@ package ali_mns
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"encoding/xml"
+	"net/http"
 
 	"github.com/gogap/errors"
 )
@@ -13,6 +15,8 @@ type MessageResponse struct {
 	Message   string   `xml:"Message,omitempty" json:"message,omitempty"`
 	RequestId string   `xml:"RequestId,omitempty" json:"request_id,omitempty"`
 	HostId    string   `xml:"HostId,omitempty" json:"host_id,omitempty"`
+
+	Meta ResponseMeta `xml:"-" json:"-"`
 }
 
 type ErrorMessageResponse struct {
@@ -47,51 +51,74 @@ type MessageSendResponse struct {
 }
 
 type BatchMessageSendResponse struct {
-	XMLName  xml.Name              `xml:"Messages" json:"-"`
-	Messages []MessageSendResponse `xml:"Message" json:"messages"`
+	XMLName   xml.Name              `xml:"Messages" json:"-"`
+	Messages  []MessageSendResponse `xml:"Message" json:"messages"`
+	RequestId string                `xml:"-" json:"request_id,omitempty"`
+
+	Meta ResponseMeta `xml:"-" json:"-"`
 }
 
+// CreateQueueRequest and QueueAttribute keep the misspelled JSON names
+// delay_senconds and polling_wait_secods they were released with, so JSON
+// written by earlier versions still decodes and existing consumers of it do
+// not break. Decoding also accepts delay_seconds and polling_wait_seconds.
 type CreateQueueRequest struct {
 	XMLName                xml.Name `xml:"Queue" json:"-"`
-	DelaySeconds           int32    `xml:"DelaySenconds,omitempty" json:"delay_senconds,omitempty"`
+	DelaySeconds           int32    `xml:"DelaySeconds,omitempty" json:"delay_senconds,omitempty"`
 	MaxMessageSize         int32    `xml:"MaximumMessageSize,omitempty" json:"maximum_message_size,omitempty"`
 	MessageRetentionPeriod int32    `xml:"MessageRetentionPeriod,omitempty" json:"message_retention_period,omitempty"`
 	VisibilityTimeout      int32    `xml:"VisibilityTimeout,omitempty" json:"visibility_timeout,omitempty"`
 	PollingWaitSeconds     int32    `xml:"PollingWaitSeconds,omitempty" json:"polling_wait_secods,omitempty"`
+	LoggingEnabled         *bool    `xml:"LoggingEnabled,omitempty" json:"logging_enabled,omitempty"`
+}
+
+func (p *CreateQueueRequest) UnmarshalJSON(data []byte) error {
+	type plain CreateQueueRequest
+	if err := json.Unmarshal(data, (*plain)(p)); err != nil {
+		return err
+	}
+	return unmarshalQueueJSONAliases(data, &p.DelaySeconds, &p.PollingWaitSeconds)
 }
 
 type MessageReceiveResponse struct {
 	MessageResponse
 	MessageId        string      `xml:"MessageId" json:"message_id"`
-	ReceiptHandle    string      `xml:"ReceiptHandle" json:"receipt_handle"`
+	ReceiptHandle    string      `xml:"ReceiptHandle,omitempty" json:"receipt_handle"`
 	MessageBodyMD5   string      `xml:"MessageBodyMD5" json:"message_body_md5"`
 	MessageBody      Base64Bytes `xml:"MessageBody" json:"message_body"`
 	EnqueueTime      int64       `xml:"EnqueueTime" json:"enqueue_time"`
-	NextVisibleTime  int64       `xml:"NextVisibleTime" json:"next_visible_time"`
+	NextVisibleTime  int64       `xml:"NextVisibleTime,omitempty" json:"next_visible_time"`
 	FirstDequeueTime int64       `xml:"FirstDequeueTime" json:"first_dequeue_time"`
 	DequeueCount     int64       `xml:"DequeueCount" json:"dequeue_count"`
 	Priority         int64       `xml:"Priority" json:"priority"`
 }
 
 type BatchMessageReceiveResponse struct {
-	XMLName  xml.Name                 `xml:"Messages" json:"-"`
-	Messages []MessageReceiveResponse `xml:"Message" json:"messages"`
+	XMLName   xml.Name                 `xml:"Messages" json:"-"`
+	Messages  []MessageReceiveResponse `xml:"Message" json:"messages"`
+	RequestId string                   `xml:"-" json:"request_id,omitempty"`
+
+	Meta ResponseMeta `xml:"-" json:"-"`
 }
 
 type MessageVisibilityChangeResponse struct {
 	XMLName         xml.Name `xml:"ChangeVisibility" json:"-"`
 	ReceiptHandle   string   `xml:"ReceiptHandle" json:"receipt_handle"`
 	NextVisibleTime int64    `xml:"NextVisibleTime" json:"next_visible_time"`
+	RequestId       string   `xml:"-" json:"request_id,omitempty"`
+
+	Meta ResponseMeta `xml:"-" json:"-"`
 }
 
 type QueueAttribute struct {
 	XMLName                xml.Name `xml:"Queue" json:"-"`
 	QueueName              string   `xml:"QueueName,omitempty" json:"queue_name,omitempty"`
-	DelaySeconds           int32    `xml:"DelaySenconds,omitempty" json:"delay_senconds,omitempty"`
+	DelaySeconds           int32    `xml:"DelaySeconds,omitempty" json:"delay_senconds,omitempty"`
 	MaxMessageSize         int32    `xml:"MaximumMessageSize,omitempty" json:"maximum_message_size,omitempty"`
 	MessageRetentionPeriod int32    `xml:"MessageRetentionPeriod,omitempty" json:"message_retention_period,omitempty"`
 	VisibilityTimeout      int32    `xml:"VisibilityTimeout,omitempty" json:"visibility_timeout,omitempty"`
 	PollingWaitSeconds     int32    `xml:"PollingWaitSeconds,omitempty" json:"polling_wait_secods,omitempty"`
+	LoggingEnabled         bool     `xml:"LoggingEnabled,omitempty" json:"logging_enabled,omitempty"`
 	ActiveMessages         int64    `xml:"ActiveMessages,omitempty" json:"active_messages,omitempty"`
 	InactiveMessages       int64    `xml:"InactiveMessages,omitempty" json:"inactive_messages,omitempty"`
 	DelayMessages          int64    `xml:"DelayMessages,omitempty" json:"delay_messages,omitempty"`
@@ -99,6 +126,34 @@ type QueueAttribute struct {
 	LastModifyTime         int64    `xml:"LastModifyTime,omitempty" json:"last_modify_time,omitempty"`
 }
 
+func (p *QueueAttribute) UnmarshalJSON(data []byte) error {
+	type plain QueueAttribute
+	if err := json.Unmarshal(data, (*plain)(p)); err != nil {
+		return err
+	}
+	return unmarshalQueueJSONAliases(data, &p.DelaySeconds, &p.PollingWaitSeconds)
+}
+
+// unmarshalQueueJSONAliases sets delay and wait from the correctly spelled
+// JSON names, if data has them.
+func unmarshalQueueJSONAliases(data []byte, delay, wait *int32) error {
+	aliases := struct {
+		DelaySeconds       *int32 `json:"delay_seconds"`
+		PollingWaitSeconds *int32 `json:"polling_wait_seconds"`
+	}{}
+	if err := json.Unmarshal(data, &aliases); err != nil {
+		return err
+	}
+
+	if aliases.DelaySeconds != nil {
+		*delay = *aliases.DelaySeconds
+	}
+	if aliases.PollingWaitSeconds != nil {
+		*wait = *aliases.PollingWaitSeconds
+	}
+	return nil
+}
+
 type Queue struct {
 	QueueURL string `xml:"QueueURL" json:"url"`
 }
@@ -106,7 +161,68 @@ type Queue struct {
 type Queues struct {
 	XMLName    xml.Name `xml:"Queues" json:"-"`
 	Queues     []Queue  `xml:"Queue" json:"queues"`
-	NextMarker string   `xml:"NextMarker" json:"next_marker"`
+	NextMarker string   `xml:"NextMarker,omitempty" json:"next_marker"`
+}
+
+// AccountAttribute holds the account level settings. An empty LoggingBucket
+// turns log delivery to OSS off.
+type AccountAttribute struct {
+	XMLName       xml.Name `xml:"Account" json:"-"`
+	LoggingBucket string   `xml:"LoggingBucket" json:"logging_bucket"`
+}
+
+type QueuesWithMeta struct {
+	XMLName    xml.Name         `xml:"Queues" json:"-"`
+	Queues     []QueueAttribute `xml:"Queue" json:"queues"`
+	NextMarker string           `xml:"NextMarker,omitempty" json:"next_marker"`
+}
+
+// ResponseMeta holds the HTTP details of the response a result was decoded
+// from.
+type ResponseMeta struct {
+	StatusCode int
+	Header     http.Header
+	RequestId  string
+}
+
+// responseMetaSetter is implemented by responses of successful calls, which
+// take the x-mns-request-id header as their request id.
+type responseMetaSetter interface {
+	setResponseMeta(meta ResponseMeta)
+}
+
+func (p *MessageResponse) setResponseMeta(meta ResponseMeta) {
+	p.Meta = meta
+	if meta.RequestId != "" {
+		p.RequestId = meta.RequestId
+	}
+}
+
+func (p *MessageVisibilityChangeResponse) setResponseMeta(meta ResponseMeta) {
+	p.Meta = meta
+	if meta.RequestId != "" {
+		p.RequestId = meta.RequestId
+	}
+}
+
+func (p *BatchMessageSendResponse) setResponseMeta(meta ResponseMeta) {
+	p.Meta = meta
+	if meta.RequestId != "" {
+		p.RequestId = meta.RequestId
+	}
+	for i := range p.Messages {
+		p.Messages[i].setResponseMeta(meta)
+	}
+}
+
+func (p *BatchMessageReceiveResponse) setResponseMeta(meta ResponseMeta) {
+	p.Meta = meta
+	if meta.RequestId != "" {
+		p.RequestId = meta.RequestId
+	}
+	for i := range p.Messages {
+		p.Messages[i].setResponseMeta(meta)
+	}
 }
 
 type Base64Bytes []byte
@@ -0,0 +1,72 @@
+package ali_mns
+
+import (
+	"time"
+)
+
+const (
+	DefaultMessagePriority int64 = 8
+
+	MinMessagePriority int64 = 1
+	MaxMessagePriority int64 = 16
+
+	MaxMessageDelay = 7 * 24 * time.Hour
+)
+
+// MessageBuilder builds a MessageSendRequest, validating its fields on Build:
+//
+//	message, err := NewMessage(body).WithDelay(30 * time.Second).WithPriority(8).Build()
+type MessageBuilder struct {
+	message MessageSendRequest
+	opts    []SendOption
+}
+
+func NewMessage(body []byte) *MessageBuilder {
+	return &MessageBuilder{
+		message: MessageSendRequest{
+			MessageBody: Base64Bytes(body),
+			Priority:    DefaultMessagePriority,
+		},
+	}
+}
+
+// WithDelay keeps the message invisible for delay, rounded up to a second.
+func (p *MessageBuilder) WithDelay(delay time.Duration) *MessageBuilder {
+	p.message.DelaySeconds = int64((delay + time.Second - 1) / time.Second)
+	return p
+}
+
+func (p *MessageBuilder) WithPriority(priority int64) *MessageBuilder {
+	p.message.Priority = priority
+	return p
+}
+
+func (p *MessageBuilder) WithProperties(properties map[string]string) *MessageBuilder {
+	p.opts = append(p.opts, WithProperties(properties))
+	return p
+}
+
+func (p *MessageBuilder) Build() (message MessageSendRequest, err error) {
+	message = p.message
+	for _, opt := range p.opts {
+		opt(&message)
+	}
+
+	if err = checkMessage(message); err != nil {
+		return MessageSendRequest{}, err
+	}
+
+	return
+}
+
+func checkMessage(message MessageSendRequest) (err error) {
+	if message.DelaySeconds < 0 || message.DelaySeconds > int64(MaxMessageDelay/time.Second) {
+		return ERR_MNS_MESSAGE_DELAY_SECONDS_RANGE_ERROR.New()
+	}
+
+	if message.Priority < MinMessagePriority || message.Priority > MaxMessagePriority {
+		return ERR_MNS_MESSAGE_PRIORITY_RANGE_ERROR.New()
+	}
+
+	return
+}
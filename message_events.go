@@ -0,0 +1,121 @@
+package ali_mns
+
+import (
+	"time"
+)
+
+type MessageEventType int
+
+const (
+	MessageSent MessageEventType = iota
+	MessageSendFailed
+	MessageReceived
+	MessageDeleted
+	MessageVisibilityChanged
+	MessageDeadLettered
+)
+
+func (p MessageEventType) String() string {
+	switch p {
+	case MessageSent:
+		return "sent"
+	case MessageSendFailed:
+		return "send-failed"
+	case MessageReceived:
+		return "received"
+	case MessageDeleted:
+		return "deleted"
+	case MessageVisibilityChanged:
+		return "visibility-changed"
+	case MessageDeadLettered:
+		return "dead-lettered"
+	}
+	return "unknown"
+}
+
+// MessageEvent describes something that happened to a message of Queue.
+// MessageId is unknown for deletes and visibility changes, which only
+// carry ReceiptHandle, and for failed sends. Err is only set for
+// MessageSendFailed.
+type MessageEvent struct {
+	Type          MessageEventType
+	Queue         string
+	MessageId     string
+	ReceiptHandle string
+	DequeueCount  int64
+	Err           error
+	Time          time.Time
+}
+
+// MessageHook is called synchronously on the goroutine of the call that
+// caused the event, so it should return quickly.
+type MessageHook func(event MessageEvent)
+
+// WithMessageHook calls hook for every message the queue sends, receives,
+// deletes or changes the visibility of, and for every message a consumer
+// of the queue moves to its dead-letter queue. Peeks and raw receives
+// fire no events.
+func WithMessageHook(hook MessageHook) QueueOption {
+	return func(p *MNSQueue) {
+		p.messageHooks = append(p.messageHooks, hook)
+	}
+}
+
+type messageEventFirer interface {
+	fireMessageEvent(event MessageEvent)
+}
+
+func (p *MNSQueue) fireMessageEvent(event MessageEvent) {
+	if len(p.messageHooks) == 0 {
+		return
+	}
+
+	event.Queue = p.name
+	event.Time = p.clock.Now()
+
+	for _, hook := range p.messageHooks {
+		hook(event)
+	}
+}
+
+func fireMessageEvent(queue AliMNSQueue, event MessageEvent) {
+	if firer, ok := queue.(messageEventFirer); ok {
+		firer.fireMessageEvent(event)
+	}
+}
+
+func (p *MNSQueue) fireReceived(message MessageReceiveResponse) {
+	p.fireMessageEvent(MessageEvent{
+		Type:          MessageReceived,
+		MessageId:     message.MessageId,
+		ReceiptHandle: message.ReceiptHandle,
+		DequeueCount:  message.DequeueCount,
+	})
+}
+
+// fireBatchSent fires an event for each of count messages of a batch send,
+// failed ones included. If the whole send failed every message failed with
+// err.
+func (p *MNSQueue) fireBatchSent(count int, resp BatchMessageSendResponse, err error) {
+	if len(p.messageHooks) == 0 {
+		return
+	}
+
+	entries := resp.Result().Entries
+
+	for i := 0; i < count; i++ {
+		if i >= len(entries) {
+			if err != nil {
+				p.fireMessageEvent(MessageEvent{Type: MessageSendFailed, Err: err})
+			}
+			continue
+		}
+
+		if e := entries[i].Err(); e != nil {
+			p.fireMessageEvent(MessageEvent{Type: MessageSendFailed, Err: e})
+			continue
+		}
+
+		p.fireMessageEvent(MessageEvent{Type: MessageSent, MessageId: entries[i].Response.MessageId})
+	}
+}
@@ -0,0 +1,82 @@
+package ali_mns
+
+import (
+	"sync"
+	"time"
+)
+
+// lagSmoothing is the weight of the latest message in the moving averages
+// of LagStats, high enough for a growing lag to show within a few batches.
+const lagSmoothing = 0.2
+
+// LagStats describes how late received messages are. Age is the time from
+// EnqueueTime to receiving the message, FirstDequeueLatency the time from
+// EnqueueTime to the first receive of the message, so a growing Age with a
+// flat FirstDequeueLatency points at redeliveries rather than a backlog.
+// Averages are exponential moving averages; both depend on the clocks of
+// this host and MNS agreeing.
+type LagStats struct {
+	Received                   int64         `json:"received"`
+	LastAge                    time.Duration `json:"last_age"`
+	AverageAge                 time.Duration `json:"average_age"`
+	AverageFirstDequeueLatency time.Duration `json:"average_first_dequeue_latency"`
+}
+
+type lagStats struct {
+	received            int64
+	lastAge             time.Duration
+	averageAge          float64
+	averageFirstDequeue float64
+	clock               Clock
+	locker              sync.Mutex
+}
+
+func (p *lagStats) record(message MessageReceiveResponse) {
+	if message.EnqueueTime <= 0 {
+		return
+	}
+
+	enqueued := time.Unix(0, message.EnqueueTime*int64(time.Millisecond))
+
+	age := p.clock.Now().Sub(enqueued)
+	if age < 0 {
+		age = 0
+	}
+
+	firstDequeue := time.Duration(0)
+	if message.FirstDequeueTime > message.EnqueueTime {
+		firstDequeue = time.Duration(message.FirstDequeueTime-message.EnqueueTime) * time.Millisecond
+	}
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if p.received == 0 {
+		p.averageAge = float64(age)
+		p.averageFirstDequeue = float64(firstDequeue)
+	} else {
+		p.averageAge += lagSmoothing * (float64(age) - p.averageAge)
+		p.averageFirstDequeue += lagSmoothing * (float64(firstDequeue) - p.averageFirstDequeue)
+	}
+
+	p.received++
+	p.lastAge = age
+}
+
+func (p *lagStats) snapshot() LagStats {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	return LagStats{
+		Received:                   p.received,
+		LastAge:                    p.lastAge,
+		AverageAge:                 time.Duration(p.averageAge),
+		AverageFirstDequeueLatency: time.Duration(p.averageFirstDequeue),
+	}
+}
+
+// received accounts for a message handed out by a receive call.
+func (p *MNSQueue) received(message MessageReceiveResponse) {
+	p.stats.lag.record(message)
+	p.fireReceived(message)
+}
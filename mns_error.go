@@ -0,0 +1,136 @@
+package ali_mns
+
+import (
+	"time"
+
+	"github.com/gogap/errors"
+)
+
+// Sentinel errors to match returned errors with errors.Is, e.g.
+//
+//	if errors.Is(err, ali_mns.ErrQueueNotExist) {
+//	}
+//
+// They match errors of requests to MNS and of sending messages. Returned
+// errors still satisfy errors.ErrCode, so errors.As and the IsEqual method of
+// the ERR_* templates keep working.
+var (
+	ErrAccessDenied             = newSentinel(ERR_MNS_ACCESS_DENIED)
+	ErrInvalidAccessKeyId       = newSentinel(ERR_MNS_INVALID_ACCESS_KEY_ID)
+	ErrInternalError            = newSentinel(ERR_MNS_INTERNAL_ERROR)
+	ErrInvalidArgument          = newSentinel(ERR_MNS_INVALID_ARGUMENT)
+	ErrSignatureMismatch        = newSentinel(ERR_MNS_SIGNATURE_DOES_NOT_MATCH)
+	ErrTimeExpired              = newSentinel(ERR_MNS_TIME_EXPIRED)
+	ErrQpsLimitExceeded         = newSentinel(ERR_MNS_QPS_LIMIT_EXCEEDED)
+	ErrMessageNotExist          = newSentinel(ERR_MNS_MESSAGE_NOT_EXIST)
+	ErrReceiptHandleError       = newSentinel(ERR_MNS_RECEIPT_HANDLE_ERROR)
+	ErrQueueNotExist            = newSentinel(ERR_MNS_QUEUE_NOT_EXIST)
+	ErrQueueAlreadyExist        = newSentinel(ERR_MNS_QUEUE_ALREADY_EXIST)
+	ErrQueueDeletedRecently     = newSentinel(ERR_MNS_QUEUE_DELETED_RECENTLY)
+	ErrTopicAlreadyExist        = newSentinel(ERR_MNS_TOPIC_ALREADY_EXIST)
+	ErrTopicNotExist            = newSentinel(ERR_MNS_TOPIC_NOT_EXIST)
+	ErrSubscriptionAlreadyExist = newSentinel(ERR_MNS_SUBSCRIPTION_ALREADY_EXIST)
+	ErrSubscriptionNotExist     = newSentinel(ERR_MNS_SUBSCRIPTION_NOT_EXIST)
+	ErrUnknownCode              = newSentinel(ERR_MNS_UNKNOWN_CODE)
+
+	ErrSendRequestFailed    = newSentinel(ERR_SEND_REQUEST_FAILED)
+	ErrCircuitBreakerOpen   = newSentinel(ERR_CIRCUIT_BREAKER_OPEN)
+	ErrBatchPartialFailure  = newSentinel(ERR_MNS_BATCH_SEND_PARTIAL_FAILURE)
+	ErrMessageTooLarge      = newSentinel(ERR_MNS_MESSAGE_TOO_LARGE)
+	ErrMessageBodyCorrupted = newSentinel(ERR_MNS_MESSAGE_BODY_MD5_MISMATCH)
+)
+
+type sentinelError struct {
+	namespace string
+	code      uint64
+	message   string
+}
+
+func newSentinel(template errors.ErrCodeTemplate) error {
+	errCode := template.New()
+
+	return &sentinelError{
+		namespace: errCode.Namespace(),
+		code:      errCode.Code(),
+		message:   errCode.Error(),
+	}
+}
+
+func (p *sentinelError) Error() string {
+	return p.message
+}
+
+// MNSError is the type of the errors returned by this package for failed
+// requests and sending messages, see errors.As. Besides the details of error
+// responses of MNS it adds errors.Is support to an errors.ErrCode.
+type MNSError struct {
+	errors.ErrCode
+
+	response   ErrorMessageResponse
+	resource   string
+	statusCode int
+	rawBody    []byte
+	cause      error
+	retryAfter time.Duration
+}
+
+// ErrorCode returns the MNS error code, such as QueueNotExist, empty if the
+// request did not get an error response.
+func (p *MNSError) ErrorCode() string {
+	return p.response.Code
+}
+
+func (p *MNSError) ErrorMessage() string {
+	return p.response.Message
+}
+
+func (p *MNSError) RequestId() string {
+	return p.response.RequestId
+}
+
+func (p *MNSError) HostId() string {
+	return p.response.HostId
+}
+
+func (p *MNSError) Resource() string {
+	return p.resource
+}
+
+// StatusCode returns the HTTP status of the error response, zero if there
+// was none.
+func (p *MNSError) StatusCode() int {
+	return p.statusCode
+}
+
+// RawBody returns the start of an error response that could not be decoded,
+// such as the HTML page of a proxy.
+func (p *MNSError) RawBody() []byte {
+	return p.rawBody
+}
+
+func (p *MNSError) Is(target error) bool {
+	if sentinel, ok := target.(*sentinelError); ok {
+		return p.Code() == sentinel.code && p.Namespace() == sentinel.namespace
+	}
+	return false
+}
+
+// Unwrap returns the error of the HTTP client for requests that could not
+// be sent, so errors.As finds a net.Error. Its message is not redacted.
+func (p *MNSError) Unwrap() error {
+	if p.cause != nil {
+		return p.cause
+	}
+	return p.ErrCode
+}
+
+// wrapError makes err match the sentinels if it is an errors.ErrCode.
+func wrapError(err error) error {
+	switch e := err.(type) {
+	case *MNSError:
+		return e
+	case errors.ErrCode:
+		return &MNSError{ErrCode: e}
+	}
+	return err
+}
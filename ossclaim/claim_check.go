@@ -0,0 +1,201 @@
+package ossclaim
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+
+	"github.com/gogap/ali_mns"
+)
+
+const (
+	DefaultKeyPrefix = "ali_mns/claim-check/"
+
+	// DefaultThreshold is the largest body sent inline; its base64 encoding
+	// still fits the 64KB MNS message size limit.
+	DefaultThreshold = 48 * 1024
+
+	// keyIdSize is the number of random bytes of a key, hex encoded after
+	// the key prefix.
+	keyIdSize = 16
+)
+
+var claimMarker = []byte(`{"ali_mns_claim_check":`)
+
+type claim struct {
+	Check struct {
+		Bucket string `json:"bucket"`
+		Key    string `json:"key"`
+		Size   int    `json:"size"`
+	} `json:"ali_mns_claim_check"`
+}
+
+type Option func(*ClaimCheck)
+
+func WithThreshold(threshold int) Option {
+	return func(p *ClaimCheck) {
+		if threshold > 0 {
+			p.threshold = threshold
+		}
+	}
+}
+
+func WithKeyPrefix(prefix string) Option {
+	return func(p *ClaimCheck) {
+		p.keyPrefix = prefix
+	}
+}
+
+// WithDeleteErrorHandler is told about objects that could not be deleted
+// after their message was handled. The message is still acknowledged, so
+// such objects are left to a bucket lifecycle rule.
+func WithDeleteErrorHandler(handler func(key string, err error)) Option {
+	return func(p *ClaimCheck) {
+		p.deleteErrorHandler = handler
+	}
+}
+
+// ClaimCheck stores bodies larger than its threshold in an OSS bucket and
+// sends a small pointer message instead. Handler resolves such pointers on
+// the consumer side and deletes the object once the message was handled.
+type ClaimCheck struct {
+	bucket             *oss.Bucket
+	threshold          int
+	keyPrefix          string
+	deleteErrorHandler func(key string, err error)
+}
+
+func New(bucket *oss.Bucket, opts ...Option) *ClaimCheck {
+	claimCheck := &ClaimCheck{
+		bucket:    bucket,
+		threshold: DefaultThreshold,
+		keyPrefix: DefaultKeyPrefix,
+	}
+
+	for _, opt := range opts {
+		opt(claimCheck)
+	}
+
+	return claimCheck
+}
+
+// Send sends message to queue, through OSS if its body exceeds the threshold.
+func (p *ClaimCheck) Send(queue ali_mns.AliMNSQueue, message ali_mns.MessageSendRequest) (resp ali_mns.MessageSendResponse, err error) {
+	if message, err = p.Store(message); err != nil {
+		return
+	}
+
+	return queue.SendMessage(message)
+}
+
+// Store uploads the body of message if it exceeds the threshold and returns
+// the pointer message to send in its place, or message itself.
+func (p *ClaimCheck) Store(message ali_mns.MessageSendRequest) (stored ali_mns.MessageSendRequest, err error) {
+	if len(message.MessageBody) <= p.threshold {
+		return message, nil
+	}
+
+	var key string
+	if key, err = p.newKey(); err != nil {
+		return
+	}
+
+	if err = p.bucket.PutObject(key, bytes.NewReader(message.MessageBody)); err != nil {
+		return
+	}
+
+	c := claim{}
+	c.Check.Bucket = p.bucket.BucketName
+	c.Check.Key = key
+	c.Check.Size = len(message.MessageBody)
+
+	var body []byte
+	if body, err = json.Marshal(c); err != nil {
+		return
+	}
+
+	stored = message
+	stored.MessageBody = ali_mns.Base64Bytes(body)
+
+	return
+}
+
+// Resolve replaces the body of a pointer message with the stored payload.
+// key is empty if message was sent inline. Only pointers to keys Store could
+// have made in its bucket are followed, others are taken as inline bodies,
+// so senders cannot make Handler read or delete any other object.
+func (p *ClaimCheck) Resolve(message ali_mns.MessageReceiveResponse) (resolved ali_mns.MessageReceiveResponse, key string, err error) {
+	if !bytes.HasPrefix(message.MessageBody, claimMarker) {
+		return message, "", nil
+	}
+
+	c := claim{}
+	if json.Unmarshal(message.MessageBody, &c) != nil || !p.owns(c) {
+		return message, "", nil
+	}
+
+	body, e := p.bucket.GetObject(c.Check.Key)
+	if e != nil {
+		err = e
+		return
+	}
+	defer body.Close()
+
+	resolved = message
+	if resolved.MessageBody, err = ioutil.ReadAll(body); err != nil {
+		return
+	}
+
+	return resolved, c.Check.Key, nil
+}
+
+// Handler wraps handler so it receives resolved messages. The object is
+// deleted only after handler succeeded, so redelivered messages still find it.
+func (p *ClaimCheck) Handler(handler ali_mns.MessageHandler) ali_mns.MessageHandler {
+	return func(message ali_mns.MessageReceiveResponse) (err error) {
+		resolved, key, err := p.Resolve(message)
+		if err != nil {
+			return
+		}
+
+		if err = handler(resolved); err != nil || key == "" {
+			return
+		}
+
+		if e := p.bucket.DeleteObject(key); e != nil && p.deleteErrorHandler != nil {
+			p.deleteErrorHandler(key, e)
+		}
+
+		return nil
+	}
+}
+
+// owns reports whether c points to an object of the bucket with a key as
+// made by newKey.
+func (p *ClaimCheck) owns(c claim) bool {
+	if c.Check.Bucket != p.bucket.BucketName || !strings.HasPrefix(c.Check.Key, p.keyPrefix) {
+		return false
+	}
+
+	id := strings.TrimPrefix(c.Check.Key, p.keyPrefix)
+	if len(id) != 2*keyIdSize {
+		return false
+	}
+
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+func (p *ClaimCheck) newKey() (key string, err error) {
+	id := make([]byte, keyIdSize)
+	if _, err = rand.Read(id); err != nil {
+		return
+	}
+
+	return p.keyPrefix + hex.EncodeToString(id), nil
+}
@@ -0,0 +1,35 @@
+package ossclaim
+
+import (
+	"testing"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+
+	"github.com/gogap/ali_mns"
+)
+
+func TestResolveIgnoresForeignPointers(t *testing.T) {
+	claimCheck := New(&oss.Bucket{BucketName: "claims"})
+
+	for _, test := range []struct {
+		name string
+		body string
+	}{
+		{"OtherBucket", `{"ali_mns_claim_check":{"bucket":"other","key":"ali_mns/claim-check/00112233445566778899aabbccddeeff"}}`},
+		{"OtherPrefix", `{"ali_mns_claim_check":{"bucket":"claims","key":"backups/00112233445566778899aabbccddeeff"}}`},
+		{"NotGenerated", `{"ali_mns_claim_check":{"bucket":"claims","key":"ali_mns/claim-check/../../backups/db"}}`},
+		{"Malformed", `{"ali_mns_claim_check":`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			message := ali_mns.MessageReceiveResponse{MessageBody: ali_mns.Base64Bytes(test.body)}
+
+			resolved, key, err := claimCheck.Resolve(message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key != "" || string(resolved.MessageBody) != test.body {
+				t.Errorf("resolved to key %q and body %q, want the inline body", key, resolved.MessageBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package oteltrace
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gogap/ali_mns"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = "github.com/gogap/ali_mns"
+)
+
+type options struct {
+	tracerProvider trace.TracerProvider
+	propagator     propagation.TextMapPropagator
+}
+
+type Option func(*options)
+
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(p *options) {
+		p.tracerProvider = provider
+	}
+}
+
+func WithPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(p *options) {
+		p.propagator = propagator
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		tracerProvider: otel.GetTracerProvider(),
+		propagator:     otel.GetTextMapPropagator(),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Middleware creates a client span for every call made through the client,
+// named after the MNS API, e.g. "MNS SendMessage". Pass it to
+// ali_mns.WithMiddleware. Spans are children of the span of the context of
+// the call, so send with it end to end:
+//
+//	queue.(ali_mns.ContextMessageSender).SendMessageContext(ctx, message)
+//
+// and put Inject(ctx) on the message for the consumer to continue the trace.
+// Middlewares in front of it must pass the context on, see
+// ali_mns.SendWithContext, or spans become roots of new traces.
+func Middleware(opts ...Option) ali_mns.Middleware {
+	tracer := newOptions(opts).tracerProvider.Tracer(instrumentationName)
+
+	return func(next ali_mns.Sender) ali_mns.Sender {
+		return ali_mns.ContextSenderFunc(func(ctx context.Context, method ali_mns.Method, headers map[string]string, message interface{}, resource string) (resp *http.Response, err error) {
+			op := ali_mns.OperationName(method, message, resource)
+
+			attrs := []attribute.KeyValue{
+				attribute.String("messaging.system", "ali_mns"),
+				attribute.String("rpc.method", op),
+			}
+			if queue := queueName(resource); queue != "" {
+				attrs = append(attrs, attribute.String("messaging.destination.name", queue))
+			}
+
+			ctx, span := tracer.Start(ctx, "MNS "+op,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(attrs...))
+			defer span.End()
+
+			resp, err = ali_mns.SendWithContext(ctx, next, method, headers, message, resource)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				return
+			}
+
+			span.SetAttributes(
+				attribute.Int("http.response.status_code", resp.StatusCode),
+				attribute.String("ali_mns.request_id", resp.Header.Get(ali_mns.MNS_REQUEST_ID)),
+			)
+			if resp.StatusCode >= http.StatusBadRequest {
+				span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+			}
+
+			return
+		})
+	}
+}
+
+func queueName(resource string) string {
+	if i := strings.Index(resource, "?"); i >= 0 {
+		resource = resource[:i]
+	}
+
+	parts := strings.Split(resource, "/")
+	if len(parts) >= 2 && parts[0] == "queues" {
+		return parts[1]
+	}
+	return ""
+}
+
+// Inject carries the trace context of ctx in the envelope properties of the
+// message, see ali_mns.WithProperties. The body is left alone if ctx has no
+// trace context.
+func Inject(ctx context.Context, opts ...Option) ali_mns.SendOption {
+	carrier := propagation.MapCarrier{}
+	newOptions(opts).propagator.Inject(ctx, carrier)
+
+	if len(carrier) == 0 {
+		return func(*ali_mns.MessageSendRequest) {}
+	}
+
+	return ali_mns.WithProperties(carrier)
+}
+
+// Extract returns ctx with the trace context the producer injected into
+// message, so spans of the consumer continue its trace.
+func Extract(ctx context.Context, message ali_mns.MessageReceiveResponse, opts ...Option) context.Context {
+	properties := message.Properties()
+	if len(properties) == 0 {
+		return ctx
+	}
+
+	return newOptions(opts).propagator.Extract(ctx, propagation.MapCarrier(properties))
+}
@@ -0,0 +1,162 @@
+package prommetrics
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gogap/ali_mns"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	DefaultNamespace = "ali_mns"
+)
+
+// Collector is a prometheus.Collector for clients, queues and consumers of
+// ali_mns. Nothing is registered by itself: pass the collector to
+// prometheus.MustRegister and the option of ClientOption to the clients
+// whose request latency should be observed.
+type Collector struct {
+	latency *prometheus.HistogramVec
+
+	clientErrors         *prometheus.Desc
+	clientErrorResponses *prometheus.Desc
+	queueQPS             *prometheus.Desc
+	queueRequests        *prometheus.Desc
+	queueRequestErrors   *prometheus.Desc
+	queueMessageAge      *prometheus.Desc
+	queueFirstDequeue    *prometheus.Desc
+	consumerMessages     *prometheus.Desc
+
+	clients   map[string]ali_mns.ErrorStatsReporter
+	queues    map[string]ali_mns.StatsReporter
+	consumers map[string]*ali_mns.Consumer
+	locker    sync.RWMutex
+}
+
+func NewCollector(namespace ...string) *Collector {
+	ns := DefaultNamespace
+	if len(namespace) == 1 {
+		ns = namespace[0]
+	}
+
+	return &Collector{
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: ns,
+			Name:      "request_duration_seconds",
+			Help:      "Latency of MNS requests by HTTP status, 0 if no response was received.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"status"}),
+
+		clientErrors:         prometheus.NewDesc(ns+"_client_errors_total", "Failed requests by MNS error code.", []string{"client", "code"}, nil),
+		clientErrorResponses: prometheus.NewDesc(ns+"_client_error_responses_total", "Failed requests by HTTP status.", []string{"client", "status"}, nil),
+		queueQPS:             prometheus.NewDesc(ns+"_queue_qps", "Requests per second of the queue.", []string{"queue"}, nil),
+		queueRequests:        prometheus.NewDesc(ns+"_queue_requests_total", "Calls of the queue by MNS API.", []string{"queue", "operation"}, nil),
+		queueRequestErrors:   prometheus.NewDesc(ns+"_queue_request_errors_total", "Failed calls of the queue by MNS API.", []string{"queue", "operation"}, nil),
+		queueMessageAge:      prometheus.NewDesc(ns+"_queue_message_age_seconds", "Moving average of the time received messages spent in the queue.", []string{"queue"}, nil),
+		queueFirstDequeue:    prometheus.NewDesc(ns+"_queue_first_dequeue_latency_seconds", "Moving average of the time from enqueue to first receive of received messages.", []string{"queue"}, nil),
+		consumerMessages:     prometheus.NewDesc(ns+"_consumer_messages_total", "Messages of the consumer by result.", []string{"consumer", "result"}, nil),
+
+		clients:   make(map[string]ali_mns.ErrorStatsReporter),
+		queues:    make(map[string]ali_mns.StatsReporter),
+		consumers: make(map[string]*ali_mns.Consumer),
+	}
+}
+
+// ClientOption observes the latency of every request of the client.
+func (p *Collector) ClientOption() ali_mns.ClientOption {
+	return ali_mns.OnResponse(func(statusCode int, duration time.Duration, requestId string, err error) {
+		p.latency.WithLabelValues(strconv.Itoa(statusCode)).Observe(duration.Seconds())
+	})
+}
+
+// AddClient exports the error counts of client, see AliMNSClient.ErrorStats.
+// Clients that are no ali_mns.ErrorStatsReporter are ignored.
+func (p *Collector) AddClient(name string, client ali_mns.MNSClient) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if reporter, ok := client.(ali_mns.ErrorStatsReporter); ok {
+		p.clients[name] = reporter
+	}
+}
+
+// AddQueue exports the stats of queue under its name.
+// Queues that are no ali_mns.StatsReporter are ignored.
+func (p *Collector) AddQueue(queue ali_mns.AliMNSQueue) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if reporter, ok := queue.(ali_mns.StatsReporter); ok {
+		p.queues[queue.Name()] = reporter
+	}
+}
+
+func (p *Collector) AddConsumer(name string, consumer *ali_mns.Consumer) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.consumers[name] = consumer
+}
+
+func (p *Collector) Describe(ch chan<- *prometheus.Desc) {
+	p.latency.Describe(ch)
+
+	ch <- p.clientErrors
+	ch <- p.clientErrorResponses
+	ch <- p.queueQPS
+	ch <- p.queueRequests
+	ch <- p.queueRequestErrors
+	ch <- p.queueMessageAge
+	ch <- p.queueFirstDequeue
+	ch <- p.consumerMessages
+}
+
+func (p *Collector) Collect(ch chan<- prometheus.Metric) {
+	p.latency.Collect(ch)
+
+	p.locker.RLock()
+	defer p.locker.RUnlock()
+
+	for name, client := range p.clients {
+		stats := client.ErrorStats()
+		for code, count := range stats.Codes {
+			ch <- prometheus.MustNewConstMetric(p.clientErrors, prometheus.CounterValue, float64(count), name, code)
+		}
+		for status, count := range stats.Statuses {
+			ch <- prometheus.MustNewConstMetric(p.clientErrorResponses, prometheus.CounterValue, float64(count), name, strconv.Itoa(status))
+		}
+	}
+
+	for name, queue := range p.queues {
+		stats := queue.Stats()
+		ch <- prometheus.MustNewConstMetric(p.queueQPS, prometheus.GaugeValue, float64(stats.QPS), name)
+		ch <- prometheus.MustNewConstMetric(p.queueMessageAge, prometheus.GaugeValue, stats.Lag.AverageAge.Seconds(), name)
+		ch <- prometheus.MustNewConstMetric(p.queueFirstDequeue, prometheus.GaugeValue, stats.Lag.AverageFirstDequeueLatency.Seconds(), name)
+		for op, count := range stats.Operations {
+			ch <- prometheus.MustNewConstMetric(p.queueRequests, prometheus.CounterValue, float64(count), name, op)
+		}
+		for op, count := range stats.Errors {
+			ch <- prometheus.MustNewConstMetric(p.queueRequestErrors, prometheus.CounterValue, float64(count), name, op)
+		}
+	}
+
+	for name, consumer := range p.consumers {
+		stats := consumer.Stats()
+		for _, result := range []struct {
+			name  string
+			count int64
+		}{
+			{"received", stats.Received},
+			{"processed", stats.Processed},
+			{"failed", stats.Failed},
+			{"acked", stats.Acked},
+			{"nacked", stats.Nacked},
+			{"dead_lettered", stats.DeadLettered},
+			{"duplicate", stats.Duplicates},
+		} {
+			ch <- prometheus.MustNewConstMetric(p.consumerMessages, prometheus.CounterValue, float64(result.count), name, result.name)
+		}
+	}
+}
@@ -1,36 +1,62 @@
 package ali_mns
 
 import (
-	"sync/atomic"
+	"sync"
 )
 
 type QPSMonitor struct {
-	latestIndex  int32
 	delaySecond  int32
 	totalQueries []int32
+	seconds      []int64
+	clock        Clock
+	locker       sync.Mutex
 }
 
 func (p *QPSMonitor) Pulse() {
-	index := int32(now().Second()) % p.delaySecond
+	second := p.clock.Now().Unix()
+	index := second % int64(p.delaySecond)
 
-	if p.latestIndex != index {
-		atomic.StoreInt32(&p.latestIndex, index)
-		atomic.StoreInt32(&p.totalQueries[p.latestIndex], 0)
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if p.seconds[index] != second {
+		p.seconds[index] = second
+		p.totalQueries[index] = 0
 	}
 
-	atomic.AddInt32(&p.totalQueries[index], 1)
+	p.totalQueries[index]++
 }
 
+// QPS returns the average queries per second of the window, not counting
+// the current second.
 func (p *QPSMonitor) QPS() int32 {
+	history := p.History()
+
 	var totalCount int32 = 0
-	for i, queryCount := range p.totalQueries {
-		if int32(i) != p.latestIndex {
-			totalCount += queryCount
-		}
+	for _, queryCount := range history[:len(history)-1] {
+		totalCount += queryCount
 	}
 	return totalCount / (p.delaySecond - 1)
 }
 
+// History returns the queries of each second of the window, oldest first.
+// The last one is the current second.
+func (p *QPSMonitor) History() []int32 {
+	second := p.clock.Now().Unix()
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	history := make([]int32, p.delaySecond)
+	for i := range history {
+		s := second - int64(p.delaySecond) + 1 + int64(i)
+		if index := s % int64(p.delaySecond); p.seconds[index] == s {
+			history[i] = p.totalQueries[index]
+		}
+	}
+	return history
+}
+
 func NewQPSMonitor(delaySecond int32) *QPSMonitor {
 	if delaySecond < 5 {
 		delaySecond = 5
@@ -38,6 +64,8 @@ func NewQPSMonitor(delaySecond int32) *QPSMonitor {
 	monitor := QPSMonitor{
 		delaySecond:  delaySecond,
 		totalQueries: make([]int32, delaySecond),
+		seconds:      make([]int64, delaySecond),
+		clock:        SystemClock,
 	}
 	return &monitor
 }
@@ -1,15 +1,20 @@
 package ali_mns
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/gogap/errors"
 )
 
 var (
-	DefaultNumOfMessages int32 = 16
-	DefaultQPSLimit      int32 = 2000
+	DefaultNumOfMessages  int32 = 16
+	DefaultMaxMessageSize int32 = 65536
+	DefaultQPSLimit       int32 = 2000
 )
 
 const (
@@ -31,47 +36,174 @@ type AliMNSQueue interface {
 	Stop()
 }
 
+// ContextReceiver is implemented by queues whose receive loops can be ended
+// by a context, without stopping the other loops of the queue. Consumers
+// use it to stop only their own loop.
+type ContextReceiver interface {
+	ReceiveMessageContext(ctx context.Context, respChan chan MessageReceiveResponse, errChan chan error, waitseconds ...int64)
+	BatchReceiveMessageContext(ctx context.Context, respChan chan BatchMessageReceiveResponse, errChan chan error, numOfMessages int32, waitseconds ...int64)
+}
+
+// ContextMessageSender is implemented by queues whose sends carry the
+// context of the caller through the client and its middlewares, so e.g.
+// trace spans of the request continue the trace of the caller.
+type ContextMessageSender interface {
+	SendMessageContext(ctx context.Context, message MessageSendRequest) (resp MessageSendResponse, err error)
+}
+
+// MNSQueue is safe for concurrent use: any number of sends, receive loops
+// and Stop may run at the same time. Its settings are fixed once it is
+// created, and the proxy of MNS_PROXY_<QUEUE> only applies to its own
+// requests.
 type MNSQueue struct {
-	name       string
-	client     MNSClient
-	stopChan   chan bool
-	qpsLimit   int32
-	qpsMonitor *QPSMonitor
-	decoder    MNSDecoder
+	name           string
+	client         MNSClient
+	qpsLimit       int32
+	qpsBurst       int
+	qpsLimiter     Limiter
+	qpsAdaptive    *adaptiveRate
+	stats          *queueStats
+	logger         Logger
+	clock          Clock
+	decoder        MNSDecoder
+	bodyCodec      BodyCodec
+	maxMessageSize int32
+
+	compressor           Compressor
+	compressMinSize      int
+	keyProvider          KeyProvider
+	verifyMD5            bool
+	batchEntryRetry      *ExponentialBackoff
+	batchSendConcurrency int
+	retryPolicy          RetryPolicy
+	proxyURL             string
+	messageHooks         []MessageHook
+
+	emptyReceiveMinBackoff time.Duration
+	emptyReceiveMaxBackoff time.Duration
+	receiveErrorBackoff    *ExponentialBackoff
+
+	stopCtx    context.Context
+	stopCancel context.CancelFunc
+	stopLocker sync.Mutex
+}
+
+type QueueOption func(*MNSQueue)
+
+func WithQPSLimit(qps int32) QueueOption {
+	return func(p *MNSQueue) {
+		if qps > 0 {
+			p.qpsLimit = qps
+		}
+	}
+}
+
+// WithQPSBurst lets up to burst requests above the QPS limit through at
+// once, e.g. for batch flushes, while the average stays under the limit.
+func WithQPSBurst(burst int) QueueOption {
+	return func(p *MNSQueue) {
+		if burst > 0 {
+			p.qpsBurst = burst
+		}
+	}
+}
+
+// WithQueueRetryPolicy overrides the retry policy of the client for calls
+// made by this queue. Use NoRetry to disable retries.
+func WithQueueRetryPolicy(policy RetryPolicy) QueueOption {
+	return func(p *MNSQueue) {
+		p.retryPolicy = policy
+	}
+}
+
+// WithDecoder sets the decoder of responses, e.g.
+// NewAliMNSDecoder(WithStrictDecoding()).
+func WithDecoder(decoder MNSDecoder) QueueOption {
+	return func(p *MNSQueue) {
+		p.decoder = decoder
+	}
 }
 
 func NewMNSQueue(name string, client MNSClient, qps ...int32) AliMNSQueue {
-	if name == "" {
-		panic("ali_mns: queue name could not be empty")
+	var opts []QueueOption
+	if qps != nil && len(qps) == 1 && qps[0] > 0 {
+		opts = append(opts, WithQPSLimit(qps[0]))
+	}
+
+	queue, err := NewMNSQueueWithOptions(name, client, opts...)
+	if err != nil {
+		panic(err)
+	}
+
+	return queue
+}
+
+// NewMNSQueueWithOptions fails if name is invalid, the queue cannot be read
+// or opts do not go together, e.g. WithCompression and the RawBodyCodec. It
+// also fails if MNS_PROXY_<QUEUE> is set for a client built WithHTTPClient
+// or WithTransport, which would not send requests through the proxy.
+func NewMNSQueueWithOptions(name string, client MNSClient, opts ...QueueOption) (AliMNSQueue, error) {
+	if err := checkQueueName(name); err != nil {
+		return nil, err
 	}
 
 	queue := new(MNSQueue)
 	queue.client = client
 	queue.name = name
-	queue.stopChan = make(chan bool, 1)
 	queue.qpsLimit = DefaultQPSLimit
+	queue.qpsBurst = 1
 	queue.decoder = NewAliMNSDecoder()
-
-	var attr QueueAttribute
-	if _, err := send(client, queue.decoder, GET, nil, nil, "queues/"+name, &attr); err != nil {
-		panic(err)
+	queue.logger = loggerOf(client)
+	queue.clock = clockOf(client)
+	queue.bodyCodec = Base64BodyCodec
+	queue.batchSendConcurrency = 1
+	queue.retryPolicy = clientRetryPolicy(client)
+	queue.emptyReceiveMinBackoff = DefaultEmptyReceiveMinBackoff
+	queue.emptyReceiveMaxBackoff = DefaultEmptyReceiveMaxBackoff
+	queue.receiveErrorBackoff = NewExponentialBackoff(0, DefaultReceiveErrorMinBackoff, DefaultReceiveErrorMaxBackoff)
+
+	for _, opt := range opts {
+		opt(queue)
 	}
 
-	if qps != nil && len(qps) == 1 && qps[0] > 0 {
-		queue.qpsLimit = qps[0]
+	if err := queue.checkBodyCodec(); err != nil {
+		return nil, err
 	}
 
-	proxyURL := ""
+	queue.stats = newQueueStats(queue.clock)
+
+	// the proxy of a queue only applies to its own requests, other users of
+	// the client keep theirs; clients that cannot proxy single requests fall
+	// back to changing their proxy
 	queueProxyEnvKey := PROXY_PREFIX + strings.Replace(strings.ToUpper(name), "-", "_", -1)
 	if url := os.Getenv(queueProxyEnvKey); url != "" {
-		proxyURL = url
+		if aliMNSClient, ok := client.(*AliMNSClient); !ok {
+			client.SetProxy(url)
+		} else if !aliMNSClient.proxiesRequests() {
+			return nil, ERR_QUEUE_PROXY_IGNORED.New(errors.Params{"name": name, "env": queueProxyEnvKey})
+		} else {
+			queue.proxyURL = url
+		}
 	}
 
-	client.SetProxy(proxyURL)
+	var attr QueueAttribute
+	if _, err := queue.send(GET, nil, nil, "queues/"+name, &attr); err != nil {
+		return nil, err
+	}
 
-	queue.qpsMonitor = NewQPSMonitor(5)
+	queue.maxMessageSize = attr.MaxMessageSize
+	if queue.maxMessageSize <= 0 {
+		queue.maxMessageSize = DefaultMaxMessageSize
+	}
 
-	return queue
+	if queue.qpsLimiter == nil && queue.qpsLimit > 0 {
+		bucket := newTokenBucket(float64(queue.qpsLimit), queue.qpsBurst)
+		bucket.setClock(queue.clock)
+		queue.qpsLimiter = bucket
+		queue.qpsAdaptive = newAdaptiveRate(bucket, float64(queue.qpsLimit))
+	}
+
+	return queue, nil
 }
 
 func (p *MNSQueue) Name() string {
@@ -79,8 +211,31 @@ func (p *MNSQueue) Name() string {
 }
 
 func (p *MNSQueue) SendMessage(message MessageSendRequest) (resp MessageSendResponse, err error) {
-	p.checkQPS()
-	_, err = send(p.client, p.decoder, POST, nil, message, fmt.Sprintf("queues/%s/%s", p.name, "messages"), &resp)
+	return p.SendMessageContext(context.Background(), message)
+}
+
+// SendMessageContext is SendMessage passing ctx on to the client. A done ctx
+// gives up waiting for the QPS limit and aborts the request.
+func (p *MNSQueue) SendMessageContext(ctx context.Context, message MessageSendRequest) (resp MessageSendResponse, err error) {
+	defer func() {
+		if err != nil {
+			p.fireMessageEvent(MessageEvent{Type: MessageSendFailed, Err: err})
+			return
+		}
+		p.fireMessageEvent(MessageEvent{Type: MessageSent, MessageId: resp.MessageId})
+	}()
+
+	var wire wireMessageSendRequest
+	if wire, err = p.encodeMessage(message); err != nil {
+		return
+	}
+
+	p.checkQPS(ctx)
+	if _, err = p.sendContext(ctx, POST, nil, wire, fmt.Sprintf("queues/%s/%s", p.name, "messages"), &resp); err != nil {
+		return
+	}
+
+	err = p.checkMD5(resp.MessageId, wire.MessageBody, resp.MessageBodyMD5)
 	return
 }
 
@@ -89,50 +244,149 @@ func (p *MNSQueue) BatchSendMessage(messages ...MessageSendRequest) (resp BatchM
 		return
 	}
 
-	batchRequest := BatchMessageSendRequest{}
+	defer func() {
+		p.fireBatchSent(len(messages), resp, err)
+	}()
+
+	var wires []wireMessageSendRequest
 	for _, message := range messages {
-		batchRequest.Messages = append(batchRequest.Messages, message)
+		var wire wireMessageSendRequest
+		if wire, err = p.encodeMessage(message); err != nil {
+			return
+		}
+		wires = append(wires, wire)
+	}
+
+	return p.batchSendSplit(context.Background(), splitBatch(wires))
+}
+
+func (p *MNSQueue) batchSendChunk(ctx context.Context, batchRequest wireBatchMessageSendRequest) (resp BatchMessageSendResponse, err error) {
+	resp, err = p.batchSend(ctx, batchRequest)
+
+	if p.batchEntryRetry != nil && ERR_MNS_BATCH_SEND_PARTIAL_FAILURE.IsEqual(err) {
+		err = p.retryFailedEntries(ctx, batchRequest, &resp)
 	}
 
-	p.checkQPS()
-	_, err = send(p.client, p.decoder, POST, nil, batchRequest, fmt.Sprintf("queues/%s/%s", p.name, "messages"), &resp)
 	return
 }
 
+func (p *MNSQueue) batchSend(ctx context.Context, batchRequest wireBatchMessageSendRequest) (resp BatchMessageSendResponse, err error) {
+	p.checkQPS(ctx)
+	_, err = p.sendContext(ctx, POST, nil, batchRequest, fmt.Sprintf("queues/%s/%s", p.name, "messages"), &resp)
+	if err != nil && !ERR_MNS_BATCH_SEND_PARTIAL_FAILURE.IsEqual(err) {
+		return
+	}
+
+	for i, message := range resp.Messages {
+		if i < len(batchRequest.Messages) && message.Code == "" {
+			if e := p.checkMD5(message.MessageId, batchRequest.Messages[i].MessageBody, message.MessageBodyMD5); e != nil {
+				return resp, e
+			}
+		}
+	}
+	return
+}
+
+// Stop ends every receive and peek loop running on this queue and aborts
+// their in-flight requests. It never blocks and may be called any number of
+// times; loops started afterwards run until the next Stop.
 func (p *MNSQueue) Stop() {
-	p.stopChan <- true
+	p.stopLocker.Lock()
+	defer p.stopLocker.Unlock()
+
+	if p.stopCancel != nil {
+		p.stopCancel()
+		p.stopCtx, p.stopCancel = nil, nil
+		p.logger.Info("queue stopped", "queue", p.name)
+	}
+}
+
+func (p *MNSQueue) loopContext() context.Context {
+	p.stopLocker.Lock()
+	defer p.stopLocker.Unlock()
+
+	if p.stopCtx == nil {
+		p.stopCtx, p.stopCancel = context.WithCancel(context.Background())
+	}
+
+	return p.stopCtx
+}
+
+// receiveContext returns a context done when ctx is done or the queue is
+// stopped. cancel must be called once the loop ends.
+func (p *MNSQueue) receiveContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	stopCtx := p.loopContext()
+	ctx, cancel := context.WithCancel(ctx)
+
+	go func() {
+		select {
+		case <-stopCtx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
 }
 
 func (p *MNSQueue) ReceiveMessage(respChan chan MessageReceiveResponse, errChan chan error, waitseconds ...int64) {
+	p.ReceiveMessageContext(context.Background(), respChan, errChan, waitseconds...)
+}
+
+// ReceiveMessageContext is ReceiveMessage ending when ctx is done as well
+// as on Stop. A ctx done before the call returns at once.
+func (p *MNSQueue) ReceiveMessageContext(ctx context.Context, respChan chan MessageReceiveResponse, errChan chan error, waitseconds ...int64) {
 	resource := fmt.Sprintf("queues/%s/%s", p.name, "messages")
 	if waitseconds != nil && len(waitseconds) == 1 && waitseconds[0] >= 0 {
 		resource = fmt.Sprintf("queues/%s/%s?waitseconds=%d", p.name, "messages", waitseconds[0])
 	}
 
-	for {
-		resp := MessageReceiveResponse{}
-		_, err := send(p.client, p.decoder, GET, nil, nil, resource, &resp)
-		if err != nil {
-			errChan <- err
-		} else {
-			respChan <- resp
+	ctx, cancel := p.receiveContext(ctx)
+	defer cancel()
+
+	backoff := p.newEmptyReceiveBackoff()
+
+	for ctx.Err() == nil {
+		wire := wireMessageReceiveResponse{}
+		start := p.clock.Now()
+		_, err := p.sendContext(ctx, GET, nil, nil, resource, &wire)
+		if ctx.Err() != nil {
+			return
 		}
 
-		p.checkQPS()
+		var resp MessageReceiveResponse
+		if err == nil {
+			if resp, err = p.decodeMessage(wire); err == nil {
+				p.received(resp)
+			}
+		}
 
-		select {
-		case _ = <-p.stopChan:
-			{
+		if err != nil {
+			select {
+			case errChan <- err:
+			case <-ctx.Done():
+				return
+			}
+		} else {
+			select {
+			case respChan <- resp:
+			case <-ctx.Done():
 				return
 			}
-		default:
 		}
-	}
 
-	return
+		p.checkQPS(ctx)
+		backoff.wait(ctx, err, p.clock.Now().Sub(start))
+	}
 }
 
 func (p *MNSQueue) BatchReceiveMessage(respChan chan BatchMessageReceiveResponse, errChan chan error, numOfMessages int32, waitseconds ...int64) {
+	p.BatchReceiveMessageContext(context.Background(), respChan, errChan, numOfMessages, waitseconds...)
+}
+
+// BatchReceiveMessageContext is BatchReceiveMessage ending when ctx is done
+// as well as on Stop.
+func (p *MNSQueue) BatchReceiveMessageContext(ctx context.Context, respChan chan BatchMessageReceiveResponse, errChan chan error, numOfMessages int32, waitseconds ...int64) {
 	if numOfMessages <= 0 {
 		numOfMessages = DefaultNumOfMessages
 	}
@@ -142,27 +396,45 @@ func (p *MNSQueue) BatchReceiveMessage(respChan chan BatchMessageReceiveResponse
 		resource = fmt.Sprintf("queues/%s/%s?numOfMessages=%d&waitseconds=%d", p.name, "messages", numOfMessages, waitseconds[0])
 	}
 
-	for {
-		resp := BatchMessageReceiveResponse{}
-		_, err := send(p.client, p.decoder, GET, nil, nil, resource, &resp)
-		if err != nil {
-			errChan <- err
-		} else {
-			respChan <- resp
+	ctx, cancel := p.receiveContext(ctx)
+	defer cancel()
+
+	backoff := p.newEmptyReceiveBackoff()
+
+	for ctx.Err() == nil {
+		wire := wireBatchMessageReceiveResponse{}
+		start := p.clock.Now()
+		_, err := p.sendContext(ctx, GET, nil, nil, resource, &wire)
+		if ctx.Err() != nil {
+			return
 		}
 
-		p.checkQPS()
+		var resp BatchMessageReceiveResponse
+		if err == nil {
+			if resp, err = p.decodeBatchMessage(wire); err == nil {
+				for _, message := range resp.Messages {
+					p.received(message)
+				}
+			}
+		}
 
-		select {
-		case _ = <-p.stopChan:
-			{
+		if err != nil {
+			select {
+			case errChan <- err:
+			case <-ctx.Done():
+				return
+			}
+		} else {
+			select {
+			case respChan <- resp:
+			case <-ctx.Done():
 				return
 			}
-		default:
 		}
-	}
 
-	return
+		p.checkQPS(ctx)
+		backoff.wait(ctx, err, p.clock.Now().Sub(start))
+	}
 }
 
 func (p *MNSQueue) PeekMessage(respChan chan MessageReceiveResponse, errChan chan error, interval ...time.Duration) {
@@ -173,28 +445,39 @@ func (p *MNSQueue) PeekMessage(respChan chan MessageReceiveResponse, errChan cha
 		itv = interval[0]
 	}
 
-	for {
-		resp := MessageReceiveResponse{}
-		_, err := send(p.client, p.decoder, GET, nil, nil, resource, &resp)
-		if err != nil {
-			errChan <- err
-		} else {
-			respChan <- resp
+	ctx := p.loopContext()
+	backoff := p.newEmptyReceiveBackoff()
+
+	for ctx.Err() == nil {
+		wire := wireMessageReceiveResponse{}
+		start := p.clock.Now()
+		_, err := p.sendContext(ctx, GET, nil, nil, resource, &wire)
+		if ctx.Err() != nil {
+			return
 		}
 
-		if itv > 0 {
-			time.Sleep(itv)
+		var resp MessageReceiveResponse
+		if err == nil {
+			resp, err = p.decodeMessage(wire)
 		}
 
-		select {
-		case _ = <-p.stopChan:
-			{
+		if err != nil {
+			select {
+			case errChan <- err:
+			case <-ctx.Done():
+				return
+			}
+		} else {
+			select {
+			case respChan <- resp:
+			case <-ctx.Done():
 				return
 			}
-		default:
 		}
+
+		sleepContext(ctx, p.clock, itv)
+		backoff.wait(ctx, err, p.clock.Now().Sub(start))
 	}
-	return
 }
 
 func (p *MNSQueue) BatchPeekMessage(respChan chan BatchMessageReceiveResponse, errChan chan error, numOfMessages int32, interval ...time.Duration) {
@@ -202,38 +485,55 @@ func (p *MNSQueue) BatchPeekMessage(respChan chan BatchMessageReceiveResponse, e
 		numOfMessages = DefaultNumOfMessages
 	}
 
+	resource := fmt.Sprintf("queues/%s/%s?numOfMessages=%d&peekonly=true", p.name, "messages", numOfMessages)
+
 	itv := time.Duration(0)
 	if len(interval) == 1 {
 		itv = interval[0]
 	}
 
-	for {
-		resp := BatchMessageReceiveResponse{}
-		_, err := send(p.client, p.decoder, GET, nil, nil, fmt.Sprintf("queues/%s/%s?numOfMessages=%d&peekonly=true", p.name, "messages", numOfMessages), &resp)
-		if err != nil {
-			errChan <- err
-		} else {
-			respChan <- resp
+	ctx := p.loopContext()
+	backoff := p.newEmptyReceiveBackoff()
+
+	for ctx.Err() == nil {
+		wire := wireBatchMessageReceiveResponse{}
+		start := p.clock.Now()
+		_, err := p.sendContext(ctx, GET, nil, nil, resource, &wire)
+		if ctx.Err() != nil {
+			return
 		}
 
-		if itv > 0 {
-			time.Sleep(itv)
+		var resp BatchMessageReceiveResponse
+		if err == nil {
+			resp, err = p.decodeBatchMessage(wire)
 		}
 
-		select {
-		case _ = <-p.stopChan:
-			{
+		if err != nil {
+			select {
+			case errChan <- err:
+			case <-ctx.Done():
+				return
+			}
+		} else {
+			select {
+			case respChan <- resp:
+			case <-ctx.Done():
 				return
 			}
-		default:
 		}
+
+		sleepContext(ctx, p.clock, itv)
+		backoff.wait(ctx, err, p.clock.Now().Sub(start))
 	}
-	return
 }
 
 func (p *MNSQueue) DeleteMessage(receiptHandle string) (err error) {
-	p.checkQPS()
-	_, err = send(p.client, p.decoder, DELETE, nil, nil, fmt.Sprintf("queues/%s/%s?ReceiptHandle=%s", p.name, "messages", receiptHandle), nil)
+	p.checkQPS(context.Background())
+	if _, err = p.send(DELETE, nil, nil, fmt.Sprintf("queues/%s/%s?ReceiptHandle=%s", p.name, "messages", receiptHandle), nil); err != nil {
+		return
+	}
+
+	p.fireMessageEvent(MessageEvent{Type: MessageDeleted, ReceiptHandle: receiptHandle})
 	return
 }
 
@@ -248,23 +548,73 @@ func (p *MNSQueue) BatchDeleteMessage(receiptHandles ...string) (err error) {
 		handlers.ReceiptHandles = append(handlers.ReceiptHandles, handler)
 	}
 
-	p.checkQPS()
-	_, err = send(p.client, p.decoder, DELETE, nil, handlers, fmt.Sprintf("queues/%s/%s", p.name, "messages"), nil)
+	p.checkQPS(context.Background())
+	if _, err = p.send(DELETE, nil, handlers, fmt.Sprintf("queues/%s/%s", p.name, "messages"), nil); err != nil {
+		return
+	}
+
+	for _, handle := range receiptHandles {
+		p.fireMessageEvent(MessageEvent{Type: MessageDeleted, ReceiptHandle: handle})
+	}
 	return
 }
 
 func (p *MNSQueue) ChangeMessageVisibility(receiptHandle string, visibilityTimeout int64) (resp MessageVisibilityChangeResponse, err error) {
-	p.checkQPS()
-	_, err = send(p.client, p.decoder, PUT, nil, nil, fmt.Sprintf("queues/%s/%s?ReceiptHandle=%s&VisibilityTimeout=%d", p.name, "messages", receiptHandle, visibilityTimeout), &resp)
+	p.checkQPS(context.Background())
+	if _, err = p.send(PUT, nil, nil, fmt.Sprintf("queues/%s/%s?ReceiptHandle=%s&VisibilityTimeout=%d", p.name, "messages", receiptHandle, visibilityTimeout), &resp); err != nil {
+		return
+	}
+
+	p.fireMessageEvent(MessageEvent{Type: MessageVisibilityChanged, ReceiptHandle: receiptHandle})
+	return
+}
+
+func (p *MNSQueue) send(method Method, headers map[string]string, message interface{}, resource string, v interface{}) (statusCode int, err error) {
+	return p.sendContext(context.Background(), method, headers, message, resource, v)
+}
+
+func (p *MNSQueue) sendContext(ctx context.Context, method Method, headers map[string]string, message interface{}, resource string, v interface{}) (statusCode int, err error) {
+	statusCode, err = sendWithRetry(p.requestContext(ctx), p.client, p.decoder, p.retryPolicy, method, headers, message, resource, v)
+	p.stats.record(OperationName(method, message, resource), err)
+	p.adaptQPS(err)
 	return
 }
 
-func (p *MNSQueue) checkQPS() {
-	p.qpsMonitor.Pulse()
-	if p.qpsLimit > 0 {
-		for p.qpsMonitor.QPS() > p.qpsLimit {
-			p.qpsMonitor.Pulse()
-			time.Sleep(time.Millisecond * 10)
+func (p *MNSQueue) requestContext(ctx context.Context) context.Context {
+	if p.proxyURL == "" {
+		return ctx
+	}
+	return withRequestProxy(ctx, p.proxyURL)
+}
+
+// adaptQPS slows the queue down while MNS answers with QpsLimitExceeded and
+// holds it back for as long as a Retry-After header asks.
+func (p *MNSQueue) adaptQPS(err error) {
+	if p.qpsAdaptive == nil {
+		return
+	}
+
+	if err == nil {
+		p.qpsAdaptive.succeeded()
+		return
+	}
+
+	if ERR_MNS_QPS_LIMIT_EXCEEDED.IsEqual(err) {
+		if rate := p.qpsAdaptive.throttled(); rate > 0 {
+			p.logger.Warn("qps limit exceeded, lowering request rate", "queue", p.name, "qps", rate)
 		}
 	}
+
+	if hint := RetryAfter(err); hint > 0 {
+		p.logger.Debug("holding requests as asked by the server", "queue", p.name, "retry_after", hint)
+		p.qpsAdaptive.bucket.hold(hint)
+	}
+}
+
+// checkQPS waits for the QPS limit, or until ctx is done so a stopped loop
+// is not held up by the limiter.
+func (p *MNSQueue) checkQPS(ctx context.Context) {
+	if p.qpsLimiter != nil {
+		p.qpsLimiter.Wait(ctx)
+	}
 }
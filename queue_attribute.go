@@ -0,0 +1,38 @@
+package ali_mns
+
+import (
+	"time"
+)
+
+func (p QueueAttribute) Delay() time.Duration {
+	return time.Duration(p.DelaySeconds) * time.Second
+}
+
+func (p QueueAttribute) Retention() time.Duration {
+	return time.Duration(p.MessageRetentionPeriod) * time.Second
+}
+
+func (p QueueAttribute) Visibility() time.Duration {
+	return time.Duration(p.VisibilityTimeout) * time.Second
+}
+
+func (p QueueAttribute) PollingWait() time.Duration {
+	return time.Duration(p.PollingWaitSeconds) * time.Second
+}
+
+// Created returns CreateTime, the zero time if it is unset.
+func (p QueueAttribute) Created() time.Time {
+	return unixTime(p.CreateTime)
+}
+
+// LastModified returns LastModifyTime, the zero time if it is unset.
+func (p QueueAttribute) LastModified() time.Time {
+	return unixTime(p.LastModifyTime)
+}
+
+func unixTime(seconds int64) time.Time {
+	if seconds <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
+}
@@ -0,0 +1,74 @@
+package ali_mns
+
+import (
+	"strings"
+	"sync"
+)
+
+type DeleteQueuesOptions struct {
+	// Concurrency bounds the queues deleted at the same time, 1 if not set.
+	Concurrency int
+
+	// DryRun only lists the queues that would be deleted.
+	DryRun bool
+}
+
+// DeleteQueuesByPrefix deletes every queue whose name starts with prefix and
+// returns the names of the deleted queues, or of the matching ones in a dry
+// run. It keeps going when a deletion fails and returns the first error.
+func (p *MNSQueueManager) DeleteQueuesByPrefix(endpoint string, prefix string, opts DeleteQueuesOptions) (names []string, err error) {
+	if strings.TrimSpace(prefix) == "" {
+		err = ERR_MNS_QUEUE_PREFIX_IS_EMPTY.New()
+		return
+	}
+
+	var queues []Queue
+	if queues, err = p.ListAllQueues(endpoint, prefix); err != nil {
+		return
+	}
+
+	if opts.DryRun {
+		for _, queue := range queues {
+			names = append(names, queue.Name())
+		}
+		return
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	slots := make(chan struct{}, concurrency)
+	locker := sync.Mutex{}
+	wg := sync.WaitGroup{}
+
+	for _, queue := range queues {
+		slots <- struct{}{}
+		wg.Add(1)
+
+		go func(name string) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+
+			e := p.DeleteQueue(endpoint, name)
+
+			locker.Lock()
+			defer locker.Unlock()
+
+			if e != nil {
+				if err == nil {
+					err = e
+				}
+				return
+			}
+			names = append(names, name)
+		}(queue.Name())
+	}
+
+	wg.Wait()
+
+	return
+}
@@ -0,0 +1,88 @@
+package ali_mns
+
+import (
+	"path"
+)
+
+const (
+	DefaultListQueuePageSize int32 = 1000
+)
+
+// Name returns the queue name, the last element of QueueURL.
+func (p Queue) Name() string {
+	return path.Base(p.QueueURL)
+}
+
+// QueueIterator walks the queues of an endpoint page by page:
+//
+//	iter := NewQueueIterator(manager, endpoint, prefix)
+//	for iter.Next() {
+//		queue := iter.Queue()
+//	}
+//	if err := iter.Err(); err != nil {
+//	}
+type QueueIterator struct {
+	manager  AliQueueManager
+	endpoint string
+	prefix   string
+	pageSize int32
+
+	page    []Queue
+	current Queue
+	marker  string
+	last    bool
+	err     error
+}
+
+func NewQueueIterator(manager AliQueueManager, endpoint string, prefix string, pageSize ...int32) *QueueIterator {
+	size := DefaultListQueuePageSize
+	if len(pageSize) == 1 && pageSize[0] > 0 {
+		size = pageSize[0]
+	}
+
+	return &QueueIterator{
+		manager:  manager,
+		endpoint: endpoint,
+		prefix:   prefix,
+		pageSize: size,
+	}
+}
+
+// Next advances to the next queue, fetching the next page when needed. It
+// returns false when all queues were visited or a request failed.
+func (p *QueueIterator) Next() bool {
+	for len(p.page) == 0 {
+		if p.last || p.err != nil {
+			return false
+		}
+
+		var queues Queues
+		if queues, p.err = p.manager.ListQueue(p.endpoint, p.marker, p.pageSize, p.prefix); p.err != nil {
+			return false
+		}
+
+		p.page = queues.Queues
+		p.marker = queues.NextMarker
+		p.last = queues.NextMarker == ""
+	}
+
+	p.current, p.page = p.page[0], p.page[1:]
+	return true
+}
+
+func (p *QueueIterator) Queue() Queue {
+	return p.current
+}
+
+func (p *QueueIterator) Err() error {
+	return p.err
+}
+
+func (p *MNSQueueManager) ListAllQueues(endpoint string, prefix string) (queues []Queue, err error) {
+	iter := NewQueueIterator(p, endpoint, prefix)
+	for iter.Next() {
+		queues = append(queues, iter.Queue())
+	}
+
+	return queues, iter.Err()
+}
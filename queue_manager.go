@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/gogap/errors"
 )
@@ -17,19 +18,103 @@ type AliQueueManager interface {
 	ListQueue(endpoint string, nextMarker string, retNumber int32, prefix string) (queues Queues, err error)
 }
 
+// QueueAttributes are the settable attributes of a queue. Zero values are
+// left out of the request, so the server default or current value applies.
+type QueueAttributes struct {
+	DelaySeconds           int32
+	MaxMessageSize         int32
+	MessageRetentionPeriod int32
+	VisibilityTimeout      int32
+	PollingWaitSeconds     int32
+
+	// LoggingEnabled turns delivery of the queue logs to OSS on or off,
+	// nil keeps the current setting.
+	LoggingEnabled *bool
+}
+
+func (p QueueAttributes) check() (err error) {
+	if p.DelaySeconds != 0 {
+		if err = checkDelaySeconds(p.DelaySeconds); err != nil {
+			return
+		}
+	}
+	if p.MaxMessageSize != 0 {
+		if err = checkMaxMessageSize(p.MaxMessageSize); err != nil {
+			return
+		}
+	}
+	if p.MessageRetentionPeriod != 0 {
+		if err = checkMessageRetentionPeriod(p.MessageRetentionPeriod); err != nil {
+			return
+		}
+	}
+	if p.VisibilityTimeout != 0 {
+		if err = checkVisibilityTimeout(p.VisibilityTimeout); err != nil {
+			return
+		}
+	}
+	if p.PollingWaitSeconds != 0 {
+		if err = checkPollingWaitSeconds(p.PollingWaitSeconds); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (p QueueAttributes) request() CreateQueueRequest {
+	return CreateQueueRequest{
+		DelaySeconds:           p.DelaySeconds,
+		MaxMessageSize:         p.MaxMessageSize,
+		MessageRetentionPeriod: p.MessageRetentionPeriod,
+		VisibilityTimeout:      p.VisibilityTimeout,
+		PollingWaitSeconds:     p.PollingWaitSeconds,
+		LoggingEnabled:         p.LoggingEnabled,
+	}
+}
+
+// MNSQueueManager implements AliQueueManager. Its other methods, e.g.
+// CreateQueueWithAttributes, are called on the *MNSQueueManager returned by
+// NewMNSQueueManagerWithClient, or on the result of NewMNSQueueManager
+// asserted to *MNSQueueManager.
 type MNSQueueManager struct {
 	credential      Credential
 	accessKeyId     string
 	accessKeySecret string
 
 	decoder MNSDecoder
+	client  MNSClient
+
+	clients       map[string]MNSClient
+	clientsLocker sync.Mutex
 }
 
+const (
+	MaxQueueNameLength = 255
+)
+
 func checkQueueName(queueName string) (err error) {
-	if len(queueName) > 256 {
+	if queueName == "" {
+		err = ERR_MNS_QUEUE_NAME_IS_EMPTY.New()
+		return
+	}
+
+	if len(queueName) > MaxQueueNameLength {
 		err = ERR_MNS_QUEUE_NAME_IS_TOO_LONG.New()
 		return
 	}
+
+	if queueName[0] == '-' {
+		err = ERR_MNS_QUEUE_NAME_STARTS_WITH_HYPHEN.New(errors.Params{"name": queueName})
+		return
+	}
+
+	for _, c := range queueName {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+			err = ERR_MNS_QUEUE_NAME_INVALID_CHARACTER.New(errors.Params{"name": queueName, "char": string(c)})
+			return
+		}
+	}
+
 	return
 }
 
@@ -81,6 +166,40 @@ func NewMNSQueueManager(accessKeyId, accessKeySecret string) AliQueueManager {
 	}
 }
 
+// NewMNSQueueManagerWithClient returns a manager bound to the endpoint of
+// client, which it uses for every call with its proxy, credential and
+// transport settings. The endpoint arguments of its methods are ignored.
+func NewMNSQueueManagerWithClient(client MNSClient) *MNSQueueManager {
+	return &MNSQueueManager{
+		decoder: new(AliMNSDecoder),
+		client:  client,
+	}
+}
+
+// clientFor returns the bound client, or the client cached for endpoint so
+// calls reuse its connections.
+func (p *MNSQueueManager) clientFor(endpoint string) MNSClient {
+	if p.client != nil {
+		return p.client
+	}
+
+	p.clientsLocker.Lock()
+	defer p.clientsLocker.Unlock()
+
+	if client, exist := p.clients[endpoint]; exist {
+		return client
+	}
+
+	if p.clients == nil {
+		p.clients = make(map[string]MNSClient)
+	}
+
+	client := NewAliMNSClient(endpoint, p.accessKeyId, p.accessKeySecret)
+	p.clients[endpoint] = client
+
+	return client
+}
+
 func checkAttributes(delaySeconds int32, maxMessageSize int32, messageRetentionPeriod int32, visibilityTimeout int32, pollingWaitSeconds int32) (err error) {
 	if err = checkDelaySeconds(delaySeconds); err != nil {
 		return
@@ -101,12 +220,6 @@ func checkAttributes(delaySeconds int32, maxMessageSize int32, messageRetentionP
 }
 
 func (p *MNSQueueManager) CreateQueue(endpoint string, queueName string, delaySeconds int32, maxMessageSize int32, messageRetentionPeriod int32, visibilityTimeout int32, pollingWaitSeconds int32) (err error) {
-	queueName = strings.TrimSpace(queueName)
-
-	if err = checkQueueName(queueName); err != nil {
-		return
-	}
-
 	if err = checkAttributes(delaySeconds,
 		maxMessageSize,
 		messageRetentionPeriod,
@@ -115,15 +228,29 @@ func (p *MNSQueueManager) CreateQueue(endpoint string, queueName string, delaySe
 		return
 	}
 
-	message := CreateQueueRequest{
+	return p.CreateQueueWithAttributes(endpoint, queueName, QueueAttributes{
 		DelaySeconds:           delaySeconds,
 		MaxMessageSize:         maxMessageSize,
 		MessageRetentionPeriod: messageRetentionPeriod,
 		VisibilityTimeout:      visibilityTimeout,
 		PollingWaitSeconds:     pollingWaitSeconds,
+	})
+}
+
+func (p *MNSQueueManager) CreateQueueWithAttributes(endpoint string, queueName string, attrs QueueAttributes) (err error) {
+	queueName = strings.TrimSpace(queueName)
+
+	if err = checkQueueName(queueName); err != nil {
+		return
 	}
 
-	cli := NewAliMNSClient(endpoint, p.accessKeyId, p.accessKeySecret)
+	if err = attrs.check(); err != nil {
+		return
+	}
+
+	message := attrs.request()
+
+	cli := p.clientFor(endpoint)
 
 	var code int
 	if code, err = send(cli, p.decoder, PUT, nil, &message, "queues/"+queueName, nil); err != nil {
@@ -149,12 +276,6 @@ func (p *MNSQueueManager) CreateQueue(endpoint string, queueName string, delaySe
 }
 
 func (p *MNSQueueManager) SetQueueAttributes(endpoint string, queueName string, delaySeconds int32, maxMessageSize int32, messageRetentionPeriod int32, visibilityTimeout int32, pollingWaitSeconds int32) (err error) {
-	queueName = strings.TrimSpace(queueName)
-
-	if err = checkQueueName(queueName); err != nil {
-		return
-	}
-
 	if err = checkAttributes(delaySeconds,
 		maxMessageSize,
 		messageRetentionPeriod,
@@ -163,20 +284,51 @@ func (p *MNSQueueManager) SetQueueAttributes(endpoint string, queueName string,
 		return
 	}
 
-	message := CreateQueueRequest{
+	return p.UpdateQueueAttributes(endpoint, queueName, QueueAttributes{
 		DelaySeconds:           delaySeconds,
 		MaxMessageSize:         maxMessageSize,
 		MessageRetentionPeriod: messageRetentionPeriod,
 		VisibilityTimeout:      visibilityTimeout,
 		PollingWaitSeconds:     pollingWaitSeconds,
+	})
+}
+
+// UpdateQueueAttributes changes the non-zero attributes of attrs and keeps
+// the others.
+func (p *MNSQueueManager) UpdateQueueAttributes(endpoint string, queueName string, attrs QueueAttributes) (err error) {
+	queueName = strings.TrimSpace(queueName)
+
+	if err = checkQueueName(queueName); err != nil {
+		return
+	}
+
+	if err = attrs.check(); err != nil {
+		return
 	}
 
-	cli := NewAliMNSClient(endpoint, p.accessKeyId, p.accessKeySecret)
+	message := attrs.request()
+
+	cli := p.clientFor(endpoint)
 
 	_, err = send(cli, p.decoder, PUT, nil, &message, fmt.Sprintf("queues/%s?metaoverride=true", queueName), nil)
 	return
 }
 
+// EnsureQueue creates the queue, or updates its attributes if it exists with
+// different ones. A queue that already exists as requested is no error.
+func (p *MNSQueueManager) EnsureQueue(endpoint string, queueName string, attrs QueueAttributes) (err error) {
+	err = p.CreateQueueWithAttributes(endpoint, queueName, attrs)
+
+	switch {
+	case ERR_MNS_QUEUE_ALREADY_EXIST_AND_HAVE_SAME_ATTR.IsEqual(err):
+		return nil
+	case ERR_MNS_QUEUE_ALREADY_EXIST.IsEqual(err):
+		return p.UpdateQueueAttributes(endpoint, queueName, attrs)
+	}
+
+	return
+}
+
 func (p *MNSQueueManager) GetQueueAttributes(endpoint string, queueName string) (attr QueueAttribute, err error) {
 	queueName = strings.TrimSpace(queueName)
 
@@ -184,7 +336,7 @@ func (p *MNSQueueManager) GetQueueAttributes(endpoint string, queueName string)
 		return
 	}
 
-	cli := NewAliMNSClient(endpoint, p.accessKeyId, p.accessKeySecret)
+	cli := p.clientFor(endpoint)
 
 	_, err = send(cli, p.decoder, GET, nil, nil, "queues/"+queueName, &attr)
 
@@ -198,7 +350,7 @@ func (p *MNSQueueManager) DeleteQueue(endpoint string, queueName string) (err er
 		return
 	}
 
-	cli := NewAliMNSClient(endpoint, p.accessKeyId, p.accessKeySecret)
+	cli := p.clientFor(endpoint)
 
 	_, err = send(cli, p.decoder, DELETE, nil, nil, "queues/"+queueName, nil)
 
@@ -207,9 +359,52 @@ func (p *MNSQueueManager) DeleteQueue(endpoint string, queueName string) (err er
 
 func (p *MNSQueueManager) ListQueue(endpoint string, nextMarker string, retNumber int32, prefix string) (queues Queues, err error) {
 
-	cli := NewAliMNSClient(endpoint, p.accessKeyId, p.accessKeySecret)
+	cli := p.clientFor(endpoint)
 
-	header := map[string]string{}
+	var header map[string]string
+	if header, err = listQueueHeader(nextMarker, retNumber, prefix); err != nil {
+		return
+	}
+
+	_, err = send(cli, p.decoder, GET, header, nil, "queues", &queues)
+
+	return
+}
+
+func (p *MNSQueueManager) GetAccountAttributes(endpoint string) (attr AccountAttribute, err error) {
+	cli := p.clientFor(endpoint)
+
+	_, err = send(cli, p.decoder, GET, nil, nil, "?accountmeta=true", &attr)
+
+	return
+}
+
+func (p *MNSQueueManager) SetAccountAttributes(endpoint string, attr AccountAttribute) (err error) {
+	cli := p.clientFor(endpoint)
+
+	_, err = send(cli, p.decoder, PUT, nil, &attr, "?accountmeta=true", nil)
+
+	return
+}
+
+// ListQueueWithMeta is ListQueue returning the attributes of every queue, so
+// they need not be fetched one by one.
+func (p *MNSQueueManager) ListQueueWithMeta(endpoint string, nextMarker string, retNumber int32, prefix string) (queues QueuesWithMeta, err error) {
+	cli := p.clientFor(endpoint)
+
+	var header map[string]string
+	if header, err = listQueueHeader(nextMarker, retNumber, prefix); err != nil {
+		return
+	}
+	header["x-mns-with-meta"] = "true"
+
+	_, err = send(cli, p.decoder, GET, header, nil, "queues", &queues)
+
+	return
+}
+
+func listQueueHeader(nextMarker string, retNumber int32, prefix string) (header map[string]string, err error) {
+	header = map[string]string{}
 
 	marker := strings.TrimSpace(nextMarker)
 	if len(marker) > 0 {
@@ -232,7 +427,5 @@ func (p *MNSQueueManager) ListQueue(endpoint string, nextMarker string, retNumbe
 		header["x-mns-prefix"] = prefix
 	}
 
-	_, err = send(cli, p.decoder, GET, header, nil, "queues", &queues)
-
 	return
 }
@@ -0,0 +1,81 @@
+package ali_mns
+
+import (
+	"sync"
+)
+
+// QueueStats is a snapshot of the requests of a queue. History holds the
+// requests of each second of the monitoring window, oldest first and the
+// current second last. Operations and Errors count the calls and failed
+// calls by MNS API name, such as SendMessage, since the queue was created.
+// Lag describes the messages received by the receive calls of the queue.
+type QueueStats struct {
+	QPS        int32            `json:"qps"`
+	History    []int32          `json:"history"`
+	Operations map[string]int64 `json:"operations"`
+	Errors     map[string]int64 `json:"errors"`
+	Lag        LagStats         `json:"lag"`
+}
+
+// StatsReporter is implemented by queues counting their calls, like
+// MNSQueue and alimnstest.FakeQueue.
+type StatsReporter interface {
+	Stats() QueueStats
+}
+
+type queueStats struct {
+	monitor    *QPSMonitor
+	operations map[string]int64
+	errors     map[string]int64
+	lag        lagStats
+	locker     sync.Mutex
+}
+
+func newQueueStats(clock Clock) *queueStats {
+	monitor := NewQPSMonitor(5)
+	monitor.clock = clock
+
+	return &queueStats{
+		monitor:    monitor,
+		lag:        lagStats{clock: clock},
+		operations: make(map[string]int64),
+		errors:     make(map[string]int64),
+	}
+}
+
+func (p *queueStats) record(op string, err error) {
+	p.monitor.Pulse()
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.operations[op]++
+	if err != nil {
+		p.errors[op]++
+	}
+}
+
+func (p *queueStats) snapshot() (stats QueueStats) {
+	stats.QPS = p.monitor.QPS()
+	stats.History = p.monitor.History()
+	stats.Lag = p.lag.snapshot()
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	stats.Operations = make(map[string]int64, len(p.operations))
+	for op, count := range p.operations {
+		stats.Operations[op] = count
+	}
+
+	stats.Errors = make(map[string]int64, len(p.errors))
+	for op, count := range p.errors {
+		stats.Errors[op] = count
+	}
+
+	return
+}
+
+func (p *MNSQueue) Stats() QueueStats {
+	return p.stats.snapshot()
+}
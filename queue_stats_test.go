@@ -0,0 +1,38 @@
+package ali_mns_test
+
+import (
+	"testing"
+
+	"github.com/gogap/ali_mns"
+)
+
+func TestQueueStats(t *testing.T) {
+	_, queue := newTestQueue(t)
+
+	for i := 0; i < 2; i++ {
+		if _, err := queue.SendStringMessage("counted"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := queue.DeleteMessage("no-such-handle"); err == nil {
+		t.Fatal("deleting an unknown receipt handle succeeded")
+	}
+
+	var reporter ali_mns.StatsReporter = queue
+	stats := reporter.Stats()
+
+	for _, test := range []struct {
+		op         string
+		operations int64
+		errors     int64
+	}{
+		{"GetQueueAttributes", 1, 0},
+		{"SendMessage", 2, 0},
+		{"DeleteMessage", 1, 1},
+		{"ReceiveMessage", 0, 0},
+	} {
+		if stats.Operations[test.op] != test.operations || stats.Errors[test.op] != test.errors {
+			t.Errorf("%s: %d calls, %d failed, want %d, %d", test.op, stats.Operations[test.op], stats.Errors[test.op], test.operations, test.errors)
+		}
+	}
+}
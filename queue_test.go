@@ -0,0 +1,499 @@
+package ali_mns_test
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gogap/ali_mns"
+	"github.com/gogap/ali_mns/alimnstest"
+	"github.com/gogap/errors"
+)
+
+// newTestQueue returns a queue of a new Server, which is closed with the
+// test.
+func newTestQueue(t testing.TB, opts ...ali_mns.QueueOption) (server *alimnstest.Server, queue *ali_mns.MNSQueue) {
+	server = alimnstest.NewServer()
+	t.Cleanup(server.Close)
+
+	client := ali_mns.NewAliMNSClient(server.URL, "test-id", "test-secret")
+	if err := ali_mns.NewMNSQueueManagerWithClient(client).CreateQueue(server.URL, "test", 0, 65536, 345600, 30, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	aliQueue, err := ali_mns.NewMNSQueueWithOptions("test", client, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return server, aliQueue.(*ali_mns.MNSQueue)
+}
+
+// receiveLoop runs ReceiveMessage in the background, deleting what it
+// receives and reporting the message ids on received while it has room.
+// done is closed once the loop returned.
+func receiveLoop(queue ali_mns.AliMNSQueue, received chan<- string) (done chan bool) {
+	done = make(chan bool)
+
+	respChan := make(chan ali_mns.MessageReceiveResponse)
+	errChan := make(chan error)
+	loopDone := make(chan bool)
+
+	go func() {
+		defer close(loopDone)
+		queue.ReceiveMessage(respChan, errChan, 1)
+	}()
+
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case message := <-respChan:
+				queue.DeleteMessage(message.ReceiptHandle)
+				select {
+				case received <- message.MessageId:
+				default:
+				}
+			case <-errChan:
+			case <-loopDone:
+				return
+			}
+		}
+	}()
+
+	return
+}
+
+// receiveOne receives a single message, or the error of the receive, from
+// queue.
+func receiveOne(t *testing.T, queue ali_mns.AliMNSQueue) (resp ali_mns.MessageReceiveResponse, err error) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	respChan := make(chan ali_mns.MessageReceiveResponse)
+	errChan := make(chan error)
+	go queue.(ali_mns.ContextReceiver).ReceiveMessageContext(ctx, respChan, errChan, 1)
+
+	select {
+	case resp = <-respChan:
+	case err = <-errChan:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received within 5s")
+	}
+	return
+}
+
+func waitClosed(t *testing.T, done chan bool, timeout time.Duration, what string) {
+	t.Helper()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		t.Fatalf("%s did not return within %s", what, timeout)
+	}
+}
+
+func TestQueueConcurrentSendAndReceive(t *testing.T) {
+	_, queue := newTestQueue(t)
+
+	const senders, perSender, loops = 4, 25, 3
+
+	received := make(chan string, senders*perSender)
+	var loopsDone []chan bool
+	for i := 0; i < loops; i++ {
+		loopsDone = append(loopsDone, receiveLoop(queue, received))
+	}
+
+	sent := make(chan string, senders*perSender)
+	wg := sync.WaitGroup{}
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < perSender; j++ {
+				resp, err := queue.SendStringMessage(fmt.Sprintf("message %d-%d", i, j))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				sent <- resp.MessageId
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(sent)
+
+	want := make(map[string]bool)
+	for id := range sent {
+		want[id] = true
+	}
+
+	timeout := time.After(10 * time.Second)
+	for len(want) > 0 {
+		select {
+		case id := <-received:
+			delete(want, id)
+		case <-timeout:
+			t.Fatalf("%d messages were not received", len(want))
+		}
+	}
+
+	queue.Stop()
+	for _, done := range loopsDone {
+		waitClosed(t, done, 5*time.Second, "ReceiveMessage")
+	}
+}
+
+func TestQueueStopDuringSendAndReceive(t *testing.T) {
+	_, queue := newTestQueue(t, ali_mns.WithQPSLimit(200))
+
+	received := make(chan string, 1000)
+	stop := make(chan bool)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				if _, err := queue.SendStringMessage("message"); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+
+	// loops started and stopped over and over while sends go on. Stop only
+	// ends the loops already running, so they get a moment to start.
+	for round := 0; round < 20; round++ {
+		var loopsDone []chan bool
+		for i := 0; i < 3; i++ {
+			loopsDone = append(loopsDone, receiveLoop(queue, received))
+		}
+
+		time.Sleep(20 * time.Millisecond)
+
+		stopped := sync.WaitGroup{}
+		for i := 0; i < 3; i++ {
+			stopped.Add(1)
+			go func() {
+				defer stopped.Done()
+				queue.Stop()
+			}()
+		}
+		stopped.Wait()
+
+		for _, done := range loopsDone {
+			waitClosed(t, done, 5*time.Second, "ReceiveMessage")
+		}
+	}
+
+	close(stop)
+	wg.Wait()
+
+	if _, err := queue.SendStringMessage("after stop"); err != nil {
+		t.Fatalf("send after Stop failed: %s", err)
+	}
+}
+
+func TestQueueReceiveMessageContextCancelledBeforeStart(t *testing.T) {
+	_, queue := newTestQueue(t)
+
+	for i := 0; i < 50; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan bool)
+
+		go func() {
+			defer close(done)
+			queue.ReceiveMessageContext(ctx, make(chan ali_mns.MessageReceiveResponse), make(chan error), 1)
+		}()
+		cancel()
+
+		waitClosed(t, done, 5*time.Second, "ReceiveMessageContext")
+	}
+}
+
+func TestQueueReceiveMessageContextLeavesOtherLoopsRunning(t *testing.T) {
+	_, queue := newTestQueue(t)
+
+	received := make(chan string, 10)
+	done := receiveLoop(queue, received)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	contextDone := make(chan bool)
+	go func() {
+		defer close(contextDone)
+		queue.ReceiveMessageContext(ctx, make(chan ali_mns.MessageReceiveResponse), make(chan error), 1)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	waitClosed(t, contextDone, 5*time.Second, "ReceiveMessageContext")
+
+	resp, err := queue.SendStringMessage("still received")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case id := <-received:
+		if id != resp.MessageId {
+			t.Fatalf("received %s, want %s", id, resp.MessageId)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the other loop stopped receiving")
+	}
+
+	queue.Stop()
+	waitClosed(t, done, 5*time.Second, "ReceiveMessage")
+}
+
+// BenchmarkSendMessage measures a send round trip against a Server,
+// including signing, encoding, HTTP and decoding.
+func BenchmarkSendMessage(b *testing.B) {
+	_, queue := newTestQueue(b)
+
+	message := ali_mns.MessageSendRequest{MessageBody: benchmarkBody}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkBody)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := queue.SendMessage(message); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkReceiveMessage measures the receive loop against a Server, from
+// request to the message on the response channel. Messages are sent before
+// the timer starts and are left undeleted.
+func BenchmarkReceiveMessage(b *testing.B) {
+	server, queue := newTestQueue(b)
+
+	// the queues of a Server keep bodies as they are on the wire
+	body := ali_mns.Base64Bytes(base64.StdEncoding.EncodeToString(benchmarkBody))
+	for sent := 0; sent < b.N; {
+		var batch []ali_mns.MessageSendRequest
+		for ; sent < b.N && len(batch) < 16; sent++ {
+			batch = append(batch, ali_mns.MessageSendRequest{MessageBody: body})
+		}
+
+		if _, err := server.Queue("test").BatchSendMessage(batch...); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	respChan := make(chan ali_mns.MessageReceiveResponse)
+	errChan := make(chan error)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkBody)))
+	b.ResetTimer()
+
+	go queue.ReceiveMessage(respChan, errChan)
+	defer queue.Stop()
+
+	for i := 0; i < b.N; i++ {
+		select {
+		case <-respChan:
+		case err := <-errChan:
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestQueueProxy(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		opts []ali_mns.ClientOption
+		err  bool
+	}{
+		{"Default", nil, false},
+		{"Transport", []ali_mns.ClientOption{ali_mns.WithTransport(http.DefaultTransport)}, true},
+		{"HTTPClient", []ali_mns.ClientOption{ali_mns.WithHTTPClient(http.DefaultClient)}, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server, _ := newTestQueue(t)
+
+			// the endpoint cannot be reached but through the proxy, which is
+			// the server
+			t.Setenv(ali_mns.PROXY_PREFIX+"TEST", server.URL)
+			client := ali_mns.NewAliMNSClient("http://mns.invalid", "test-id", "test-secret", test.opts...)
+
+			queue, err := ali_mns.NewMNSQueueWithOptions("test", client)
+			if test.err {
+				if !ali_mns.ERR_QUEUE_PROXY_IGNORED.IsEqual(err) {
+					t.Fatalf("got %v, want ERR_QUEUE_PROXY_IGNORED", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := queue.(ali_mns.BodySender).SendStringMessage("proxied"); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestServerClock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := alimnstest.NewFakeClock(start)
+
+	server := alimnstest.NewServer(alimnstest.WithServerClock(clock))
+	t.Cleanup(server.Close)
+
+	client := ali_mns.NewAliMNSClient(server.URL, "test-id", "test-secret")
+	manager := ali_mns.NewMNSQueueManagerWithClient(client)
+	if err := manager.CreateQueue(server.URL, "test", 0, 65536, 345600, 30, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	queue := ali_mns.NewMNSQueue("test", client)
+	if _, err := queue.SendMessage(ali_mns.MessageSendRequest{MessageBody: []byte("hidden for 30s")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := receiveOne(t, queue); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, step := range []struct {
+		advance  time.Duration
+		active   int64
+		inactive int64
+	}{
+		{0, 0, 1},
+		{29 * time.Second, 0, 1},
+		{2 * time.Second, 1, 0},
+	} {
+		clock.Advance(step.advance)
+
+		attr := server.Queue("test").Attributes()
+		if attr.ActiveMessages != step.active || attr.InactiveMessages != step.inactive {
+			t.Fatalf("at %s: %d active and %d inactive messages, want %d and %d",
+				clock.Now().Sub(start), attr.ActiveMessages, attr.InactiveMessages, step.active, step.inactive)
+		}
+	}
+
+	attr, err := manager.GetQueueAttributes(server.URL, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attr.CreateTime != start.Unix() {
+		t.Fatalf("queue created at %d, want %d", attr.CreateTime, start.Unix())
+	}
+}
+
+func TestReceiveErrorBackoffWaitsAtLeastMin(t *testing.T) {
+	url, failing := newFlakyServer(t)
+	clock := alimnstest.NewFakeClock(time.Time{})
+
+	var requests int32
+	client := ali_mns.NewAliMNSClient(url, "test-id", "test-secret",
+		ali_mns.WithClock(clock),
+		ali_mns.WithRetryPolicy(ali_mns.NoRetry),
+		ali_mns.OnRequest(func(ali_mns.Method, string, map[string]string) { atomic.AddInt32(&requests, 1) }))
+	if err := ali_mns.NewMNSQueueManagerWithClient(client).CreateQueue(url, "test", 0, 65536, 345600, 30, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	aliQueue, err := ali_mns.NewMNSQueueWithOptions("test", client, ali_mns.WithReceiveErrorBackoff(time.Second, time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue := aliQueue.(*ali_mns.MNSQueue)
+
+	atomic.StoreInt32(failing, 1)
+	atomic.StoreInt32(&requests, 0)
+
+	respChan := make(chan ali_mns.MessageReceiveResponse)
+	errChan := make(chan error, 100)
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		queue.ReceiveMessage(respChan, errChan, 0)
+	}()
+	defer waitClosed(t, done, 5*time.Second, "ReceiveMessage")
+	defer queue.Stop()
+
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	waitFor("the first poll to back off", func() bool { return atomic.LoadInt32(&requests) == 1 && clock.Waiters() > 0 })
+
+	clock.Advance(time.Second - time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Fatalf("polled %d times before the minimum backoff passed", n)
+	}
+
+	clock.Advance(time.Millisecond)
+	waitFor("the second poll", func() bool { return atomic.LoadInt32(&requests) == 2 })
+}
+
+func TestQueueNameValidation(t *testing.T) {
+	server := alimnstest.NewServer()
+	t.Cleanup(server.Close)
+
+	client := ali_mns.NewAliMNSClient(server.URL, "test-id", "test-secret")
+	manager := ali_mns.NewMNSQueueManagerWithClient(client)
+
+	for _, test := range []struct {
+		name  string
+		queue string
+		want  errors.ErrCodeTemplate
+	}{
+		{"Valid", "orders-2024", nil},
+		{"LongestValid", strings.Repeat("q", ali_mns.MaxQueueNameLength), nil},
+		{"Empty", "", ali_mns.ERR_MNS_QUEUE_NAME_IS_EMPTY},
+		{"TooLong", strings.Repeat("q", ali_mns.MaxQueueNameLength+1), ali_mns.ERR_MNS_QUEUE_NAME_IS_TOO_LONG},
+		{"LeadingHyphen", "-orders", ali_mns.ERR_MNS_QUEUE_NAME_STARTS_WITH_HYPHEN},
+		{"Underscore", "my_orders", ali_mns.ERR_MNS_QUEUE_NAME_INVALID_CHARACTER},
+		{"Dot", "orders.v2", ali_mns.ERR_MNS_QUEUE_NAME_INVALID_CHARACTER},
+		{"NonASCII", "订单", ali_mns.ERR_MNS_QUEUE_NAME_INVALID_CHARACTER},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			check := func(what string, err error) {
+				t.Helper()
+				if test.want == nil && err != nil {
+					t.Fatalf("%s: %v", what, err)
+				}
+				if test.want != nil && !test.want.IsEqual(err) {
+					t.Fatalf("%s: got error %v, want %s", what, err, test.want.New().Error())
+				}
+			}
+
+			check("CreateQueue", manager.CreateQueue(server.URL, test.queue, 0, 65536, 345600, 30, 0))
+
+			_, err := ali_mns.NewMNSQueueWithOptions(test.queue, client)
+			check("NewMNSQueueWithOptions", err)
+		})
+	}
+}
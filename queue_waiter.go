@@ -0,0 +1,70 @@
+package ali_mns
+
+import (
+	"context"
+	"time"
+
+	"github.com/gogap/errors"
+)
+
+const (
+	waitQueueMinInterval = 200 * time.Millisecond
+	waitQueueMaxInterval = 5 * time.Second
+)
+
+// WaitForQueueActive polls until the queue exists, e.g. after CreateQueue.
+func (p *MNSQueueManager) WaitForQueueActive(endpoint string, queueName string, timeout time.Duration) (err error) {
+	return p.waitForQueue(endpoint, queueName, timeout, "active", func(err error) (done bool, e error) {
+		if err == nil {
+			return true, nil
+		}
+		if ERR_MNS_QUEUE_NOT_EXIST.IsEqual(err) {
+			return false, nil
+		}
+		return false, err
+	})
+}
+
+// WaitForQueueDeleted polls until the queue no longer exists, e.g. after
+// DeleteQueue. MNS may still refuse to create the queue again for a while,
+// see ERR_MNS_QUEUE_DELETED_RECENTLY.
+func (p *MNSQueueManager) WaitForQueueDeleted(endpoint string, queueName string, timeout time.Duration) (err error) {
+	return p.waitForQueue(endpoint, queueName, timeout, "deleted", func(err error) (done bool, e error) {
+		if err == nil {
+			return false, nil
+		}
+		if ERR_MNS_QUEUE_NOT_EXIST.IsEqual(err) {
+			return true, nil
+		}
+		return false, err
+	})
+}
+
+func (p *MNSQueueManager) waitForQueue(endpoint string, queueName string, timeout time.Duration, state string, check func(err error) (bool, error)) (err error) {
+	clock := clockOf(p.clientFor(endpoint))
+	deadline := clock.Now().Add(timeout)
+	interval := waitQueueMinInterval
+
+	for {
+		_, e := p.GetQueueAttributes(endpoint, queueName)
+
+		var done bool
+		if done, err = check(e); done || err != nil {
+			return
+		}
+
+		remaining := deadline.Sub(clock.Now())
+		if remaining <= 0 {
+			return ERR_MNS_WAIT_QUEUE_TIMEOUT.New(errors.Params{"name": queueName, "state": state})
+		}
+
+		if interval > remaining {
+			interval = remaining
+		}
+		sleepContext(context.Background(), clock, interval)
+
+		if interval *= 2; interval > waitQueueMaxInterval {
+			interval = waitQueueMaxInterval
+		}
+	}
+}
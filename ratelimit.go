@@ -0,0 +1,190 @@
+package ali_mns
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// tokenBucket is a reservation based token bucket: every request takes a
+// token immediately and is told how long to wait for it, so waiters are
+// served in order and never poll.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	clock  Clock
+	locker sync.Mutex
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   SystemClock.Now(),
+		clock:  SystemClock,
+	}
+}
+
+func (p *tokenBucket) setClock(clock Clock) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.clock = clock
+	p.last = clock.Now()
+}
+
+// refill must be called with locker held.
+func (p *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(p.last).Seconds(); elapsed > 0 {
+		p.tokens += elapsed * p.rate
+		if p.tokens > p.burst {
+			p.tokens = p.burst
+		}
+	}
+	p.last = now
+}
+
+func (p *tokenBucket) reserve() time.Duration {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.refill(p.clock.Now())
+	p.tokens--
+
+	if p.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-p.tokens / p.rate * float64(time.Second))
+}
+
+func (p *tokenBucket) setRate(rate float64) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.refill(p.clock.Now())
+	p.rate = rate
+}
+
+// hold makes the next token available no sooner than d from now.
+func (p *tokenBucket) hold(d time.Duration) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.refill(p.clock.Now())
+	if tokens := 1 - d.Seconds()*p.rate; tokens < p.tokens {
+		p.tokens = tokens
+	}
+}
+
+func (p *tokenBucket) Allow() bool {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.refill(p.clock.Now())
+	if p.tokens < 1 {
+		return false
+	}
+
+	p.tokens--
+	return true
+}
+
+// Wait blocks until the token of the caller is available. The token is
+// given back if ctx is done first.
+func (p *tokenBucket) Wait(ctx context.Context) error {
+	delay := p.reserve()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := p.clock.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		p.locker.Lock()
+		if p.tokens++; p.tokens > p.burst {
+			p.tokens = p.burst
+		}
+		p.locker.Unlock()
+		return ctx.Err()
+	}
+}
+
+const (
+	adaptiveMinRate         = 1.0
+	adaptiveRecoveryPerSec  = 0.05
+	adaptiveDecreaseBackoff = time.Second
+)
+
+// adaptiveRate lowers the rate of a token bucket AIMD style: it halves the
+// rate when MNS throttles and adds back a twentieth of the limit per second
+// of successful calls. Throttling errors within a second of the last
+// decrease are counted as one.
+type adaptiveRate struct {
+	bucket       *tokenBucket
+	limit        float64
+	current      float64
+	lastIncrease time.Time
+	lastDecrease time.Time
+	locker       sync.Mutex
+}
+
+func newAdaptiveRate(bucket *tokenBucket, limit float64) *adaptiveRate {
+	return &adaptiveRate{
+		bucket:  bucket,
+		limit:   limit,
+		current: limit,
+	}
+}
+
+// throttled returns the lowered rate, zero if it was lowered within the
+// last second already.
+func (p *adaptiveRate) throttled() (rate float64) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	now := p.bucket.clock.Now()
+	if now.Sub(p.lastDecrease) < adaptiveDecreaseBackoff {
+		return
+	}
+
+	p.current /= 2
+	if p.current < adaptiveMinRate {
+		p.current = adaptiveMinRate
+	}
+
+	p.lastDecrease = now
+	p.lastIncrease = now
+	p.bucket.setRate(p.current)
+
+	return p.current
+}
+
+func (p *adaptiveRate) succeeded() {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if p.current >= p.limit {
+		return
+	}
+
+	now := p.bucket.clock.Now()
+	p.current += p.limit * adaptiveRecoveryPerSec * now.Sub(p.lastIncrease).Seconds()
+	if p.current > p.limit {
+		p.current = p.limit
+	}
+
+	p.lastIncrease = now
+	p.bucket.setRate(p.current)
+}
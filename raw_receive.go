@@ -0,0 +1,125 @@
+package ali_mns
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// RawMessageResponse is a receive or peek response as MNS sent it. The XML
+// is not decoded, so codecs, compression and encryption of the queue are not
+// applied to it either.
+type RawMessageResponse struct {
+	ResponseMeta
+	Body []byte
+}
+
+// RawReceiver is implemented by queues delivering undecoded receive and peek
+// responses, like MNSQueue and alimnstest.FakeQueue.
+type RawReceiver interface {
+	ReceiveRawMessage(respChan chan RawMessageResponse, errChan chan error, waitseconds ...int64)
+	PeekRawMessage(respChan chan RawMessageResponse, errChan chan error, interval ...time.Duration)
+}
+
+func (p *RawMessageResponse) setResponseMeta(meta ResponseMeta) {
+	p.ResponseMeta = meta
+}
+
+// rawDecoder keeps the body of RawMessageResponse targets and leaves error
+// responses to decoder.
+type rawDecoder struct {
+	decoder MNSDecoder
+}
+
+func (p rawDecoder) Decode(reader io.Reader, v interface{}) (err error) {
+	if raw, ok := v.(*RawMessageResponse); ok {
+		raw.Body, err = ioutil.ReadAll(reader)
+		return
+	}
+
+	return p.decoder.Decode(reader, v)
+}
+
+func (p *MNSQueue) receiveRaw(ctx context.Context, resource string) (resp RawMessageResponse, err error) {
+	_, err = sendWithRetry(p.requestContext(ctx), p.client, rawDecoder{p.decoder}, p.retryPolicy, GET, nil, nil, resource, &resp)
+	p.stats.record(OperationName(GET, nil, resource), err)
+	p.adaptQPS(err)
+	return
+}
+
+// ReceiveRawMessage works like ReceiveMessage but delivers the undecoded
+// response, for gateways that forward messages as they are.
+func (p *MNSQueue) ReceiveRawMessage(respChan chan RawMessageResponse, errChan chan error, waitseconds ...int64) {
+	resource := fmt.Sprintf("queues/%s/%s", p.name, "messages")
+	if waitseconds != nil && len(waitseconds) == 1 && waitseconds[0] >= 0 {
+		resource = fmt.Sprintf("queues/%s/%s?waitseconds=%d", p.name, "messages", waitseconds[0])
+	}
+
+	ctx := p.loopContext()
+	backoff := p.newEmptyReceiveBackoff()
+
+	for ctx.Err() == nil {
+		start := p.clock.Now()
+		resp, err := p.receiveRaw(ctx, resource)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			select {
+			case errChan <- err:
+			case <-ctx.Done():
+				return
+			}
+		} else {
+			select {
+			case respChan <- resp:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		p.checkQPS(ctx)
+		backoff.wait(ctx, err, p.clock.Now().Sub(start))
+	}
+}
+
+// PeekRawMessage works like PeekMessage but delivers the undecoded response.
+func (p *MNSQueue) PeekRawMessage(respChan chan RawMessageResponse, errChan chan error, interval ...time.Duration) {
+	resource := fmt.Sprintf("queues/%s/%s?peekonly=true", p.name, "messages")
+
+	itv := time.Duration(0)
+	if len(interval) == 1 {
+		itv = interval[0]
+	}
+
+	ctx := p.loopContext()
+	backoff := p.newEmptyReceiveBackoff()
+
+	for ctx.Err() == nil {
+		start := p.clock.Now()
+		resp, err := p.receiveRaw(ctx, resource)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			select {
+			case errChan <- err:
+			case <-ctx.Done():
+				return
+			}
+		} else {
+			select {
+			case respChan <- resp:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		sleepContext(ctx, p.clock, itv)
+		backoff.wait(ctx, err, p.clock.Now().Sub(start))
+	}
+}
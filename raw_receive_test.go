@@ -0,0 +1,54 @@
+package ali_mns_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/gogap/ali_mns"
+)
+
+func TestReceiveRawMessage(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		receive func(queue *ali_mns.MNSQueue, respChan chan ali_mns.RawMessageResponse, errChan chan error)
+	}{
+		{"Receive", func(queue *ali_mns.MNSQueue, respChan chan ali_mns.RawMessageResponse, errChan chan error) {
+			queue.ReceiveRawMessage(respChan, errChan, 1)
+		}},
+		{"Peek", func(queue *ali_mns.MNSQueue, respChan chan ali_mns.RawMessageResponse, errChan chan error) {
+			queue.PeekRawMessage(respChan, errChan)
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, queue := newTestQueue(t)
+
+			if _, err := queue.SendStringMessage("raw body"); err != nil {
+				t.Fatal(err)
+			}
+
+			respChan := make(chan ali_mns.RawMessageResponse)
+			errChan := make(chan error)
+			done := make(chan bool)
+			go func() {
+				defer close(done)
+				test.receive(queue, respChan, errChan)
+			}()
+			defer waitClosed(t, done, 5*time.Second, test.name)
+			defer queue.Stop()
+
+			select {
+			case resp := <-respChan:
+				want := "<MessageBody>" + base64.StdEncoding.EncodeToString([]byte("raw body")) + "</MessageBody>"
+				if !bytes.Contains(resp.Body, []byte(want)) {
+					t.Errorf("body is not the undecoded response XML: %s", resp.Body)
+				}
+			case err := <-errChan:
+				t.Fatal(err)
+			case <-time.After(5 * time.Second):
+				t.Fatal("no message received within 5s")
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package ali_mns
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const redactedValue = "******"
+
+var (
+	authorizationPattern = regexp.MustCompile(`MNS\s+([^:\s]+):\S+`)
+	sensitiveHeaders     = []string{AUTHORIZATION, SECURITY_TOKEN}
+)
+
+func maskAccessKeyId(accessKeyId string) string {
+	if len(accessKeyId) <= 8 {
+		return redactedValue
+	}
+
+	return accessKeyId[:4] + redactedValue + accessKeyId[len(accessKeyId)-4:]
+}
+
+func redactAuthorization(authorization string) string {
+	return authorizationPattern.ReplaceAllStringFunc(authorization, func(s string) string {
+		matches := authorizationPattern.FindStringSubmatch(s)
+		return fmt.Sprintf("MNS %s:%s", maskAccessKeyId(matches[1]), redactedValue)
+	})
+}
+
+func redactURL(rawURL string) string {
+	u, err := parseProxyURL(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+
+	if _, hasPassword := u.User.Password(); !hasPassword {
+		return u.String()
+	}
+
+	// url.URL would escape the asterisks of redactedValue, so it goes in
+	// after the escaped username, in front of the first @
+	u.User = url.User(u.User.Username())
+	redacted := u.String()
+	i := strings.Index(redacted, "@")
+
+	return redacted[:i] + ":" + redactedValue + redacted[i:]
+}
+
+func isSensitiveHeader(name string) bool {
+	for _, header := range sensitiveHeaders {
+		if strings.EqualFold(header, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactHeaderValue(name, value string) string {
+	if strings.EqualFold(name, AUTHORIZATION) {
+		return redactAuthorization(value)
+	}
+
+	if isSensitiveHeader(name) {
+		return redactedValue
+	}
+
+	return value
+}
+
+func redactHeaders(headers map[string]string) map[string]string {
+	redacted := make(map[string]string, len(headers))
+	for name, value := range headers {
+		redacted[name] = redactHeaderValue(name, value)
+	}
+	return redacted
+}
+
+func redactHTTPHeader(header http.Header) http.Header {
+	redacted := make(http.Header, len(header))
+	for name, values := range header {
+		for _, value := range values {
+			redacted.Add(name, redactHeaderValue(name, value))
+		}
+	}
+	return redacted
+}
+
+// redactError renders err with every credential the client knows about
+// masked, for use as an error template param.
+func (p *AliMNSClient) redactError(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	msg := redactAuthorization(err.Error())
+
+	if p.accessKeyId != "" {
+		msg = strings.Replace(msg, p.accessKeyId, maskAccessKeyId(p.accessKeyId), -1)
+	}
+
+	if p.securityToken != "" {
+		msg = strings.Replace(msg, p.securityToken, redactedValue, -1)
+	}
+
+	if proxyURL := p.proxy(); proxyURL != "" {
+		msg = strings.Replace(msg, proxyURL, redactURL(proxyURL), -1)
+	}
+
+	return msg
+}
+
+func (p *AliMNSClient) String() string {
+	return fmt.Sprintf("AliMNSClient{url: %s, accessKeyId: %s, proxy: %s}", p.url, maskAccessKeyId(p.accessKeyId), redactURL(p.proxy()))
+}
+
+func (p *AliMNSClient) GoString() string {
+	return p.String()
+}
+
+func (p *AliMNSCredential) String() string {
+	return "AliMNSCredential{accessKeySecret: " + redactedValue + "}"
+}
+
+func (p *AliMNSCredential) GoString() string {
+	return p.String()
+}
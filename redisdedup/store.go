@@ -0,0 +1,53 @@
+package redisdedup
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DefaultKeyPrefix = "ali_mns:dedup:"
+)
+
+// Store is an ali_mns.DedupStore backed by Redis, so consumers on several
+// instances share the set of processed messages. It is an
+// ali_mns.AtomicDedupStore claiming keys with SET NX PX.
+type Store struct {
+	client    redis.UniversalClient
+	keyPrefix string
+}
+
+func NewStore(client redis.UniversalClient, keyPrefix ...string) *Store {
+	prefix := DefaultKeyPrefix
+	if len(keyPrefix) == 1 {
+		prefix = keyPrefix[0]
+	}
+
+	return &Store{
+		client:    client,
+		keyPrefix: prefix,
+	}
+}
+
+func (p *Store) Exists(key string) (exist bool, err error) {
+	var n int64
+	if n, err = p.client.Exists(context.Background(), p.keyPrefix+key).Result(); err != nil {
+		return
+	}
+
+	return n > 0, nil
+}
+
+func (p *Store) Add(key string, window time.Duration) (err error) {
+	return p.client.Set(context.Background(), p.keyPrefix+key, 1, window).Err()
+}
+
+func (p *Store) AddIfAbsent(key string, window time.Duration) (added bool, err error) {
+	return p.client.SetNX(context.Background(), p.keyPrefix+key, 1, window).Result()
+}
+
+func (p *Store) Remove(key string) (err error) {
+	return p.client.Del(context.Background(), p.keyPrefix+key).Err()
+}
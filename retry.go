@@ -0,0 +1,132 @@
+package ali_mns
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	DefaultRetryMaxAttempts = 3
+	DefaultRetryBaseDelay   = time.Millisecond * 100
+	DefaultRetryMaxDelay    = time.Second * 5
+)
+
+type RetryPolicy interface {
+	// ShouldRetry is called after every failed attempt (attempt starts at 1)
+	// and decides whether to try again and how long to wait before doing so.
+	ShouldRetry(attempt int, method Method, statusCode int, err error) (retry bool, delay time.Duration)
+}
+
+type RetryPolicyFunc func(attempt int, method Method, statusCode int, err error) (retry bool, delay time.Duration)
+
+func (p RetryPolicyFunc) ShouldRetry(attempt int, method Method, statusCode int, err error) (retry bool, delay time.Duration) {
+	return p(attempt, method, statusCode, err)
+}
+
+var NoRetry RetryPolicy = RetryPolicyFunc(func(int, Method, int, error) (bool, time.Duration) {
+	return false, 0
+})
+
+type ExponentialBackoff struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+func NewExponentialBackoff(maxAttempts int, baseDelay, maxDelay time.Duration) *ExponentialBackoff {
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultRetryMaxAttempts
+	}
+
+	if baseDelay <= 0 {
+		baseDelay = DefaultRetryBaseDelay
+	}
+
+	if maxDelay < baseDelay {
+		maxDelay = DefaultRetryMaxDelay
+		if maxDelay < baseDelay {
+			maxDelay = baseDelay
+		}
+	}
+
+	return &ExponentialBackoff{
+		MaxAttempts: maxAttempts,
+		BaseDelay:   baseDelay,
+		MaxDelay:    maxDelay,
+	}
+}
+
+func (p *ExponentialBackoff) ShouldRetry(attempt int, method Method, statusCode int, err error) (retry bool, delay time.Duration) {
+	if err == nil || attempt >= p.MaxAttempts {
+		return
+	}
+
+	if !isTransientError(method, err) {
+		return
+	}
+
+	delay = p.backoff(attempt)
+	if hint := RetryAfter(err); hint > delay {
+		delay = hint
+	} else if ERR_MNS_QPS_LIMIT_EXCEEDED.IsEqual(err) && delay < p.BaseDelay {
+		delay = p.BaseDelay
+	}
+
+	return true, delay
+}
+
+// backoff returns a full-jitter delay: a random duration between zero and
+// BaseDelay*2^(attempt-1), capped at MaxDelay.
+func (p *ExponentialBackoff) backoff(attempt int) time.Duration {
+	delay := p.ceiling(attempt)
+	if delay <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+// equalJitterBackoff returns a random duration between BaseDelay and
+// BaseDelay*2^(attempt-1), capped at MaxDelay, so it never retries at once.
+func (p *ExponentialBackoff) equalJitterBackoff(attempt int) time.Duration {
+	delay := p.ceiling(attempt)
+	if delay <= p.BaseDelay {
+		return p.BaseDelay
+	}
+
+	return p.BaseDelay + time.Duration(rand.Int63n(int64(delay-p.BaseDelay)+1))
+}
+
+// ceiling returns BaseDelay*2^(attempt-1) capped at MaxDelay.
+func (p *ExponentialBackoff) ceiling(attempt int) time.Duration {
+	if shift := uint(attempt - 1); shift < 32 {
+		if d := p.BaseDelay << shift; d > 0 && d < p.MaxDelay {
+			return d
+		}
+	}
+
+	return p.MaxDelay
+}
+
+func isIdempotent(method Method) bool {
+	switch method {
+	case GET, PUT, DELETE:
+		return true
+	}
+	return false
+}
+
+// isTransientError reports whether a failed call may succeed when repeated.
+// Throttled requests were never executed, so they are retried for every
+// method; network and server errors only for idempotent ones.
+func isTransientError(method Method, err error) bool {
+	if ERR_MNS_QPS_LIMIT_EXCEEDED.IsEqual(err) {
+		return true
+	}
+
+	if !isIdempotent(method) {
+		return false
+	}
+
+	return Retryable(err)
+}
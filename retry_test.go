@@ -0,0 +1,168 @@
+package ali_mns_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gogap/ali_mns"
+	"github.com/gogap/ali_mns/alimnstest"
+)
+
+// failingServer serves like alimnstest.Server, but answers the first
+// failures requests of method with an MNS error of status and code.
+type failingServer struct {
+	*alimnstest.Server
+	URL string
+
+	method     string
+	failures   int32
+	status     int
+	code       string
+	retryAfter string
+	requests   int32
+}
+
+func newFailingServer(t *testing.T, method string, failures int32, status int, code string) (server *failingServer) {
+	server = &failingServer{
+		Server:   alimnstest.NewServer(),
+		method:   method,
+		failures: failures,
+		status:   status,
+		code:     code,
+	}
+	t.Cleanup(server.Server.Close)
+
+	wrapper := httptest.NewServer(server)
+	t.Cleanup(wrapper.Close)
+	server.URL = wrapper.URL
+
+	return
+}
+
+func (p *failingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != p.method {
+		p.Server.ServeHTTP(w, r)
+		return
+	}
+
+	atomic.AddInt32(&p.requests, 1)
+
+	if atomic.AddInt32(&p.failures, -1) < 0 {
+		p.Server.ServeHTTP(w, r)
+		return
+	}
+
+	if p.retryAfter != "" {
+		w.Header().Set(ali_mns.RETRY_AFTER, p.retryAfter)
+	}
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(p.status)
+	w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><Error xmlns="http://mns.aliyuncs.com/doc/v1"><Code>` + p.code + `</Code><Message>injected</Message></Error>`))
+}
+
+// queue returns the queue of the server built with opts, on a client built
+// with clientOpts.
+func (p *failingServer) queue(t *testing.T, clientOpts []ali_mns.ClientOption, opts ...ali_mns.QueueOption) *ali_mns.MNSQueue {
+	client := ali_mns.NewAliMNSClient(p.URL, "test-id", "test-secret", clientOpts...)
+	if err := ali_mns.NewMNSQueueManagerWithClient(client).CreateQueue(p.URL, "test", 0, 65536, 345600, 30, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	queue, err := ali_mns.NewMNSQueueWithOptions("test", client, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return queue.(*ali_mns.MNSQueue)
+}
+
+func TestRetryPolicy(t *testing.T) {
+	retry := []ali_mns.ClientOption{ali_mns.WithRetry(3, time.Millisecond, 2*time.Millisecond)}
+
+	for _, test := range []struct {
+		name         string
+		method       string
+		failures     int32
+		status       int
+		code         string
+		queueOpts    []ali_mns.QueueOption
+		wantErr      bool
+		wantRequests int32
+	}{
+		{"IdempotentRetried", http.MethodDelete, 2, http.StatusInternalServerError, "InternalError", nil, false, 3},
+		{"IdempotentGivesUp", http.MethodDelete, 3, http.StatusInternalServerError, "InternalError", nil, true, 3},
+		{"NonIdempotentNotRetried", http.MethodPost, 1, http.StatusInternalServerError, "InternalError", nil, true, 1},
+		{"ThrottledRetried", http.MethodPost, 1, http.StatusServiceUnavailable, "QpsLimitExceeded", nil, false, 2},
+		{"NotFoundNotRetried", http.MethodDelete, 1, http.StatusNotFound, "MessageNotExist", nil, true, 1},
+		{"QueuePolicyOverridesClient", http.MethodDelete, 1, http.StatusInternalServerError, "InternalError", []ali_mns.QueueOption{ali_mns.WithQueueRetryPolicy(ali_mns.NoRetry)}, true, 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server := newFailingServer(t, test.method, 0, test.status, test.code)
+			queue := server.queue(t, retry, test.queueOpts...)
+
+			if _, err := queue.SendMessage(ali_mns.MessageSendRequest{MessageBody: []byte("retried")}); err != nil {
+				t.Fatal(err)
+			}
+			resp, err := receiveOne(t, queue)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			atomic.StoreInt32(&server.requests, 0)
+			atomic.StoreInt32(&server.failures, test.failures)
+
+			if test.method == http.MethodPost {
+				_, err = queue.SendMessage(ali_mns.MessageSendRequest{MessageBody: []byte("retried")})
+			} else {
+				err = queue.DeleteMessage(resp.ReceiptHandle)
+			}
+
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error: %t", err, test.wantErr)
+			}
+			if requests := atomic.LoadInt32(&server.requests); requests != test.wantRequests {
+				t.Fatalf("sent %d requests, want %d", requests, test.wantRequests)
+			}
+		})
+	}
+}
+
+func TestRetryAfterHint(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		retryAfter string
+		wantDelay  time.Duration
+	}{
+		{"LongerThanBackoff", "2", 2 * time.Second},
+		{"Missing", "", time.Millisecond},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server := newFailingServer(t, http.MethodPost, 1, http.StatusServiceUnavailable, "QpsLimitExceeded")
+			server.retryAfter = test.retryAfter
+
+			backoff := ali_mns.NewExponentialBackoff(3, time.Millisecond, time.Millisecond)
+
+			var delays []time.Duration
+			policy := ali_mns.RetryPolicyFunc(func(attempt int, method ali_mns.Method, statusCode int, err error) (bool, time.Duration) {
+				retry, delay := backoff.ShouldRetry(attempt, method, statusCode, err)
+				delays = append(delays, delay)
+				return retry, 0
+			})
+
+			queue := server.queue(t, []ali_mns.ClientOption{ali_mns.WithRetryPolicy(policy)})
+			if _, err := queue.SendMessage(ali_mns.MessageSendRequest{MessageBody: []byte("throttled")}); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(delays) != 1 {
+				t.Fatalf("policy asked %d times, want once", len(delays))
+			}
+			if delays[0] < test.wantDelay {
+				t.Fatalf("retry delayed %s, want at least %s", delays[0], test.wantDelay)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package ali_mns
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+)
+
+// Retryable reports whether the request that failed with err may succeed
+// when repeated: throttling, server errors, timeouts and broken connections.
+// Other failures to send, such as TLS errors, are not retryable, nor are
+// cancelled requests. Whether repeating it is safe is up to the caller, see
+// ExponentialBackoff.
+func Retryable(err error) bool {
+	if err == nil || isCanceled(err) {
+		return false
+	}
+
+	if ERR_MNS_QPS_LIMIT_EXCEEDED.IsEqual(err) ||
+		ERR_MNS_INTERNAL_ERROR.IsEqual(err) {
+		return true
+	}
+
+	return IsTimeout(err) || IsConnectionError(err)
+}
+
+// isCanceled reports whether err is a request given up by its caller.
+func isCanceled(err error) bool {
+	return errors.Is(err, context.Canceled)
+}
+
+// IsTimeout reports whether err is a request that timed out, either in the
+// client or because its context deadline passed.
+func IsTimeout(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// IsConnectionError reports whether err is a failure to reach MNS or a
+// connection dropped by the other side, as opposed to an error response.
+func IsConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func (p *MNSError) Retryable() bool {
+	return Retryable(p)
+}
@@ -0,0 +1,90 @@
+package ali_mns
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gogap/errors"
+)
+
+// SendOption sets the optional fields of a message built by the send helpers.
+type SendOption func(*MessageSendRequest)
+
+func WithDelaySeconds(delaySeconds int64) SendOption {
+	return func(p *MessageSendRequest) {
+		p.DelaySeconds = delaySeconds
+	}
+}
+
+func WithPriority(priority int64) SendOption {
+	return func(p *MessageSendRequest) {
+		p.Priority = priority
+	}
+}
+
+func newMessageSendRequest(body []byte, opts ...SendOption) MessageSendRequest {
+	message := MessageSendRequest{
+		MessageBody: Base64Bytes(body),
+		Priority:    DefaultMessagePriority,
+	}
+
+	for _, opt := range opts {
+		opt(&message)
+	}
+
+	return message
+}
+
+// BodySender is implemented by queues sending strings and JSON documents as
+// message bodies, like MNSQueue and alimnstest.FakeQueue.
+type BodySender interface {
+	SendStringMessage(body string, opts ...SendOption) (resp MessageSendResponse, err error)
+	SendJSONMessage(v interface{}, opts ...SendOption) (resp MessageSendResponse, err error)
+}
+
+func (p *MNSQueue) SendStringMessage(body string, opts ...SendOption) (resp MessageSendResponse, err error) {
+	return p.SendMessage(newMessageSendRequest([]byte(body), opts...))
+}
+
+func (p *MNSQueue) SendJSONMessage(v interface{}, opts ...SendOption) (resp MessageSendResponse, err error) {
+	body, e := json.Marshal(v)
+	if e != nil {
+		err = ERR_MARSHAL_MESSAGE_FAILED.New(errors.Params{"err": e})
+		return
+	}
+
+	return p.SendMessage(newMessageSendRequest(body, opts...))
+}
+
+// ScheduledSender is implemented by queues sending messages to be delivered
+// at a given time, like MNSQueue and alimnstest.FakeQueue.
+type ScheduledSender interface {
+	SendMessageAt(body []byte, deliverAt time.Time, opts ...SendOption) (resp MessageSendResponse, err error)
+}
+
+// SendMessageAt sends a message that becomes visible at deliverAt, at most
+// MaxMessageDelay from now. Times in the past deliver immediately.
+func (p *MNSQueue) SendMessageAt(body []byte, deliverAt time.Time, opts ...SendOption) (resp MessageSendResponse, err error) {
+	message := newMessageSendRequest(body, opts...)
+
+	if delay := deliverAt.Sub(p.clock.Now()); delay > 0 {
+		message.DelaySeconds = int64((delay + time.Second - 1) / time.Second)
+	}
+
+	if err = checkMessage(message); err != nil {
+		return
+	}
+
+	return p.SendMessage(message)
+}
+
+func (p MessageReceiveResponse) BodyString() string {
+	return string(p.Payload())
+}
+
+func (p MessageReceiveResponse) DecodeJSON(v interface{}) (err error) {
+	if e := json.Unmarshal(p.Payload(), v); e != nil {
+		err = ERR_UNMARSHAL_BODY_FAILED.New(errors.Params{"err": e})
+	}
+	return
+}
@@ -0,0 +1,45 @@
+package ali_mns_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gogap/errors"
+
+	"github.com/gogap/ali_mns"
+	"github.com/gogap/ali_mns/alimnstest"
+)
+
+func TestSendMessageAt(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		after   time.Duration
+		delayed int64
+		err     errors.ErrCodeTemplate
+	}{
+		{"Past", -time.Minute, 0, nil},
+		{"Now", 0, 0, nil},
+		{"Future", 1500 * time.Millisecond, 1, nil},
+		{"BeyondMaxDelay", ali_mns.MaxMessageDelay + time.Second, 0, ali_mns.ERR_MNS_MESSAGE_DELAY_SECONDS_RANGE_ERROR},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			clock := alimnstest.NewFakeClock(time.Time{})
+			server, queue := newTestQueue(t, ali_mns.WithQueueClock(clock))
+
+			_, err := queue.SendMessageAt([]byte("scheduled"), clock.Now().Add(test.after))
+			if test.err != nil {
+				if !test.err.IsEqual(err) {
+					t.Fatalf("got %v, want ERR_MNS_MESSAGE_DELAY_SECONDS_RANGE_ERROR", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if delayed := server.Queue("test").Attributes().DelayMessages; delayed != test.delayed {
+				t.Errorf("%d messages delayed, want %d", delayed, test.delayed)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+// Package snappycompress registers a snappy ali_mns.Compressor. Importing it
+// is enough for consumers to decompress snappy bodies.
+package snappycompress
+
+import (
+	"fmt"
+
+	"github.com/golang/snappy"
+
+	"github.com/gogap/ali_mns"
+)
+
+type compressor struct{}
+
+var Compressor ali_mns.Compressor = compressor{}
+
+func init() {
+	ali_mns.RegisterCompressor(Compressor)
+}
+
+func (compressor) ID() byte {
+	return 2
+}
+
+func (compressor) Compress(body []byte) ([]byte, error) {
+	return snappy.Encode(nil, body), nil
+}
+
+func (compressor) Decompress(body []byte) ([]byte, error) {
+	size, err := snappy.DecodedLen(body)
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(size) > ali_mns.MaxDecompressedSize {
+		return nil, fmt.Errorf("decompressed body exceeds %d bytes", ali_mns.MaxDecompressedSize)
+	}
+
+	return snappy.Decode(nil, body)
+}
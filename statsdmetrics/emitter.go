@@ -0,0 +1,345 @@
+package statsdmetrics
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogap/ali_mns"
+)
+
+const (
+	DefaultPrefix        = "ali_mns"
+	DefaultFlushInterval = time.Second * 10
+
+	// maxPacketSize keeps packets below the usual MTU so lines are not lost
+	// to fragmentation.
+	maxPacketSize = 1432
+)
+
+type Option func(*Emitter)
+
+// WithPrefix sets the prefix of every metric name, "ali_mns" by default.
+func WithPrefix(prefix string) Option {
+	return func(p *Emitter) {
+		p.prefix = prefix
+	}
+}
+
+// WithSampleRate samples the per-request metrics of ClientOption, between
+// 0 and 1. The servers scale sampled counters back up.
+func WithSampleRate(rate float64) Option {
+	return func(p *Emitter) {
+		if rate > 0 && rate <= 1 {
+			p.sampleRate = rate
+		}
+	}
+}
+
+// WithFlushInterval sets how often the stats of added clients, queues and
+// consumers are emitted.
+func WithFlushInterval(interval time.Duration) Option {
+	return func(p *Emitter) {
+		if interval > 0 {
+			p.interval = interval
+		}
+	}
+}
+
+// WithClock makes the emitter flush on the tickers of clock.
+func WithClock(clock ali_mns.Clock) Option {
+	return func(p *Emitter) {
+		if clock != nil {
+			p.clock = clock
+		}
+	}
+}
+
+// WithTags adds constant tags, "key:value" pairs, to every metric.
+func WithTags(tags ...string) Option {
+	return func(p *Emitter) {
+		p.tags = append(p.tags, tags...)
+	}
+}
+
+// WithPlainStatsD emits for servers without the DogStatsD tag extension:
+// tag values are appended to the metric name instead, e.g.
+// ali_mns.queue.requests.my-queue.SendMessage.
+func WithPlainStatsD() Option {
+	return func(p *Emitter) {
+		p.plain = true
+	}
+}
+
+// Emitter sends the metrics of clients, queues and consumers of ali_mns to
+// a StatsD or DogStatsD server over UDP. Request latency and counts are
+// emitted as they happen by the option of ClientOption; the stats of added
+// clients, queues and consumers are emitted every flush interval as the
+// increase since the previous flush.
+type Emitter struct {
+	conn       net.Conn
+	prefix     string
+	sampleRate float64
+	interval   time.Duration
+	clock      ali_mns.Clock
+	tags       []string
+	plain      bool
+
+	clients   map[string]ali_mns.ErrorStatsReporter
+	queues    map[string]ali_mns.StatsReporter
+	consumers map[string]*ali_mns.Consumer
+	last      map[string]int64
+	locker    sync.Mutex
+
+	stopChan chan bool
+	doneChan chan bool
+}
+
+// New connects to the server at address, such as "127.0.0.1:8125", and
+// starts flushing.
+func New(address string, opts ...Option) (emitter *Emitter, err error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return
+	}
+
+	emitter = &Emitter{
+		conn:       conn,
+		prefix:     DefaultPrefix,
+		sampleRate: 1,
+		interval:   DefaultFlushInterval,
+		clock:      ali_mns.SystemClock,
+		clients:    make(map[string]ali_mns.ErrorStatsReporter),
+		queues:     make(map[string]ali_mns.StatsReporter),
+		consumers:  make(map[string]*ali_mns.Consumer),
+		last:       make(map[string]int64),
+		stopChan:   make(chan bool),
+		doneChan:   make(chan bool),
+	}
+
+	for _, opt := range opts {
+		opt(emitter)
+	}
+
+	go emitter.run()
+
+	return
+}
+
+// ClientOption emits the latency and the count of every request of the
+// client, tagged with its HTTP status, 0 if no response was received.
+func (p *Emitter) ClientOption() ali_mns.ClientOption {
+	return ali_mns.OnResponse(func(statusCode int, duration time.Duration, requestId string, err error) {
+		if p.sampleRate < 1 && rand.Float64() >= p.sampleRate {
+			return
+		}
+
+		status := "status:" + strconv.Itoa(statusCode)
+
+		buf := bytes.Buffer{}
+		p.writeLine(&buf, "request.duration", milliseconds(duration), "ms", p.sampleRate, status)
+		p.writeLine(&buf, "requests", "1", "c", p.sampleRate, status)
+		p.send(buf.Bytes())
+	})
+}
+
+// AddClient emits the error counts of client, see AliMNSClient.ErrorStats.
+// Clients that are no ali_mns.ErrorStatsReporter are ignored.
+func (p *Emitter) AddClient(name string, client ali_mns.MNSClient) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if reporter, ok := client.(ali_mns.ErrorStatsReporter); ok {
+		p.clients[name] = reporter
+	}
+}
+
+// AddQueue emits the stats of queue tagged with its name.
+// Queues that are no ali_mns.StatsReporter are ignored.
+func (p *Emitter) AddQueue(queue ali_mns.AliMNSQueue) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if reporter, ok := queue.(ali_mns.StatsReporter); ok {
+		p.queues[queue.Name()] = reporter
+	}
+}
+
+func (p *Emitter) AddConsumer(name string, consumer *ali_mns.Consumer) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.consumers[name] = consumer
+}
+
+// Close flushes once more, then closes the connection.
+func (p *Emitter) Close() error {
+	select {
+	case <-p.stopChan:
+		return nil
+	default:
+	}
+
+	close(p.stopChan)
+	<-p.doneChan
+
+	return p.conn.Close()
+}
+
+func (p *Emitter) run() {
+	defer close(p.doneChan)
+
+	ticker := p.clock.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			p.Flush()
+		case <-p.stopChan:
+			p.Flush()
+			return
+		}
+	}
+}
+
+// Flush emits the stats of the added clients, queues and consumers now.
+func (p *Emitter) Flush() {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	buf := bytes.Buffer{}
+
+	for name, client := range p.clients {
+		stats := client.ErrorStats()
+		for code, count := range stats.Codes {
+			p.writeCounter(&buf, "client.errors", count, "client:"+name, "code:"+code)
+		}
+		for status, count := range stats.Statuses {
+			p.writeCounter(&buf, "client.error_responses", count, "client:"+name, "status:"+strconv.Itoa(status))
+		}
+	}
+
+	for name, queue := range p.queues {
+		stats := queue.Stats()
+		p.writeLine(&buf, "queue.qps", strconv.Itoa(int(stats.QPS)), "g", 1, "queue:"+name)
+		if stats.Lag.Received > 0 {
+			p.writeLine(&buf, "queue.message_age", milliseconds(stats.Lag.AverageAge), "g", 1, "queue:"+name)
+			p.writeLine(&buf, "queue.first_dequeue_latency", milliseconds(stats.Lag.AverageFirstDequeueLatency), "g", 1, "queue:"+name)
+		}
+		for op, count := range stats.Operations {
+			p.writeCounter(&buf, "queue.requests", count, "queue:"+name, "operation:"+op)
+		}
+		for op, count := range stats.Errors {
+			p.writeCounter(&buf, "queue.request_errors", count, "queue:"+name, "operation:"+op)
+		}
+	}
+
+	for name, consumer := range p.consumers {
+		stats := consumer.Stats()
+		for _, result := range []struct {
+			name  string
+			count int64
+		}{
+			{"received", stats.Received},
+			{"processed", stats.Processed},
+			{"failed", stats.Failed},
+			{"acked", stats.Acked},
+			{"nacked", stats.Nacked},
+			{"dead_lettered", stats.DeadLettered},
+			{"duplicate", stats.Duplicates},
+		} {
+			p.writeCounter(&buf, "consumer.messages", result.count, "consumer:"+name, "result:"+result.name)
+		}
+	}
+
+	p.send(buf.Bytes())
+}
+
+// writeCounter writes the increase of a cumulative count since the previous
+// flush, if any. Must be called with the locker held.
+func (p *Emitter) writeCounter(buf *bytes.Buffer, name string, count int64, tags ...string) {
+	key := name + "|" + strings.Join(tags, ",")
+
+	delta := count - p.last[key]
+	p.last[key] = count
+
+	if delta <= 0 {
+		return
+	}
+
+	p.writeLine(buf, name, strconv.FormatInt(delta, 10), "c", 1, tags...)
+}
+
+func (p *Emitter) writeLine(buf *bytes.Buffer, name, value, metricType string, rate float64, tags ...string) {
+	if buf.Len() > 0 {
+		buf.WriteByte('\n')
+	}
+
+	if p.prefix != "" {
+		buf.WriteString(p.prefix)
+		buf.WriteByte('.')
+	}
+	buf.WriteString(name)
+
+	tags = append(append([]string(nil), p.tags...), tags...)
+
+	if p.plain {
+		sort.Strings(tags)
+		for _, tag := range tags {
+			buf.WriteByte('.')
+			buf.WriteString(sanitize(tag[strings.Index(tag, ":")+1:]))
+		}
+	}
+
+	fmt.Fprintf(buf, ":%s|%s", value, metricType)
+
+	if rate < 1 {
+		buf.WriteString("|@")
+		buf.WriteString(strconv.FormatFloat(rate, 'f', -1, 64))
+	}
+
+	if !p.plain && len(tags) > 0 {
+		buf.WriteString("|#")
+		buf.WriteString(strings.Join(tags, ","))
+	}
+}
+
+// send writes lines in packets of at most maxPacketSize bytes. Errors are
+// dropped, metrics are best effort.
+func (p *Emitter) send(lines []byte) {
+	for len(lines) > 0 {
+		packet := lines
+		if len(packet) > maxPacketSize {
+			if i := bytes.LastIndexByte(packet[:maxPacketSize], '\n'); i > 0 {
+				packet = packet[:i]
+			} else if i = bytes.IndexByte(packet, '\n'); i > 0 {
+				packet = packet[:i]
+			}
+		}
+
+		p.conn.Write(packet)
+
+		lines = bytes.TrimPrefix(lines[len(packet):], []byte{'\n'})
+	}
+}
+
+func sanitize(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', ':', '|', '@', '#', ' ', '\n':
+			return '_'
+		}
+		return r
+	}, value)
+}
+
+func milliseconds(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
@@ -0,0 +1,186 @@
+package statsdmetrics_test
+
+import (
+	"net"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogap/ali_mns"
+	"github.com/gogap/ali_mns/alimnstest"
+	"github.com/gogap/ali_mns/statsdmetrics"
+)
+
+// newStatsD listens for the packets of an emitter built with opts.
+func newStatsD(t *testing.T, opts ...statsdmetrics.Option) (conn *net.UDPConn, emitter *statsdmetrics.Emitter) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	if emitter, err = statsdmetrics.New(conn.LocalAddr().String(), opts...); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { emitter.Close() })
+
+	return
+}
+
+// readLines returns the lines of the next packet, nil if none arrives
+// within timeout.
+func readLines(t *testing.T, conn *net.UDPConn, timeout time.Duration) []string {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+
+	buf := make([]byte, 65536)
+	n, err := conn.Read(buf)
+	if err, ok := err.(net.Error); ok && err.Timeout() {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return strings.Split(string(buf[:n]), "\n")
+}
+
+var durationValue = regexp.MustCompile(`:[0-9.]+\|ms`)
+
+func TestEmitterRequestLines(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		opts  []statsdmetrics.Option
+		lines []string
+	}{
+		{"Default", nil, []string{
+			"ali_mns.request.duration:X|ms|#status:200",
+			"ali_mns.requests:1|c|#status:200",
+		}},
+		{"PrefixAndTags", []statsdmetrics.Option{statsdmetrics.WithPrefix("app"), statsdmetrics.WithTags("env:test")}, []string{
+			"app.request.duration:X|ms|#env:test,status:200",
+			"app.requests:1|c|#env:test,status:200",
+		}},
+		{"NoPrefix", []statsdmetrics.Option{statsdmetrics.WithPrefix("")}, []string{
+			"request.duration:X|ms|#status:200",
+			"requests:1|c|#status:200",
+		}},
+		{"PlainStatsD", []statsdmetrics.Option{statsdmetrics.WithPlainStatsD(), statsdmetrics.WithTags("env:te.st")}, []string{
+			"ali_mns.request.duration.te_st.200:X|ms",
+			"ali_mns.requests.te_st.200:1|c",
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server := alimnstest.NewServer()
+			t.Cleanup(server.Close)
+
+			conn, emitter := newStatsD(t, test.opts...)
+			client := ali_mns.NewAliMNSClient(server.URL, "test-id", "test-secret", emitter.ClientOption())
+
+			resp, err := client.Send(ali_mns.GET, nil, nil, "queues")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			lines := readLines(t, conn, 5*time.Second)
+			for i := range lines {
+				lines[i] = durationValue.ReplaceAllString(lines[i], ":X|ms")
+			}
+
+			if !reflect.DeepEqual(lines, test.lines) {
+				t.Fatalf("emitted %q, want %q", lines, test.lines)
+			}
+		})
+	}
+}
+
+func TestEmitterSampling(t *testing.T) {
+	server := alimnstest.NewServer()
+	t.Cleanup(server.Close)
+
+	conn, emitter := newStatsD(t, statsdmetrics.WithSampleRate(0.5))
+	client := ali_mns.NewAliMNSClient(server.URL, "test-id", "test-secret", emitter.ClientOption())
+
+	const requests = 200
+	for i := 0; i < requests; i++ {
+		resp, err := client.Send(ali_mns.GET, nil, nil, "queues")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	sampled := 0
+	for lines := readLines(t, conn, time.Second); lines != nil; lines = readLines(t, conn, 200*time.Millisecond) {
+		for _, line := range lines {
+			if !strings.HasSuffix(line, "|@0.5|#status:200") {
+				t.Fatalf("line %q is not marked as sampled", line)
+			}
+		}
+		sampled++
+	}
+
+	// far outside of what a fair coin gives
+	if sampled < requests/4 || sampled > requests*3/4 {
+		t.Fatalf("%d of %d requests emitted at a sample rate of 0.5", sampled, requests)
+	}
+}
+
+func TestEmitterFlush(t *testing.T) {
+	clock := alimnstest.NewFakeClock(time.Time{})
+	conn, emitter := newStatsD(t, statsdmetrics.WithClock(clock), statsdmetrics.WithFlushInterval(time.Minute))
+
+	queue := alimnstest.NewFakeQueue()
+	emitter.AddQueue(queue)
+
+	send := func(delaySeconds int64) {
+		queue.SendMessage(ali_mns.MessageSendRequest{MessageBody: []byte("flushed"), DelaySeconds: delaySeconds})
+	}
+
+	qps := "ali_mns.queue.qps:0|g|#queue:fake-queue"
+
+	for _, step := range []struct {
+		name  string
+		sends []int64
+		flush func()
+		lines []string
+	}{
+		{"FirstFlushEmitsTotals", []int64{0, 0}, emitter.Flush, []string{
+			qps,
+			"ali_mns.queue.requests:2|c|#queue:fake-queue,operation:SendMessage",
+		}},
+		{"UnchangedCountsLeftOut", nil, emitter.Flush, []string{qps}},
+		{"TickerEmitsIncrease", []int64{0, -1}, func() {
+			deadline := time.Now().Add(5 * time.Second)
+			for clock.Waiters() == 0 && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			clock.Advance(time.Minute)
+		}, []string{
+			qps,
+			"ali_mns.queue.requests:2|c|#queue:fake-queue,operation:SendMessage",
+			"ali_mns.queue.request_errors:1|c|#queue:fake-queue,operation:SendMessage",
+		}},
+		{"CloseFlushes", []int64{0}, func() { emitter.Close() }, []string{
+			qps,
+			"ali_mns.queue.requests:1|c|#queue:fake-queue,operation:SendMessage",
+		}},
+	} {
+		for _, delaySeconds := range step.sends {
+			send(delaySeconds)
+		}
+		step.flush()
+
+		if lines := readLines(t, conn, 5*time.Second); !reflect.DeepEqual(lines, step.lines) {
+			t.Fatalf("%s: emitted %q, want %q", step.name, lines, step.lines)
+		}
+	}
+
+	if lines := readLines(t, conn, 100*time.Millisecond); lines != nil {
+		t.Fatalf("emitted %q after Close", lines)
+	}
+}
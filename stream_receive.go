@@ -0,0 +1,102 @@
+package ali_mns
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// messageStream decodes a batch receive response one message at a time,
+// straight from the response body.
+type messageStream struct {
+	queue *MNSQueue
+	fn    func(MessageReceiveResponse) error
+	meta  ResponseMeta
+	count int
+	err   error
+}
+
+func (p *messageStream) setResponseMeta(meta ResponseMeta) {
+	p.meta = meta
+}
+
+func (p *messageStream) UnmarshalXML(d *xml.Decoder, start xml.StartElement) (err error) {
+	if start.Name.Local != "Messages" {
+		return fmt.Errorf("expected element <Messages> but have <%s>", start.Name.Local)
+	}
+
+	for {
+		var token xml.Token
+		if token, err = d.Token(); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			if token.Name.Local != "Message" {
+				if err = d.Skip(); err != nil {
+					return
+				}
+				continue
+			}
+
+			wire := wireMessageReceiveResponse{}
+			if err = d.DecodeElement(&wire, &token); err != nil {
+				return
+			}
+			wire.setResponseMeta(p.meta)
+
+			var message MessageReceiveResponse
+			if message, err = p.queue.decodeMessage(wire); err != nil {
+				p.err = err
+				return
+			}
+
+			p.count++
+			p.queue.received(message)
+			if err = p.fn(message); err != nil {
+				p.err = err
+				return
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// StreamReceiver is implemented by queues passing received messages to a
+// function while the response is read, like MNSQueue and
+// alimnstest.FakeQueue.
+type StreamReceiver interface {
+	BatchReceiveMessageFunc(fn func(MessageReceiveResponse) error, numOfMessages int32, waitseconds ...int64) (err error)
+}
+
+// BatchReceiveMessageFunc receives up to numOfMessages messages with one
+// request and passes them to fn while the response is read, so only one
+// message is held in memory at a time. If fn returns an error the rest of
+// the response is dropped and the error is returned; the dropped messages
+// become visible again after the visibility timeout.
+func (p *MNSQueue) BatchReceiveMessageFunc(fn func(MessageReceiveResponse) error, numOfMessages int32, waitseconds ...int64) (err error) {
+	if numOfMessages <= 0 {
+		numOfMessages = DefaultNumOfMessages
+	}
+
+	resource := fmt.Sprintf("queues/%s/%s?numOfMessages=%d", p.name, "messages", numOfMessages)
+	if waitseconds != nil && len(waitseconds) == 1 && waitseconds[0] >= 0 {
+		resource = fmt.Sprintf("queues/%s/%s?numOfMessages=%d&waitseconds=%d", p.name, "messages", numOfMessages, waitseconds[0])
+	}
+
+	ctx := p.loopContext()
+	p.checkQPS(ctx)
+
+	stream := &messageStream{queue: p, fn: fn}
+	_, err = p.sendContext(ctx, GET, nil, nil, resource, stream)
+	if stream.err != nil {
+		return stream.err
+	}
+
+	return
+}
@@ -0,0 +1,55 @@
+package ali_mns_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/gogap/ali_mns"
+)
+
+func TestBatchReceiveMessageFunc(t *testing.T) {
+	errStop := errors.New("stop")
+
+	for _, test := range []struct {
+		name   string
+		failAt int
+		calls  int
+		err    error
+	}{
+		{"All", -1, 3, nil},
+		{"StopOnError", 0, 1, errStop},
+		{"StopMidway", 1, 2, errStop},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, queue := newTestQueue(t)
+
+			for i := 0; i < 3; i++ {
+				if _, err := queue.SendStringMessage(fmt.Sprintf("message %d", i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var bodies []string
+			err := queue.BatchReceiveMessageFunc(func(message ali_mns.MessageReceiveResponse) error {
+				bodies = append(bodies, string(message.MessageBody))
+				if len(bodies)-1 == test.failAt {
+					return errStop
+				}
+				return nil
+			}, 16, 0)
+
+			if err != test.err {
+				t.Fatalf("got %v, want %v", err, test.err)
+			}
+			if len(bodies) != test.calls {
+				t.Fatalf("fn called with %q, want %d calls", bodies, test.calls)
+			}
+			for i, body := range bodies {
+				if want := fmt.Sprintf("message %d", i); body != want {
+					t.Errorf("message %d is %q, want %q", i, body, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package ali_mns
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/gogap/errors"
+)
+
+var (
+	xmlUnmarshalerType = reflect.TypeOf((*xml.Unmarshaler)(nil)).Elem()
+
+	xmlElementsCache sync.Map
+)
+
+// xmlElements describes the child elements a struct decodes.
+type xmlElements struct {
+	children map[string]reflect.Type
+	required []string
+	any      bool
+}
+
+func decodeStrict(reader io.Reader, v interface{}) (err error) {
+	var data []byte
+	if data, err = ioutil.ReadAll(reader); err != nil {
+		return
+	}
+
+	if !utf8.Valid(data) {
+		return ERR_DECODE_INVALID_CHARSET.New(errors.Params{"err": fmt.Sprintf("invalid utf-8 byte at offset %d", invalidUTF8Offset(data))})
+	}
+
+	if err = checkElements(data, reflect.TypeOf(v)); err != nil {
+		return
+	}
+
+	return xml.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+func invalidUTF8Offset(data []byte) int {
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size == 1 {
+			return i
+		}
+		i += size
+	}
+	return -1
+}
+
+type elementFrame struct {
+	name     string
+	elements *xmlElements
+	seen     map[string]bool
+}
+
+// checkElements walks data and compares its elements with the fields of t.
+// Types implementing xml.Unmarshaler decode their own elements and are not
+// checked.
+func checkElements(data []byte, t reflect.Type) (err error) {
+	var charset string
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		charset = label
+		return nil, fmt.Errorf("unsupported charset %s", label)
+	}
+
+	var stack []*elementFrame
+	for {
+		token, e := decoder.Token()
+		if charset != "" {
+			return ERR_DECODE_INVALID_CHARSET.New(errors.Params{"err": "declared encoding " + charset})
+		}
+		if e == io.EOF {
+			return nil
+		}
+		if e != nil {
+			// syntax errors are reported by the decoder itself
+			return nil
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			name := token.Name.Local
+			if len(stack) == 0 {
+				stack = append(stack, newElementFrame(name, t))
+				continue
+			}
+
+			parent := stack[len(stack)-1]
+			if parent.elements == nil {
+				stack = append(stack, &elementFrame{name: name})
+				continue
+			}
+
+			child, exist := parent.elements.children[name]
+			if !exist && !parent.elements.any {
+				return ERR_DECODE_UNKNOWN_ELEMENT.New(errors.Params{"element": name, "parent": parent.name})
+			}
+
+			parent.seen[name] = true
+			stack = append(stack, newElementFrame(name, child))
+		case xml.EndElement:
+			frame := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			if frame.elements == nil {
+				continue
+			}
+
+			for _, name := range frame.elements.required {
+				if !frame.seen[name] {
+					return ERR_DECODE_MISSING_ELEMENT.New(errors.Params{"element": name, "parent": frame.name})
+				}
+			}
+		}
+	}
+}
+
+func newElementFrame(name string, t reflect.Type) *elementFrame {
+	elements := elementsOf(t)
+	if elements == nil {
+		return &elementFrame{name: name}
+	}
+
+	return &elementFrame{name: name, elements: elements, seen: make(map[string]bool)}
+}
+
+// elementsOf returns nil for types whose elements are not checked.
+func elementsOf(t reflect.Type) *xmlElements {
+	if t == nil {
+		return nil
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct || t.Implements(xmlUnmarshalerType) || reflect.PtrTo(t).Implements(xmlUnmarshalerType) {
+		return nil
+	}
+
+	if cached, exist := xmlElementsCache.Load(t); exist {
+		return cached.(*xmlElements)
+	}
+
+	elements := &xmlElements{children: make(map[string]reflect.Type)}
+	addElements(elements, t)
+
+	xmlElementsCache.Store(t, elements)
+
+	return elements
+}
+
+func addElements(elements *xmlElements, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Name == "XMLName" || field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		tag := field.Tag.Get("xml")
+		if tag == "-" {
+			continue
+		}
+
+		name, options := tag, ""
+		if i := strings.Index(tag, ","); i >= 0 {
+			name, options = tag[:i], tag[i+1:]
+		}
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			addElements(elements, fieldType)
+			continue
+		}
+
+		omitEmpty := false
+		skip := false
+		for _, option := range strings.Split(options, ",") {
+			switch option {
+			case "omitempty":
+				omitEmpty = true
+			case "any":
+				elements.any = true
+				skip = true
+			case "attr", "chardata", "cdata", "innerxml", "comment":
+				skip = true
+			}
+		}
+
+		if skip {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		// a>b paths are matched on their first element only
+		if i := strings.Index(name, ">"); i >= 0 {
+			elements.children[name[:i]] = nil
+			continue
+		}
+
+		if fieldType.Kind() == reflect.Slice && fieldType.Elem().Kind() != reflect.Uint8 {
+			elements.children[name] = fieldType.Elem()
+			continue
+		}
+
+		elements.children[name] = fieldType
+		if !omitEmpty {
+			elements.required = append(elements.required, name)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package ali_mns
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseRetryAfter reads a Retry-After header in seconds or as an HTTP date,
+// which is relative to the time of clock.
+func parseRetryAfter(value string, clock Clock) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	if seconds, e := strconv.Atoi(value); e == nil {
+		if seconds <= 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, e := http.ParseTime(value); e == nil {
+		if d := date.Sub(clock.Now()); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
+
+// RetryAfter returns how long the server asked to wait before repeating the
+// request that failed with err, zero if it gave no hint.
+func RetryAfter(err error) time.Duration {
+	var mnsErr *MNSError
+	if errors.As(err, &mnsErr) {
+		return mnsErr.retryAfter
+	}
+	return 0
+}
+
+func (p *MNSError) RetryAfter() time.Duration {
+	return p.retryAfter
+}
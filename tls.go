@@ -0,0 +1,42 @@
+package ali_mns
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+
+	"github.com/gogap/errors"
+)
+
+// NewTLSConfig builds a tls.Config trusting only the PEM CA bundle in caFile
+// and presenting the client certificate in certFile/keyFile. Empty paths are
+// skipped.
+func NewTLSConfig(caFile, certFile, keyFile string) (config *tls.Config, err error) {
+	config = &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		var pemCerts []byte
+		if pemCerts, err = ioutil.ReadFile(caFile); err != nil {
+			err = ERR_LOAD_TLS_CONFIG_FAILED.New(errors.Params{"err": err})
+			return
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pemCerts) {
+			err = ERR_LOAD_TLS_CONFIG_FAILED.New(errors.Params{"err": "no certificate found in " + caFile})
+			return
+		}
+		config.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		var cert tls.Certificate
+		if cert, err = tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+			err = ERR_LOAD_TLS_CONFIG_FAILED.New(errors.Params{"err": err})
+			return
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return
+}
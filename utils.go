@@ -1,15 +1,64 @@
 package ali_mns
 
 import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"time"
 
 	"github.com/gogap/errors"
 )
 
+type retryPolicyHolder interface {
+	retryPolicy() RetryPolicy
+}
+
+func clientRetryPolicy(client MNSClient) RetryPolicy {
+	if holder, ok := client.(retryPolicyHolder); ok {
+		return holder.retryPolicy()
+	}
+	return nil
+}
+
 func send(client MNSClient, decoder MNSDecoder, method Method, headers map[string]string, message interface{}, resource string, v interface{}) (statusCode int, err error) {
+	return sendWithRetry(context.Background(), client, decoder, clientRetryPolicy(client), method, headers, message, resource, v)
+}
+
+func sendWithRetry(ctx context.Context, client MNSClient, decoder MNSDecoder, retry RetryPolicy, method Method, headers map[string]string, message interface{}, resource string, v interface{}) (statusCode int, err error) {
+	for attempt := 1; ; attempt++ {
+		statusCode, err = sendOnce(ctx, client, decoder, method, headers, message, resource, v)
+		if err == nil {
+			return
+		}
+
+		recordError(client, statusCode, err)
+
+		// a done ctx is the caller giving up, its deadline is not a timeout
+		// worth retrying
+		if retry != nil && ctx.Err() == nil {
+			if shouldRetry, delay := retry.ShouldRetry(attempt, method, statusCode, err); shouldRetry && sleepContext(ctx, clockOf(client), delay) {
+				continue
+			}
+		}
+
+		err = wrapError(err)
+		fireErrorHooks(client, method, message, resource, err)
+
+		return
+	}
+}
+
+func sendOnce(ctx context.Context, client MNSClient, decoder MNSDecoder, method Method, headers map[string]string, message interface{}, resource string, v interface{}) (statusCode int, err error) {
 	var resp *http.Response
-	if resp, err = client.Send(method, headers, message, resource); err != nil {
+	if contextSender, ok := client.(ContextSender); ok {
+		resp, err = contextSender.SendContext(ctx, method, headers, message, resource)
+	} else {
+		resp, err = client.Send(method, headers, message, resource)
+	}
+
+	if err != nil {
 		return
 	}
 
@@ -17,30 +66,110 @@ func send(client MNSClient, decoder MNSDecoder, method Method, headers map[strin
 		defer resp.Body.Close()
 		statusCode = resp.StatusCode
 
-		if resp.StatusCode != http.StatusCreated &&
-			resp.StatusCode != http.StatusOK &&
-			resp.StatusCode != http.StatusNoContent {
-
-			errResp := ErrorMessageResponse{}
-			if e := decoder.Decode(resp.Body, &errResp); e != nil {
-				err = ERR_UNMARSHAL_ERROR_RESPONSE_FAILED.New(errors.Params{"err": e})
+		if !isSuccessStatus(resp.StatusCode) {
+			if partial, ok := v.(partialFailureResponse); ok {
+				err = decodePartialFailure(decoder, clockOf(client), resp, resource, partial)
 				return
 			}
-			err = ParseError(errResp, resource)
+
+			err = decodeErrorResponse(decoder, clockOf(client), resp, resp.Body, resource)
 			return
 		}
 
 		if v != nil {
+			// set before decoding too, for responses decoded as a stream
+			setResponseMeta(resp, v)
+
 			if e := decoder.Decode(resp.Body, v); e != nil {
 				err = ERR_UNMARSHAL_RESPONSE_FAILED.New(errors.Params{"err": e})
 				return
 			}
+
+			setResponseMeta(resp, v)
 		}
 	}
 
 	return
 }
 
+func setResponseMeta(resp *http.Response, v interface{}) {
+	if setter, ok := v.(responseMetaSetter); ok {
+		setter.setResponseMeta(ResponseMeta{
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header,
+			RequestId:  resp.Header.Get(MNS_REQUEST_ID),
+		})
+	}
+}
+
+func isSuccessStatus(statusCode int) bool {
+	return statusCode == http.StatusCreated ||
+		statusCode == http.StatusOK ||
+		statusCode == http.StatusNoContent
+}
+
+// partialFailureResponse is implemented by batch responses MNS fills with
+// per-entry results when only some entries failed.
+type partialFailureResponse interface {
+	failedEntries() (failed int, total int)
+}
+
+func decodePartialFailure(decoder MNSDecoder, clock Clock, resp *http.Response, resource string, v partialFailureResponse) (err error) {
+	body, e := ioutil.ReadAll(resp.Body)
+	if e != nil {
+		err = ERR_READ_RESPONSE_BODY_FAILED.New(errors.Params{"err": e})
+		return
+	}
+
+	if e := decoder.Decode(bytes.NewReader(body), v); e != nil {
+		return decodeErrorResponse(decoder, clock, resp, bytes.NewReader(body), resource)
+	}
+
+	failed, total := v.failedEntries()
+	if failed == 0 {
+		return decodeErrorResponse(decoder, clock, resp, bytes.NewReader(body), resource)
+	}
+
+	setResponseMeta(resp, v)
+
+	return newPartialFailure(failed, total, resource)
+}
+
+// maxErrorBodySize bounds the raw error response kept on decode failures,
+// proxies may answer with whole HTML pages.
+const maxErrorBodySize = 4096
+
+func decodeErrorResponse(decoder MNSDecoder, clock Clock, resp *http.Response, body io.Reader, resource string) (err error) {
+	rawBody, e := ioutil.ReadAll(io.LimitReader(body, maxErrorBodySize))
+	if e != nil {
+		err = ERR_READ_RESPONSE_BODY_FAILED.New(errors.Params{"err": e})
+		return
+	}
+
+	retryAfter := parseRetryAfter(resp.Header.Get(RETRY_AFTER), clock)
+
+	errResp := ErrorMessageResponse{}
+	if e := decoder.Decode(bytes.NewReader(rawBody), &errResp); e != nil {
+		return &MNSError{
+			ErrCode:    ERR_UNMARSHAL_ERROR_RESPONSE_FAILED.New(errors.Params{"err": e, "status": resp.StatusCode, "body": string(rawBody)}),
+			statusCode: resp.StatusCode,
+			rawBody:    rawBody,
+			retryAfter: retryAfter,
+		}
+	}
+
+	if errResp.RequestId == "" {
+		errResp.RequestId = resp.Header.Get(MNS_REQUEST_ID)
+	}
+
+	err = parseError(errResp, resource, resp.StatusCode)
+	if mnsErr, ok := err.(*MNSError); ok {
+		mnsErr.retryAfter = retryAfter
+	}
+
+	return
+}
+
 func now() time.Time {
 	if TimeNowFunc == nil {
 		return time.Now()
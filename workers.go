@@ -0,0 +1,74 @@
+package ali_mns
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+type PartitionKeyFunc func(message MessageReceiveResponse) string
+
+// WithPartitionKey handles messages with the same key one after another in
+// the order they were received, while messages with different keys still
+// use all workers. Keys are spread over the workers by hash, so unrelated
+// keys may occasionally wait for each other.
+func WithPartitionKey(keyFunc PartitionKeyFunc) ConsumerOption {
+	return func(p *Consumer) {
+		p.partitionKey = keyFunc
+	}
+}
+
+type workerPool struct {
+	jobs         []chan MessageReceiveResponse
+	partitionKey PartitionKeyFunc
+	workers      sync.WaitGroup
+}
+
+// newWorkerPool starts concurrency workers. Without a partition key they
+// share one job channel; with one, each worker owns a channel so a key is
+// always served by the same worker.
+func newWorkerPool(concurrency int, partitionKey PartitionKeyFunc, process func(MessageReceiveResponse)) *workerPool {
+	pool := &workerPool{partitionKey: partitionKey}
+
+	channels := 1
+	if partitionKey != nil {
+		channels = concurrency
+	}
+
+	for i := 0; i < channels; i++ {
+		pool.jobs = append(pool.jobs, make(chan MessageReceiveResponse))
+	}
+
+	for i := 0; i < concurrency; i++ {
+		jobs := pool.jobs[i%channels]
+		pool.workers.Add(1)
+		go func() {
+			defer pool.workers.Done()
+			for message := range jobs {
+				process(message)
+			}
+		}()
+	}
+
+	return pool
+}
+
+func (p *workerPool) jobsFor(message MessageReceiveResponse) chan MessageReceiveResponse {
+	if len(p.jobs) == 1 {
+		return p.jobs[0]
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(p.partitionKey(message)))
+
+	return p.jobs[hash.Sum32()%uint32(len(p.jobs))]
+}
+
+func (p *workerPool) close() {
+	for _, jobs := range p.jobs {
+		close(jobs)
+	}
+}
+
+func (p *workerPool) wait() {
+	p.workers.Wait()
+}
@@ -0,0 +1,19 @@
+package xrate
+
+import (
+	"github.com/gogap/ali_mns"
+	"golang.org/x/time/rate"
+)
+
+// *rate.Limiter is an ali_mns.Limiter as it is, so shared limiters can be
+// passed to ali_mns.WithLimiter directly.
+var _ ali_mns.Limiter = (*rate.Limiter)(nil)
+
+// New returns an ali_mns.Limiter allowing qps requests per second with
+// bursts of up to burst requests.
+func New(qps float64, burst int) ali_mns.Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.NewLimiter(rate.Limit(qps), burst)
+}